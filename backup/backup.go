@@ -11,6 +11,7 @@ import (
 
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gpbackup/backup_filepath"
 	"github.com/greenplum-db/gpbackup/backup_history"
 	"github.com/greenplum-db/gpbackup/utils"
@@ -33,26 +34,36 @@ func initializeFlags(cmd *cobra.Command) {
 
 func SetFlagDefaults(flagSet *pflag.FlagSet) {
 	flagSet.String(utils.BACKUP_DIR, "", "The absolute path of the directory to which all backup files will be written")
-	flagSet.Int(utils.COMPRESSION_LEVEL, 1, "Level of compression to use during data backup. Valid values are between 1 and 9.")
+	flagSet.Int(utils.COMPRESSION_LEVEL, 1, "Level of compression to use during data backup. Valid values are between 1 and 9 for gzip, 1 and 12 for lz4, and 1 and 19 for zstd.")
+	flagSet.String(utils.COMPRESSION_TYPE, "gzip", "Type of compression to use during data backup. Valid values are 'gzip', 'lz4', and 'zstd'.")
 	flagSet.Bool(utils.DATA_ONLY, false, "Only back up data, do not back up metadata")
 	flagSet.String(utils.DBNAME, "", "The database to be backed up")
 	flagSet.Bool(utils.DEBUG, false, "Print verbose and debug log messages")
+	flagSet.Bool(utils.DIFFERENTIAL, false, "Only back up data for AO and heap tables that have been modified since the last full backup")
+	flagSet.String(utils.ENCRYPTION_KEY_FILE, "", "The absolute path of a file, present on all hosts, containing a hex-encoded 256-bit key with which to encrypt all backup files")
 	flagSet.StringSlice(utils.EXCLUDE_SCHEMA, []string{}, "Back up all metadata except objects in the specified schema(s). --exclude-schema can be specified multiple times.")
 	flagSet.StringSlice(utils.EXCLUDE_RELATION, []string{}, "Back up all metadata except the specified table(s). --exclude-table can be specified multiple times.")
 	flagSet.String(utils.EXCLUDE_RELATION_FILE, "", "A file containing a list of fully-qualified tables to be excluded from the backup")
 	flagSet.String(utils.FROM_TIMESTAMP, "", "A timestamp to use to base the current incremental backup off")
 	flagSet.Bool("help", false, "Help for gpbackup")
+	flagSet.String(utils.HISTORY_FILE, "", "The absolute path of the backup history file, which may be on storage shared by several clusters. Defaults to gpbackup_history.yaml in the master data directory.")
 	flagSet.StringSlice(utils.INCLUDE_SCHEMA, []string{}, "Back up only the specified schema(s). --include-schema can be specified multiple times.")
 	flagSet.StringArray(utils.INCLUDE_RELATION, []string{}, "Back up only the specified table(s). --include-table can be specified multiple times.")
 	flagSet.String(utils.INCLUDE_RELATION_FILE, "", "A file containing a list of fully-qualified tables to be included in the backup")
-	flagSet.Bool(utils.INCREMENTAL, false, "Only back up data for AO tables that have been modified since the last backup")
+	flagSet.Bool(utils.INCREMENTAL, false, "Only back up data for AO and heap tables that have been modified since the last backup")
 	flagSet.Int(utils.JOBS, 1, "The number of parallel connections to use when backing up data")
+	flagSet.Int(utils.KEEP_DAYS, 0, "After a successful backup, delete the backups of the database taken more than this many days ago, unless --keep-full keeps them")
+	flagSet.Int(utils.KEEP_FULL, 0, "After a successful backup, keep only this many of the most recent full backups of the database, along with the incremental backups based on them, unless --keep-days keeps others")
 	flagSet.Bool(utils.LEAF_PARTITION_DATA, false, "For partition tables, create one data file per leaf partition instead of one data file for the whole table")
+	flagSet.String(utils.MAX_BANDWIDTH, "", "The maximum bandwidth, in bytes per second with an optional K, M, or G suffix, with which each segment reads and writes backup files")
+	flagSet.String(utils.MAX_HOST_BANDWIDTH, "", "The maximum bandwidth, in bytes per second with an optional K, M, or G suffix, with which each host reads and writes backup files, shared evenly among its segments")
 	flagSet.Bool(utils.METADATA_ONLY, false, "Only back up metadata, do not back up data")
 	flagSet.Bool(utils.NO_COMPRESSION, false, "Disable compression of data files")
 	flagSet.String(utils.PLUGIN_CONFIG, "", "The configuration file to use for a plugin")
+	flagSet.String(utils.PROGRESS_FILE, "", "The absolute path of a file, or /dev/fd/N for an open file descriptor, to which progress events are appended as JSON lines")
 	flagSet.Bool("version", false, "Print version number and exit")
 	flagSet.Bool(utils.QUIET, false, "Suppress non-warning, non-error log messages")
+	flagSet.String(utils.RESUME, "", "The timestamp of an interrupted backup to resume, skipping tables whose data was already backed up. Not supported with --single-data-file.")
 	flagSet.Bool(utils.SINGLE_DATA_FILE, false, "Back up all data to a single file instead of one per table")
 	flagSet.Bool(utils.VERBOSE, false, "Print verbose log messages")
 	flagSet.Bool(utils.WITH_STATS, false, "Back up query plan statistics")
@@ -76,8 +87,14 @@ func DoFlagValidation(cmd *cobra.Command) {
 // This function handles setup that must be done after parsing flags.
 func DoSetup() {
 	SetLoggerVerbosity()
+	backupStartTime = operating.System.Now()
 	timestamp := utils.CurrentTimestamp()
+	if MustGetFlagString(utils.RESUME) != "" {
+		timestamp = MustGetFlagString(utils.RESUME)
+	}
 	CreateBackupLockFile(timestamp)
+	err := utils.InitializeProgressFile(MustGetFlagString(utils.PROGRESS_FILE), "gpbackup", timestamp)
+	gplog.FatalOnError(err)
 
 	gplog.Info("Starting backup of database %s", MustGetFlagString(utils.DBNAME))
 	InitializeConnectionPool()
@@ -101,7 +118,27 @@ func DoSetup() {
 	CreateBackupDirectoriesOnAllHosts()
 	globalTOC = &utils.TOC{}
 	globalTOC.InitializeMetadataEntryMap()
-	utils.InitializePipeThroughParameters(!MustGetFlagBool(utils.NO_COMPRESSION), MustGetFlagInt(utils.COMPRESSION_LEVEL))
+	// Recorded so the backup can later be verified without a database connection
+	globalTOC.SegmentConfig = segConfig
+	err = utils.InitializeEncryption(MustGetFlagString(utils.ENCRYPTION_KEY_FILE))
+	gplog.FatalOnError(err)
+	err = utils.InitializeBandwidthLimits(globalCluster, MustGetFlagString(utils.MAX_BANDWIDTH), MustGetFlagString(utils.MAX_HOST_BANDWIDTH), MustGetFlagInt(utils.JOBS))
+	gplog.FatalOnError(err)
+	// Plugin backups with a data file per table have their checksums computed as the data is written
+	streamChecksums := MustGetFlagString(utils.PLUGIN_CONFIG) != "" && !MustGetFlagBool(utils.SINGLE_DATA_FILE)
+	utils.InitializePipeThroughParameters(!MustGetFlagBool(utils.NO_COMPRESSION), MustGetFlagString(utils.COMPRESSION_TYPE), MustGetFlagInt(utils.COMPRESSION_LEVEL), streamChecksums)
+	if !MustGetFlagBool(utils.METADATA_ONLY) {
+		// gpbackup_helper writes single data files and takes the place of the compression program when needed
+		if MustGetFlagBool(utils.SINGLE_DATA_FILE) || utils.UsesHelperPipeThroughProgram() {
+			utils.VerifyHelperVersionOnSegments(version, globalCluster)
+		}
+		if utils.IsEncryptionEnabled() {
+			utils.VerifyEncryptionKeyFileOnAllHosts(globalCluster)
+		}
+		if !MustGetFlagBool(utils.SINGLE_DATA_FILE) {
+			utils.VerifyCompressionProgramOnAllHosts(globalCluster)
+		}
+	}
 
 	pluginConfigFlag := MustGetFlagString(utils.PLUGIN_CONFIG)
 
@@ -112,6 +149,9 @@ func DoSetup() {
 	}
 
 	InitializeBackupReport(*opts)
+	if MustGetFlagString(utils.RESUME) != "" {
+		ResumeFromCheckpoint()
+	}
 
 	if pluginConfigFlag != "" {
 		pluginConfig.CheckPluginExistsOnAllHosts(globalCluster)
@@ -126,7 +166,7 @@ func DoBackup() {
 
 	targetBackupTimestamp := ""
 	var targetBackupFPInfo backup_filepath.FilePathInfo
-	if MustGetFlagBool(utils.INCREMENTAL) {
+	if MustGetFlagBool(utils.INCREMENTAL) || MustGetFlagBool(utils.DIFFERENTIAL) {
 		targetBackupTimestamp = GetTargetBackupTimestamp()
 		targetBackupFPInfo = backup_filepath.NewFilePathInfo(globalCluster, globalFPInfo.UserSpecifiedBackupDir,
 			targetBackupTimestamp, globalFPInfo.UserSpecifiedSegPrefix)
@@ -141,7 +181,7 @@ func DoBackup() {
 	gplog.Info("Gathering table state information")
 	metadataTables, dataTables := RetrieveAndProcessTables()
 	if !(MustGetFlagBool(utils.METADATA_ONLY) || MustGetFlagBool(utils.DATA_ONLY)) {
-		BackupIncrementalMetadata()
+		BackupIncrementalMetadata(dataTables)
 	}
 	CheckTablesContainData(dataTables)
 	metadataFilename := globalFPInfo.GetMetadataFilePath()
@@ -174,6 +214,7 @@ func DoBackup() {
 			targetBackupTOC := utils.NewTOC(targetBackupFPInfo.GetTOCFilePath())
 			targetBackupRestorePlan = backup_history.ReadConfigFile(targetBackupFPInfo.GetConfigFilePath()).RestorePlan
 			backupSetTables = FilterTablesForIncremental(targetBackupTOC, globalTOC, dataTables)
+			globalTOC.IncrementalMetadata.Changes = GetTableChanges(targetBackupTOC, globalTOC)
 		}
 
 		backupReport.RestorePlan = PopulateRestorePlan(backupSetTables, targetBackupRestorePlan, dataTables)
@@ -185,11 +226,15 @@ func DoBackup() {
 		backupStatistics(metadataTables)
 	}
 
+	metadataFile.Close()
+	globalTOC.MetadataChecksum = metadataFile.Checksum()
 	globalTOC.WriteToFileAndMakeReadOnly(globalFPInfo.GetTOCFilePath())
+	tocChecksum, err := utils.ComputeFileChecksum(globalFPInfo.GetTOCFilePath())
+	gplog.FatalOnError(err)
+	backupReport.BackupConfig.TOCChecksum = tocChecksum
 	for connNum := 0; connNum < connectionPool.NumConns; connNum++ {
 		connectionPool.MustCommit(connNum)
 	}
-	metadataFile.Close()
 	if MustGetFlagString(utils.PLUGIN_CONFIG) != "" {
 		pluginConfig.MustBackupFile(metadataFilename)
 		pluginConfig.MustBackupFile(globalFPInfo.GetTOCFilePath())
@@ -198,12 +243,14 @@ func DoBackup() {
 		}
 	}
 
-	err := backup_history.WriteBackupHistory(globalFPInfo.GetBackupHistoryFilePath(), &backupReport.BackupConfig)
-	gplog.FatalOnError(err)
+	if checkpoint != nil {
+		checkpoint.Remove()
+	}
 }
 
 func backupGlobal(metadataFile *utils.FileWithByteCount) {
 	gplog.Info("Writing global database metadata")
+	startBackupPhase("global")
 
 	BackupResourceQueues(metadataFile)
 	if connectionPool.Version.AtLeast("5") {
@@ -216,6 +263,7 @@ func backupGlobal(metadataFile *utils.FileWithByteCount) {
 	BackupDatabaseGUCs(metadataFile)
 	BackupRoleGUCs(metadataFile)
 
+	endBackupPhase("global")
 	if wasTerminated {
 		gplog.Info("Global database metadata backup incomplete")
 	} else {
@@ -228,6 +276,7 @@ func backupPredata(metadataFile *utils.FileWithByteCount, tables []Table, tableO
 		return
 	}
 	gplog.Info("Writing pre-data metadata")
+	startBackupPhase("predata")
 
 	sortables := make([]Sortable, 0)
 	metadataMap := make(MetadataMap)
@@ -291,6 +340,7 @@ func backupPredata(metadataFile *utils.FileWithByteCount, tables []Table, tableO
 
 	BackupConversions(metadataFile)
 	BackupConstraints(metadataFile, constraints, conMetadata)
+	endBackupPhase("predata")
 	if wasTerminated {
 		gplog.Info("Pre-data metadata backup incomplete")
 	} else {
@@ -299,9 +349,9 @@ func backupPredata(metadataFile *utils.FileWithByteCount, tables []Table, tableO
 }
 
 func backupData(tables []Table) {
+	startBackupPhase("data")
 	if MustGetFlagBool(utils.SINGLE_DATA_FILE) {
 		gplog.Verbose("Initializing pipes and gpbackup_helper on segments for single data file backup")
-		utils.VerifyHelperVersionOnSegments(version, globalCluster)
 		oidList := make([]string, 0, len(tables))
 		for _, table := range tables {
 			if !table.SkipDataBackup() {
@@ -310,19 +360,49 @@ func backupData(tables []Table) {
 		}
 		utils.WriteOidListToSegments(oidList, globalCluster, globalFPInfo)
 		utils.CreateFirstSegmentPipeOnAllHosts(oidList[0], globalCluster, globalFPInfo)
-		compressStr := fmt.Sprintf(" --compression-level %d", MustGetFlagInt(utils.COMPRESSION_LEVEL))
+		compressStr := fmt.Sprintf(" --compression-level %d --compression-type %s", MustGetFlagInt(utils.COMPRESSION_LEVEL), MustGetFlagString(utils.COMPRESSION_TYPE))
 		if MustGetFlagBool(utils.NO_COMPRESSION) {
 			compressStr = " --compression-level 0"
 		}
 		utils.StartAgent(globalCluster, globalFPInfo, "--backup-agent",
 			MustGetFlagString(utils.PLUGIN_CONFIG), compressStr)
+		stopSegmentProgressPolling := utils.StartSegmentProgressPolling(globalCluster, globalFPInfo)
+		defer stopSegmentProgressPolling()
+	}
+	tablesToBackUp := tables
+	resumedRowsCopiedMap := make(map[uint32]int64, 0)
+	tableSizeMap := make(map[uint32]int64, 0)
+	if !MustGetFlagBool(utils.SINGLE_DATA_FILE) {
+		InitializeCheckpoint()
+		if MustGetFlagString(utils.RESUME) != "" {
+			tablesToBackUp, resumedRowsCopiedMap = GetTablesToResume(tables)
+		}
+		tableSizeMap = GetTableSizes(connectionPool, tables)
+		tablesToBackUp = SortTablesBySize(tablesToBackUp, tableSizeMap)
 	}
 	gplog.Info("Writing data to file")
-	rowsCopiedMaps := BackupDataForAllTables(tables)
-	AddTableDataEntriesToTOC(tables, rowsCopiedMaps)
+	rowsCopiedMaps := BackupDataForAllTables(tablesToBackUp, tableSizeMap)
+	AddTableDataEntriesToTOC(tables, append(rowsCopiedMaps, resumedRowsCopiedMap))
+	globalTOC.AddDataEntrySizes(tableSizeMap)
+	if !MustGetFlagBool(utils.SINGLE_DATA_FILE) && !wasTerminated {
+		checksumMap := GatherDataFileChecksumsFromSegments(tables)
+		err := checkpoint.RecordChecksums(checksumMap)
+		if err != nil {
+			gplog.Fatal(err, "Unable to write data file checksums to checkpoint file")
+		}
+		globalTOC.AddDataEntryChecksums(checksumMap)
+	}
+	RecordDataMetrics(globalTOC)
+	if MustGetFlagString(utils.PLUGIN_CONFIG) == "" && !wasTerminated {
+		backupReport.Metrics.SetSegmentBytes(GatherBackupFileSizesFromSegments())
+	}
+	if MustGetFlagBool(utils.SINGLE_DATA_FILE) && !wasTerminated {
+		globalTOC.SegmentTOCChecksums = GatherSegmentTOCChecksumsFromSegments()
+	}
 	if MustGetFlagBool(utils.SINGLE_DATA_FILE) && MustGetFlagString(utils.PLUGIN_CONFIG) != "" {
 		pluginConfig.BackupSegmentTOCs(globalCluster, globalFPInfo)
 	}
+	endBackupPhase("data")
 	if wasTerminated {
 		gplog.Info("Data backup incomplete")
 	} else {
@@ -335,6 +415,7 @@ func backupPostdata(metadataFile *utils.FileWithByteCount) {
 		return
 	}
 	gplog.Info("Writing post-data metadata")
+	startBackupPhase("postdata")
 
 	BackupIndexes(metadataFile)
 	BackupRules(metadataFile)
@@ -345,6 +426,7 @@ func backupPostdata(metadataFile *utils.FileWithByteCount) {
 			BackupEventTriggers(metadataFile)
 		}
 	}
+	endBackupPhase("postdata")
 	if wasTerminated {
 		gplog.Info("Post-data metadata backup incomplete")
 	} else {
@@ -358,9 +440,13 @@ func backupStatistics(tables []Table) {
 	}
 	statisticsFilename := globalFPInfo.GetStatisticsFilePath()
 	gplog.Info("Writing query planner statistics to %s", statisticsFilename)
+	startBackupPhase("statistics")
 	statisticsFile := utils.NewFileWithByteCountFromFile(statisticsFilename)
-	defer statisticsFile.Close()
 	BackupStatistics(statisticsFile, tables)
+	// The file must be closed first so that the checksum covers any encrypted bytes still buffered
+	statisticsFile.Close()
+	globalTOC.StatisticsChecksum = statisticsFile.Checksum()
+	endBackupPhase("statistics")
 	if wasTerminated {
 		gplog.Info("Query planner statistics backup incomplete")
 	} else {
@@ -376,6 +462,8 @@ func DoTeardown() {
 		if errorCode == 0 {
 			gplog.Info("Backup completed successfully")
 		}
+		utils.EmitEnd(errorCode)
+		utils.CloseProgressFile()
 		os.Exit(errorCode)
 	}()
 
@@ -392,10 +480,14 @@ func DoTeardown() {
 	if wasTerminated {
 		/*
 		 * Don't print an error or create a report file if the backup was canceled,
-		 * as the signal handler will take care of cleanup and return codes.  Just
-		 * wait until the signal handler's DoCleanup completes so the main goroutine
-		 * doesn't exit while cleanup is still in progress.
+		 * as the signal handler will take care of cleanup and return codes, but do
+		 * record the canceled backup in the history file.  Then wait until the
+		 * signal handler's DoCleanup completes so the main goroutine doesn't exit
+		 * while cleanup is still in progress.
 		 */
+		if globalFPInfo.Timestamp != "" && backupReport != nil {
+			RecordBackupOutcome("Backup was canceled")
+		}
 		CleanupGroup.Wait()
 		return
 	}
@@ -403,6 +495,9 @@ func DoTeardown() {
 		fmt.Println(errStr)
 	}
 	errMsg := utils.ParseErrorMessage(errStr)
+	if errMsg != "" {
+		utils.EmitError("", errMsg)
+	}
 
 	/*
 	 * Only create a report file if we fail after the cluster is initialized
@@ -419,6 +514,7 @@ func DoTeardown() {
 		time.Sleep(time.Second) // We sleep for 1 second to ensure multiple backups do not start within the same second.
 
 		if backupReport != nil {
+			errMsg = RecordBackupOutcome(errMsg)
 			backupReport.ConstructBackupParamsString()
 			backup_history.WriteConfigFile(&backupReport.BackupConfig, configFilename)
 			backupReport.WriteBackupReportFile(reportFilename, globalFPInfo.Timestamp, objectCounts, errMsg)
@@ -439,6 +535,9 @@ func DoTeardown() {
 		if pluginConfig != nil {
 			pluginConfig.CleanupPluginForBackup(globalCluster, globalFPInfo)
 		}
+		if errMsg == "" && gplog.GetErrorCode() == 0 && IsRetentionPolicySet() {
+			ApplyRetentionPolicy()
+		}
 	}
 }
 
@@ -0,0 +1,262 @@
+package backup
+
+/*
+ * This file contains structs and functions for the checkpoint that allows an
+ * interrupted backup with one data file per table to be resumed with --resume.
+ */
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/backup_history"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+type CheckpointEntry struct {
+	Oid             uint32
+	Schema          string
+	Name            string
+	AttributeString string
+	RowsCopied      int64
+	Checksums       map[int]string `json:",omitempty"`
+}
+
+/*
+ * The checkpoint file holds the configuration of the backup on its first line,
+ * followed by one line for each table whose data has been backed up.  Lines
+ * are appended as each COPY finishes, so after a crash the file is intact up to,
+ * at worst, a partially written last line, which is ignored when it is read.
+ * The file is rewritten once the data file checksums have been gathered, as
+ * their sidecar files are removed from the segments when they are.
+ */
+type Checkpoint struct {
+	Filename     string
+	BackupConfig backup_history.BackupConfig
+	Entries      map[uint32]CheckpointEntry
+	file         io.WriteCloser
+	mutex        sync.Mutex
+}
+
+func NewCheckpoint(filename string, config backup_history.BackupConfig) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{Filename: filename, BackupConfig: config, Entries: make(map[uint32]CheckpointEntry, 0)}
+	err := checkpoint.rewrite()
+	if err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+func ReadCheckpoint(filename string) (*Checkpoint, error) {
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimRight(string(contents), "\n"), "\n")
+	checkpoint := &Checkpoint{Filename: filename, Entries: make(map[uint32]CheckpointEntry, 0)}
+	err = json.Unmarshal([]byte(lines[0]), &checkpoint.BackupConfig)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read backup configuration from checkpoint file %s", filename)
+	}
+	for i, line := range lines[1:] {
+		var entry CheckpointEntry
+		err = json.Unmarshal([]byte(line), &entry)
+		if err != nil {
+			if i == len(lines)-2 {
+				gplog.Verbose("Ignoring partially written last line of checkpoint file %s", filename)
+				break
+			}
+			return nil, errors.Wrapf(err, "Unable to read line %d of checkpoint file %s", i+2, filename)
+		}
+		checkpoint.Entries[entry.Oid] = entry
+	}
+	return checkpoint, nil
+}
+
+/*
+ * Writes the configuration and all entries read so far to a fresh file, which
+ * drops any partially written line, and leaves it open for appending.
+ */
+func (checkpoint *Checkpoint) rewrite() error {
+	file, err := operating.System.OpenFileWrite(checkpoint.Filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	lines := []interface{}{checkpoint.BackupConfig}
+	for _, entry := range checkpoint.Entries {
+		lines = append(lines, entry)
+	}
+	for _, line := range lines {
+		err = writeCheckpointLine(writer, line)
+		if err != nil {
+			return err
+		}
+	}
+	err = writer.Flush()
+	if err != nil {
+		return err
+	}
+	checkpoint.file = file
+	return nil
+}
+
+func writeCheckpointLine(writer io.Writer, value interface{}) error {
+	line, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(append(line, '\n'))
+	return err
+}
+
+// This function is called by concurrent COPY workers
+func (checkpoint *Checkpoint) RecordTable(table Table, rowsCopied int64) error {
+	entry := CheckpointEntry{Oid: table.Oid, Schema: table.Schema, Name: table.Name,
+		AttributeString: ConstructTableAttributesList(table.ColumnDefs), RowsCopied: rowsCopied}
+	checkpoint.mutex.Lock()
+	defer checkpoint.mutex.Unlock()
+	checkpoint.Entries[table.Oid] = entry
+	return writeCheckpointLine(checkpoint.file, entry)
+}
+
+/*
+ * An entry only counts as finished if the table has the same name it had when
+ * its data was backed up, in case its oid has since been reused, and the same
+ * columns, as the TOC entry for its data is built from the current catalog and
+ * its column list must match the columns in the data file.
+ */
+func (checkpoint *Checkpoint) GetFinishedEntry(table Table) (CheckpointEntry, bool) {
+	entry, ok := checkpoint.Entries[table.Oid]
+	if !ok || entry.Schema != table.Schema || entry.Name != table.Name ||
+		entry.AttributeString != ConstructTableAttributesList(table.ColumnDefs) {
+		return CheckpointEntry{}, false
+	}
+	return entry, true
+}
+
+/*
+ * Saves the checksums gathered from the segments with the tables they belong
+ * to, and adds to checksumMap those saved for tables whose checksums were
+ * gathered before the backup was interrupted.
+ */
+func (checkpoint *Checkpoint) RecordChecksums(checksumMap map[uint32]map[int]string) error {
+	checkpoint.mutex.Lock()
+	defer checkpoint.mutex.Unlock()
+	for oid, entry := range checkpoint.Entries {
+		if checksums, ok := checksumMap[oid]; ok {
+			entry.Checksums = checksums
+			checkpoint.Entries[oid] = entry
+		} else if entry.Checksums != nil {
+			checksumMap[oid] = entry.Checksums
+		}
+	}
+	checkpoint.Close()
+	return checkpoint.rewrite()
+}
+
+func (checkpoint *Checkpoint) Close() {
+	if checkpoint.file != nil {
+		_ = checkpoint.file.Close()
+		checkpoint.file = nil
+	}
+}
+
+// The checkpoint is only removed once the backup has completed successfully
+func (checkpoint *Checkpoint) Remove() {
+	checkpoint.Close()
+	err := os.Remove(checkpoint.Filename)
+	if err != nil {
+		gplog.Warn("Unable to remove checkpoint file %s: %v", checkpoint.Filename, err)
+	}
+}
+
+/*
+ * Backup flow functions for checkpointing and resuming
+ */
+
+func InitializeCheckpoint() {
+	if checkpoint != nil {
+		return
+	}
+	var err error
+	checkpoint, err = NewCheckpoint(globalFPInfo.GetCheckpointFilePath(), backupReport.BackupConfig)
+	if err != nil {
+		gplog.Fatal(err, "Unable to create checkpoint file")
+	}
+}
+
+func MatchesResumeFlags(checkpointConfig *backup_history.BackupConfig, currentConfig *backup_history.BackupConfig) bool {
+	return checkpointConfig.BackupDir == currentConfig.BackupDir &&
+		checkpointConfig.DatabaseName == currentConfig.DatabaseName &&
+		checkpointConfig.Compressed == currentConfig.Compressed &&
+		checkpointConfig.GetCompressionType() == currentConfig.GetCompressionType() &&
+		checkpointConfig.EncryptionKeyFingerprint == currentConfig.EncryptionKeyFingerprint &&
+		checkpointConfig.DataOnly == currentConfig.DataOnly &&
+		checkpointConfig.Incremental == currentConfig.Incremental &&
+		checkpointConfig.Differential == currentConfig.Differential &&
+		checkpointConfig.LeafPartitionData == currentConfig.LeafPartitionData &&
+		checkpointConfig.Plugin == currentConfig.Plugin &&
+		checkpointConfig.SingleDataFile == currentConfig.SingleDataFile &&
+		checkpointConfig.WithStatistics == currentConfig.WithStatistics &&
+		utils.NewIncludeSet(checkpointConfig.IncludeRelations).Equals(utils.NewIncludeSet(currentConfig.IncludeRelations)) &&
+		utils.NewIncludeSet(checkpointConfig.IncludeSchemas).Equals(utils.NewIncludeSet(currentConfig.IncludeSchemas)) &&
+		utils.NewIncludeSet(checkpointConfig.ExcludeRelations).Equals(utils.NewIncludeSet(currentConfig.ExcludeRelations)) &&
+		utils.NewIncludeSet(checkpointConfig.ExcludeSchemas).Equals(utils.NewIncludeSet(currentConfig.ExcludeSchemas))
+}
+
+/*
+ * Metadata, statistics and the TOC are regenerated in full when a backup is
+ * resumed, so any left over from the interrupted run are removed first, along
+ * with the config and report files written when it failed.
+ */
+func ResumeFromCheckpoint() {
+	checkpointFilename := globalFPInfo.GetCheckpointFilePath()
+	if _, err := operating.System.Stat(checkpointFilename); err != nil {
+		gplog.Fatal(errors.Errorf("No checkpoint found for backup with timestamp %s.  The backup either completed or was interrupted before any table data was backed up.", globalFPInfo.Timestamp), "")
+	}
+	var err error
+	checkpoint, err = ReadCheckpoint(checkpointFilename)
+	gplog.FatalOnError(err)
+	if !MatchesResumeFlags(&checkpoint.BackupConfig, &backupReport.BackupConfig) {
+		gplog.Fatal(errors.Errorf("The flags of the backup with timestamp %s do not match those of the current one.  Run gpbackup with the same flags as the interrupted backup to resume it.", globalFPInfo.Timestamp), "")
+	}
+	for _, filename := range []string{globalFPInfo.GetMetadataFilePath(), globalFPInfo.GetStatisticsFilePath(), globalFPInfo.GetTOCFilePath(),
+		globalFPInfo.GetConfigFilePath(), globalFPInfo.GetBackupReportFilePath()} {
+		err = os.Remove(filename)
+		if err != nil && !os.IsNotExist(err) {
+			gplog.Fatal(err, fmt.Sprintf("Unable to remove file %s from interrupted backup", filename))
+		}
+	}
+	err = checkpoint.rewrite()
+	if err != nil {
+		gplog.Fatal(err, "Unable to open checkpoint file")
+	}
+	gplog.Info("Resuming backup with timestamp %s; data for %d table(s) was already backed up", globalFPInfo.Timestamp, len(checkpoint.Entries))
+}
+
+/*
+ * Returns the tables whose data still needs to be backed up, and the rows
+ * copied for those that were already backed up by the interrupted run.
+ */
+func GetTablesToResume(tables []Table) ([]Table, map[uint32]int64) {
+	remainingTables := make([]Table, 0, len(tables))
+	rowsCopiedMap := make(map[uint32]int64, 0)
+	for _, table := range tables {
+		if entry, ok := checkpoint.GetFinishedEntry(table); ok {
+			gplog.Verbose("Skipping data backup of table %s because it was already backed up", table.FQN())
+			rowsCopiedMap[table.Oid] = entry.RowsCopied
+		} else {
+			remainingTables = append(remainingTables, table)
+		}
+	}
+	return remainingTables, rowsCopiedMap
+}
@@ -0,0 +1,141 @@
+package backup_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/backup_history"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/checkpoint tests", func() {
+	var (
+		checkpointDir      string
+		checkpointFilename string
+		config             backup_history.BackupConfig
+		fooTable           backup.Table
+		barTable           backup.Table
+	)
+	BeforeEach(func() {
+		checkpointDir, _ = ioutil.TempDir("", "checkpoint")
+		checkpointFilename = filepath.Join(checkpointDir, "gpbackup_20170101010101_checkpoint")
+		config = backup_history.BackupConfig{DatabaseName: "testdb", Compressed: true, CompressionType: "gzip", Timestamp: "20170101010101"}
+		fooTable = backup.Table{Relation: backup.Relation{Oid: 1, Schema: "public", Name: "foo"}}
+		barTable = backup.Table{Relation: backup.Relation{Oid: 2, Schema: "public", Name: "bar"}}
+	})
+	AfterEach(func() {
+		_ = os.RemoveAll(checkpointDir)
+		backup.SetCheckpoint(nil)
+	})
+	Describe("NewCheckpoint and ReadCheckpoint", func() {
+		It("reads back the configuration and finished tables", func() {
+			checkpoint, err := backup.NewCheckpoint(checkpointFilename, config)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checkpoint.RecordTable(fooTable, 10)).To(Succeed())
+			Expect(checkpoint.RecordTable(barTable, 20)).To(Succeed())
+			checkpoint.Close()
+
+			resultCheckpoint, err := backup.ReadCheckpoint(checkpointFilename)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resultCheckpoint.BackupConfig.DatabaseName).To(Equal("testdb"))
+			Expect(resultCheckpoint.Entries).To(HaveLen(2))
+			Expect(resultCheckpoint.Entries[2]).To(Equal(backup.CheckpointEntry{Oid: 2, Schema: "public", Name: "bar", RowsCopied: 20}))
+		})
+		It("ignores a partially written last line", func() {
+			checkpoint, _ := backup.NewCheckpoint(checkpointFilename, config)
+			_ = checkpoint.RecordTable(fooTable, 10)
+			checkpoint.Close()
+			file, _ := os.OpenFile(checkpointFilename, os.O_APPEND|os.O_WRONLY, 0644)
+			_, _ = file.WriteString(`{"Oid":2,"Sche`)
+			_ = file.Close()
+
+			resultCheckpoint, err := backup.ReadCheckpoint(checkpointFilename)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resultCheckpoint.Entries).To(HaveLen(1))
+		})
+		It("returns an error if the configuration cannot be read", func() {
+			_ = ioutil.WriteFile(checkpointFilename, []byte("not a checkpoint\n"), 0644)
+			_, err := backup.ReadCheckpoint(checkpointFilename)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Describe("GetTablesToResume", func() {
+		It("skips tables already backed up and keeps their rows copied", func() {
+			checkpoint, _ := backup.NewCheckpoint(checkpointFilename, config)
+			_ = checkpoint.RecordTable(fooTable, 10)
+			backup.SetCheckpoint(checkpoint)
+
+			remainingTables, rowsCopiedMap := backup.GetTablesToResume([]backup.Table{fooTable, barTable})
+			Expect(remainingTables).To(Equal([]backup.Table{barTable}))
+			Expect(rowsCopiedMap).To(Equal(map[uint32]int64{1: 10}))
+		})
+		It("backs up a table again if its oid now belongs to a different table", func() {
+			checkpoint, _ := backup.NewCheckpoint(checkpointFilename, config)
+			_ = checkpoint.RecordTable(fooTable, 10)
+			backup.SetCheckpoint(checkpoint)
+			renamedTable := backup.Table{Relation: backup.Relation{Oid: 1, Schema: "public", Name: "baz"}}
+
+			remainingTables, rowsCopiedMap := backup.GetTablesToResume([]backup.Table{renamedTable})
+			Expect(remainingTables).To(Equal([]backup.Table{renamedTable}))
+			Expect(rowsCopiedMap).To(BeEmpty())
+		})
+		It("backs up a table again if its columns have changed", func() {
+			fooTable.ColumnDefs = []backup.ColumnDefinition{{Name: "i"}}
+			checkpoint, _ := backup.NewCheckpoint(checkpointFilename, config)
+			_ = checkpoint.RecordTable(fooTable, 10)
+			backup.SetCheckpoint(checkpoint)
+			alteredTable := fooTable
+			alteredTable.ColumnDefs = []backup.ColumnDefinition{{Name: "i"}, {Name: "j"}}
+
+			remainingTables, rowsCopiedMap := backup.GetTablesToResume([]backup.Table{alteredTable})
+			Expect(remainingTables).To(Equal([]backup.Table{alteredTable}))
+			Expect(rowsCopiedMap).To(BeEmpty())
+		})
+	})
+	Describe("RecordChecksums", func() {
+		It("saves gathered checksums and restores those gathered before the interruption", func() {
+			checkpoint, _ := backup.NewCheckpoint(checkpointFilename, config)
+			_ = checkpoint.RecordTable(fooTable, 10)
+			Expect(checkpoint.RecordChecksums(map[uint32]map[int]string{1: {0: "1111"}})).To(Succeed())
+			_ = checkpoint.RecordTable(barTable, 20)
+			checkpoint.Close()
+
+			resumedCheckpoint, _ := backup.ReadCheckpoint(checkpointFilename)
+			checksumMap := map[uint32]map[int]string{2: {0: "2222"}}
+			Expect(resumedCheckpoint.RecordChecksums(checksumMap)).To(Succeed())
+			resumedCheckpoint.Close()
+			Expect(checksumMap).To(Equal(map[uint32]map[int]string{1: {0: "1111"}, 2: {0: "2222"}}))
+
+			resultCheckpoint, _ := backup.ReadCheckpoint(checkpointFilename)
+			Expect(resultCheckpoint.Entries[2].Checksums).To(Equal(map[int]string{0: "2222"}))
+		})
+	})
+	Describe("MatchesResumeFlags", func() {
+		It("matches a backup with the same flags", func() {
+			currentConfig := config
+			currentConfig.BackupVersion = "1.2.3"
+			Expect(backup.MatchesResumeFlags(&config, &currentConfig)).To(BeTrue())
+		})
+		It("does not match a backup with a different compression type", func() {
+			currentConfig := config
+			currentConfig.CompressionType = "zstd"
+			Expect(backup.MatchesResumeFlags(&config, &currentConfig)).To(BeFalse())
+		})
+		It("does not match a differential backup when resuming an incremental backup", func() {
+			differentialConfig := config
+			differentialConfig.Incremental = true
+			differentialConfig.Differential = true
+			currentConfig := differentialConfig
+			currentConfig.Differential = false
+			Expect(backup.MatchesResumeFlags(&differentialConfig, &currentConfig)).To(BeFalse())
+		})
+		It("does not match a backup with different filters", func() {
+			currentConfig := config
+			currentConfig.IncludeSchemas = []string{"public"}
+			Expect(backup.MatchesResumeFlags(&config, &currentConfig)).To(BeFalse())
+		})
+	})
+})
@@ -6,6 +6,7 @@ package backup
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"sync"
@@ -13,11 +14,13 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
 	"gopkg.in/cheggaaa/pb.v1"
 )
 
 var (
-	tableDelim = ","
+	tableDelim            = ","
+	checksumFileExtension = ".checksum"
 )
 
 func ConstructTableAttributesList(columnDefs []ColumnDefinition) string {
@@ -47,9 +50,29 @@ func AddTableDataEntriesToTOC(tables []Table, rowsCopiedMaps []map[uint32]int64)
 	}
 }
 
+/*
+ * Tables are backed up largest first so that, with multiple connections, a large
+ * table is not left to run alone at the end while the smaller tables fill in
+ * around the larger ones.  Tables of equal size keep their catalog order.
+ */
+func SortTablesBySize(tables []Table, tableSizeMap map[uint32]int64) []Table {
+	sortedTables := make([]Table, len(tables))
+	copy(sortedTables, tables)
+	sort.SliceStable(sortedTables, func(i int, j int) bool {
+		return tableSizeMap[sortedTables[i].Oid] > tableSizeMap[sortedTables[j].Oid]
+	})
+	for i, table := range sortedTables {
+		if !table.SkipDataBackup() {
+			gplog.Verbose("Data backup order %d of %d: table %s (%d bytes)", i+1, len(sortedTables), table.FQN(), tableSizeMap[table.Oid])
+		}
+	}
+	return sortedTables
+}
+
 type BackupProgressCounters struct {
 	NumRegTables   int64
 	TotalRegTables int64
+	TableSizes     map[uint32]int64
 	mutex          sync.Mutex
 	ProgressBar    utils.ProgressBar
 }
@@ -58,6 +81,7 @@ func CopyTableOut(connectionPool *dbconn.DBConn, table Table, destinationToWrite
 	checkPipeExistsCommand := ""
 	customPipeThroughCommand := utils.GetPipeThroughProgram().OutputCommand
 	sendToDestinationCommand := ">"
+	checksumCommand := ""
 	if MustGetFlagBool(utils.SINGLE_DATA_FILE) {
 		/*
 		 * The segment TOC files are always written to the segment data directory for
@@ -68,10 +92,26 @@ func CopyTableOut(connectionPool *dbconn.DBConn, table Table, destinationToWrite
 		checkPipeExistsCommand = fmt.Sprintf("(test -p \"%s\" || (echo \"Pipe not found %s\">&2; exit 1)) && ", destinationToWrite, destinationToWrite)
 		customPipeThroughCommand = "cat -"
 	} else if MustGetFlagString(utils.PLUGIN_CONFIG) != "" {
+		/*
+		 * The plugin stores the file where it cannot be read back on the segment,
+		 * so gpbackup_helper computes the checksum as it writes the stream and
+		 * records it only once the whole stream is written; checking for the
+		 * checksum file also fails COPY if the helper fails, as the pipeline
+		 * would otherwise report only the status of the plugin.
+		 */
+		customPipeThroughCommand += fmt.Sprintf(" --data-file %s --checksum-file %s%s", destinationToWrite, destinationToWrite, checksumFileExtension)
 		sendToDestinationCommand = fmt.Sprintf("| %s backup_data %s", pluginConfig.ExecutablePath, pluginConfig.ConfigPath)
+		checksumCommand = fmt.Sprintf(" && test -f %s%s", destinationToWrite, checksumFileExtension)
+	} else {
+		/*
+		 * The checksum is computed once the file is written rather than by
+		 * splitting the stream with tee, as a pipeline would hide a failure
+		 * in the compression program from COPY.
+		 */
+		checksumCommand = fmt.Sprintf(" && %s %s > %s%s", utils.ChecksumProgram, destinationToWrite, destinationToWrite, checksumFileExtension)
 	}
 
-	copyCommand := fmt.Sprintf("PROGRAM '%s%s %s %s'", checkPipeExistsCommand, customPipeThroughCommand, sendToDestinationCommand, destinationToWrite)
+	copyCommand := fmt.Sprintf("PROGRAM '%s%s %s %s%s'", checkPipeExistsCommand, customPipeThroughCommand, sendToDestinationCommand, destinationToWrite, checksumCommand)
 
 	query := fmt.Sprintf("COPY %s TO %s WITH CSV DELIMITER '%s' ON SEGMENT IGNORE EXTERNAL PARTITIONS;", table.FQN(), copyCommand, tableDelim)
 	result, err := connectionPool.Exec(query, connNum)
@@ -103,24 +143,33 @@ func BackupSingleTableData(table Table, rowsCopiedMap map[uint32]int64, counters
 		} else {
 			destinationToWrite = globalFPInfo.GetTableBackupFilePathForCopyCommand(table.Oid, utils.GetPipeThroughProgram().Extension, false)
 		}
+		utils.EmitTableStart(table.FQN(), table.Oid, counters.TableSizes[table.Oid])
 		rowsCopied, err := CopyTableOut(connectionPool, table, destinationToWrite, whichConn)
 		if err != nil {
+			utils.EmitError(table.FQN(), err.Error())
 			return err
 		}
+		utils.EmitTableFinish(table.FQN(), table.Oid, rowsCopied, counters.TableSizes[table.Oid])
 		rowsCopiedMap[table.Oid] = rowsCopied
+		if checkpoint != nil {
+			err = checkpoint.RecordTable(table, rowsCopied)
+			if err != nil {
+				return errors.Wrap(err, "Unable to write to checkpoint file")
+			}
+		}
 		counters.ProgressBar.Increment()
 	}
 	return nil
 }
 
-func BackupDataForAllTables(tables []Table) []map[uint32]int64 {
+func BackupDataForAllTables(tables []Table, tableSizeMap map[uint32]int64) []map[uint32]int64 {
 	var numExtOrForeignTables int64
 	for _, table := range tables {
 		if table.SkipDataBackup() {
 			numExtOrForeignTables++
 		}
 	}
-	counters := BackupProgressCounters{NumRegTables: 0, TotalRegTables: int64(len(tables)) - numExtOrForeignTables}
+	counters := BackupProgressCounters{NumRegTables: 0, TotalRegTables: int64(len(tables)) - numExtOrForeignTables, TableSizes: tableSizeMap}
 	counters.ProgressBar = utils.NewProgressBar(int(counters.TotalRegTables), "Tables backed up: ", utils.PB_INFO)
 	counters.ProgressBar.Start()
 	rowsCopiedMaps := make([]map[uint32]int64, connectionPool.NumConns)
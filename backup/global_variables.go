@@ -2,6 +2,7 @@ package backup
 
 import (
 	"sync"
+	"time"
 
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
@@ -21,16 +22,19 @@ import (
  * Non-flag variables
  */
 var (
-	backupReport   *utils.Report
-	connectionPool *dbconn.DBConn
-	globalCluster  *cluster.Cluster
-	globalFPInfo   backup_filepath.FilePathInfo
-	globalTOC      *utils.TOC
-	objectCounts   map[string]int
-	pluginConfig   *utils.PluginConfig
-	version        string
-	wasTerminated  bool
-	backupLockFile lockfile.Lockfile
+	backupReport     *utils.Report
+	backupStartTime  time.Time
+	checkpoint       *Checkpoint
+	connectionPool   *dbconn.DBConn
+	globalCluster    *cluster.Cluster
+	globalFPInfo     backup_filepath.FilePathInfo
+	globalTOC        *utils.TOC
+	heapFingerprints map[uint32]string
+	objectCounts     map[string]int
+	pluginConfig     *utils.PluginConfig
+	version          string
+	wasTerminated    bool
+	backupLockFile   lockfile.Lockfile
 
 	/*
 	 * Used for synchronizing DoCleanup.  In DoInit() we increment the group
@@ -57,6 +61,10 @@ func SetConnection(conn *dbconn.DBConn) {
 	connectionPool = conn
 }
 
+func SetCheckpoint(newCheckpoint *Checkpoint) {
+	checkpoint = newCheckpoint
+}
+
 func SetCluster(cluster *cluster.Cluster) {
 	globalCluster = cluster
 }
@@ -1,6 +1,8 @@
 package backup
 
 import (
+	"sort"
+
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
 	"github.com/greenplum-db/gpbackup/backup_history"
@@ -8,12 +10,26 @@ import (
 	"github.com/pkg/errors"
 )
 
+/*
+ * A heap table is only skipped if both backups recorded a fingerprint for it,
+ * as a backup taken without --leaf-partition-data records none.  A table that
+ * was renamed, recreated, or rewritten is never skipped, even if its modcount
+ * happens to match.
+ */
 func FilterTablesForIncremental(lastBackupTOC, currentTOC *utils.TOC, tables []Table) []Table {
 	var filteredTables []Table
 	for _, table := range tables {
+		if tableIdentityChanged(lastBackupTOC, currentTOC, table.FQN()) {
+			filteredTables = append(filteredTables, table)
+			continue
+		}
 		currentAOEntry, isAOTable := currentTOC.IncrementalMetadata.AO[table.FQN()]
 		if !isAOTable {
-			filteredTables = append(filteredTables, table)
+			currentHeapEntry, isHeapTable := currentTOC.IncrementalMetadata.Heap[table.FQN()]
+			previousHeapEntry, wasHeapTable := lastBackupTOC.IncrementalMetadata.Heap[table.FQN()]
+			if !isHeapTable || !wasHeapTable || previousHeapEntry != currentHeapEntry {
+				filteredTables = append(filteredTables, table)
+			}
 			continue
 		}
 		previousAOEntry := lastBackupTOC.IncrementalMetadata.AO[table.FQN()]
@@ -26,6 +42,69 @@ func FilterTablesForIncremental(lastBackupTOC, currentTOC *utils.TOC, tables []T
 	return filteredTables
 }
 
+/*
+ * Backups taken before table identities were recorded have none, in which
+ * case only the modcounts and fingerprints are compared.
+ */
+func tableIdentityChanged(lastBackupTOC, currentTOC *utils.TOC, tableFQN string) bool {
+	currentIdentity, hasIdentity := currentTOC.IncrementalMetadata.Tables[tableFQN]
+	if !hasIdentity || len(lastBackupTOC.IncrementalMetadata.Tables) == 0 {
+		return false
+	}
+	previousIdentity, hadIdentity := lastBackupTOC.IncrementalMetadata.Tables[tableFQN]
+	return !hadIdentity || previousIdentity != currentIdentity
+}
+
+/*
+ * Compares the table identities recorded in the two backups.  A table whose
+ * oid now belongs to a different name was renamed, a name whose oid changed
+ * was dropped and recreated, and a table whose relfilenode changed was
+ * rewritten, e.g. by TRUNCATE or ALTER TABLE.  A name that is no longer
+ * present, and whose oid was not carried over by a rename, was dropped.
+ */
+func GetTableChanges(lastBackupTOC, currentTOC *utils.TOC) []utils.TableChange {
+	previousIdentities := lastBackupTOC.IncrementalMetadata.Tables
+	currentIdentities := currentTOC.IncrementalMetadata.Tables
+	changes := make([]utils.TableChange, 0)
+	if len(previousIdentities) == 0 {
+		return changes
+	}
+	previousFQNsByOid := make(map[uint32]string, len(previousIdentities))
+	for tableFQN, identity := range previousIdentities {
+		previousFQNsByOid[identity.Oid] = tableFQN
+	}
+	renamedFQNs := make(map[string]bool)
+	for _, tableFQN := range sortedIdentityFQNs(currentIdentities) {
+		currentIdentity := currentIdentities[tableFQN]
+		previousIdentity, hadIdentity := previousIdentities[tableFQN]
+		previousFQN, hadOid := previousFQNsByOid[currentIdentity.Oid]
+		switch {
+		case hadIdentity && previousIdentity.Oid != currentIdentity.Oid:
+			changes = append(changes, utils.TableChange{Table: tableFQN, Change: utils.TABLE_RECREATED})
+		case hadIdentity && previousIdentity.RelFileNode != currentIdentity.RelFileNode:
+			changes = append(changes, utils.TableChange{Table: tableFQN, Change: utils.TABLE_REWRITTEN})
+		case !hadIdentity && hadOid:
+			changes = append(changes, utils.TableChange{Table: tableFQN, PreviousName: previousFQN, Change: utils.TABLE_RENAMED})
+			renamedFQNs[previousFQN] = true
+		}
+	}
+	for _, tableFQN := range sortedIdentityFQNs(previousIdentities) {
+		if _, stillExists := currentIdentities[tableFQN]; !stillExists && !renamedFQNs[tableFQN] {
+			changes = append(changes, utils.TableChange{Table: tableFQN, Change: utils.TABLE_DROPPED})
+		}
+	}
+	return changes
+}
+
+func sortedIdentityFQNs(identities map[string]utils.TableIdentity) []string {
+	tableFQNs := make([]string, 0, len(identities))
+	for tableFQN := range identities {
+		tableFQNs = append(tableFQNs, tableFQN)
+	}
+	sort.Strings(tableFQNs)
+	return tableFQNs
+}
+
 func GetTargetBackupTimestamp() string {
 	targetTimestamp := ""
 	if fromTimestamp := MustGetFlagString(utils.FROM_TIMESTAMP); fromTimestamp != "" {
@@ -37,14 +116,24 @@ func GetTargetBackupTimestamp() string {
 	return targetTimestamp
 }
 
+func GetHistoryFilePath() string {
+	historyFilePath, err := backup_history.GetHistoryFilePath(MustGetFlagString(utils.HISTORY_FILE), globalFPInfo.SegDirMap[-1])
+	gplog.FatalOnError(err)
+	return historyFilePath
+}
+
 func GetLatestMatchingBackupTimestamp() string {
 	var history *backup_history.History
 	var latestMatchingBackupHistoryEntry *backup_history.BackupConfig
 	var err error
-	if iohelper.FileExistsAndIsReadable(globalFPInfo.GetBackupHistoryFilePath()) {
-		history, err = backup_history.NewHistory(globalFPInfo.GetBackupHistoryFilePath())
+	if iohelper.FileExistsAndIsReadable(GetHistoryFilePath()) {
+		history, err = backup_history.NewHistory(GetHistoryFilePath())
 		gplog.FatalOnError(err)
-		latestMatchingBackupHistoryEntry = GetLatestMatchingBackupConfig(history, &backupReport.BackupConfig)
+		if MustGetFlagBool(utils.DIFFERENTIAL) {
+			latestMatchingBackupHistoryEntry = GetLatestMatchingFullBackupConfig(history, &backupReport.BackupConfig)
+		} else {
+			latestMatchingBackupHistoryEntry = GetLatestMatchingBackupConfig(history, &backupReport.BackupConfig)
+		}
 	}
 
 	if latestMatchingBackupHistoryEntry == nil {
@@ -55,8 +144,12 @@ func GetLatestMatchingBackupTimestamp() string {
 	return latestMatchingBackupHistoryEntry.Timestamp
 }
 
+/*
+ * A backup can only be the base of an incremental backup if it can be
+ * restored, as the incremental backup is restored with it.
+ */
 func GetLatestMatchingBackupConfig(history *backup_history.History, currentBackupConfig *backup_history.BackupConfig) *backup_history.BackupConfig {
-	for _, backupConfig := range history.BackupConfigs {
+	for _, backupConfig := range history.GetRestorableBackups() {
 		if MatchesIncrementalFlags(&backupConfig, currentBackupConfig) {
 			return &backupConfig
 		}
@@ -65,13 +158,36 @@ func GetLatestMatchingBackupConfig(history *backup_history.History, currentBacku
 	return nil
 }
 
+/*
+ * A differential backup is always based on a full backup, so that restoring
+ * it never needs more than two backups.  Differential backups are also
+ * recorded as incremental, as they are restored from a restore plan.
+ */
+func GetLatestMatchingFullBackupConfig(history *backup_history.History, currentBackupConfig *backup_history.BackupConfig) *backup_history.BackupConfig {
+	fullBackupHistory := &backup_history.History{BackupConfigs: make([]backup_history.BackupConfig, 0)}
+	for _, backupConfig := range history.BackupConfigs {
+		if !backupConfig.Incremental && !backupConfig.Differential {
+			fullBackupHistory.BackupConfigs = append(fullBackupHistory.BackupConfigs, backupConfig)
+		}
+	}
+	return GetLatestMatchingBackupConfig(fullBackupHistory, currentBackupConfig)
+}
+
+/*
+ * A differential backup is never the base of another backup, so that a later
+ * incremental backup does not depend on it.
+ */
 func MatchesIncrementalFlags(backupConfig *backup_history.BackupConfig, currentBackupConfig *backup_history.BackupConfig) bool {
-	return backupConfig.BackupDir == MustGetFlagString(utils.BACKUP_DIR) &&
+	return !backupConfig.Differential &&
+		backupConfig.BackupDir == MustGetFlagString(utils.BACKUP_DIR) &&
+		backupConfig.MatchesCluster(currentBackupConfig.ClusterID) &&
 		backupConfig.DatabaseName == currentBackupConfig.DatabaseName &&
 		backupConfig.LeafPartitionData == MustGetFlagBool(utils.LEAF_PARTITION_DATA) &&
 		backupConfig.Plugin == currentBackupConfig.Plugin &&
 		backupConfig.SingleDataFile == MustGetFlagBool(utils.SINGLE_DATA_FILE) &&
 		backupConfig.Compressed == currentBackupConfig.Compressed &&
+		backupConfig.GetCompressionType() == currentBackupConfig.GetCompressionType() &&
+		backupConfig.EncryptionKeyFingerprint == currentBackupConfig.EncryptionKeyFingerprint &&
 		// Expanding of the include list happens before this now so we must compare again current backup config
 		utils.NewIncludeSet(backupConfig.IncludeRelations).Equals(utils.NewIncludeSet(currentBackupConfig.IncludeRelations)) &&
 		utils.NewIncludeSet(backupConfig.IncludeSchemas).Equals(utils.NewIncludeSet(MustGetFlagStringSlice(utils.INCLUDE_SCHEMA))) &&
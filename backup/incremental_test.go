@@ -27,6 +27,11 @@ var _ = Describe("backup/incremental tests", func() {
 					"public.ao_changed_timestamp": defaultEntry,
 					"public.ao_unchanged":         defaultEntry,
 				},
+				Heap: map[string]utils.HeapEntry{
+					"public.heap_changed_fingerprint": {Fingerprint: "1:100", LastDDLTimestamp: "00000"},
+					"public.heap_changed_timestamp":   {Fingerprint: "1:100", LastDDLTimestamp: "00000"},
+					"public.heap_unchanged":           {Fingerprint: "1:100", LastDDLTimestamp: "00000"},
+				},
 			},
 		}
 
@@ -43,6 +48,12 @@ var _ = Describe("backup/incremental tests", func() {
 					},
 					"public.ao_unchanged": defaultEntry,
 				},
+				Heap: map[string]utils.HeapEntry{
+					"public.heap":                     {Fingerprint: "1:100", LastDDLTimestamp: "00000"},
+					"public.heap_changed_fingerprint": {Fingerprint: "2:300", LastDDLTimestamp: "00000"},
+					"public.heap_changed_timestamp":   {Fingerprint: "1:100", LastDDLTimestamp: "00001"},
+					"public.heap_unchanged":           {Fingerprint: "1:100", LastDDLTimestamp: "00000"},
+				},
 			},
 		}
 
@@ -50,19 +61,37 @@ var _ = Describe("backup/incremental tests", func() {
 		tblAOChangedModcount := backup.Table{Relation: backup.Relation{Schema: "public", Name: "ao_changed_modcount"}}
 		tblAOChangedTS := backup.Table{Relation: backup.Relation{Schema: "public", Name: "ao_changed_timestamp"}}
 		tblAOUnchanged := backup.Table{Relation: backup.Relation{Schema: "public", Name: "ao_unchanged"}}
+		tblHeapChangedFingerprint := backup.Table{Relation: backup.Relation{Schema: "public", Name: "heap_changed_fingerprint"}}
+		tblHeapChangedTS := backup.Table{Relation: backup.Relation{Schema: "public", Name: "heap_changed_timestamp"}}
+		tblHeapUnchanged := backup.Table{Relation: backup.Relation{Schema: "public", Name: "heap_unchanged"}}
 		tables := []backup.Table{
 			tblHeap,
 			tblAOChangedModcount,
 			tblAOChangedTS,
 			tblAOUnchanged,
+			tblHeapChangedFingerprint,
+			tblHeapChangedTS,
+			tblHeapUnchanged,
 		}
 
 		filteredTables := backup.FilterTablesForIncremental(&prevTOC, &currTOC, tables)
 
-		It("Should include the heap table in the filtered list", func() {
+		It("Should include the heap table with no fingerprint in the previous backup", func() {
 			Expect(filteredTables).To(ContainElement(tblHeap))
 		})
 
+		It("Should include the heap table having a modified fingerprint", func() {
+			Expect(filteredTables).To(ContainElement(tblHeapChangedFingerprint))
+		})
+
+		It("Should include the heap table having a modified last DDL timestamp", func() {
+			Expect(filteredTables).To(ContainElement(tblHeapChangedTS))
+		})
+
+		It("Should NOT include the unmodified heap table", func() {
+			Expect(filteredTables).To(Not(ContainElement(tblHeapUnchanged)))
+		})
+
 		It("Should include the AO table having a modified modcount", func() {
 			Expect(filteredTables).To(ContainElement(tblAOChangedModcount))
 		})
@@ -75,6 +104,75 @@ var _ = Describe("backup/incremental tests", func() {
 			Expect(filteredTables).To(Not(ContainElement(tblAOUnchanged)))
 		})
 	})
+	Describe("table identities", func() {
+		aoEntry := utils.AOEntry{Modcount: 1, LastDDLTimestamp: "00000"}
+		prevTOC := utils.TOC{
+			IncrementalMetadata: utils.IncrementalEntries{
+				AO: map[string]utils.AOEntry{
+					"public.ao_unchanged": aoEntry,
+					"public.ao_recreated": aoEntry,
+					"public.ao_rewritten": aoEntry,
+					"public.ao_old_name":  aoEntry,
+					"public.ao_dropped":   aoEntry,
+				},
+				Tables: map[string]utils.TableIdentity{
+					"public.ao_unchanged": {Oid: 1, RelFileNode: 1},
+					"public.ao_recreated": {Oid: 2, RelFileNode: 2},
+					"public.ao_rewritten": {Oid: 3, RelFileNode: 3},
+					"public.ao_old_name":  {Oid: 4, RelFileNode: 4},
+					"public.ao_dropped":   {Oid: 5, RelFileNode: 5},
+				},
+			},
+		}
+		currTOC := utils.TOC{
+			IncrementalMetadata: utils.IncrementalEntries{
+				AO: map[string]utils.AOEntry{
+					"public.ao_unchanged": aoEntry,
+					"public.ao_recreated": aoEntry,
+					"public.ao_rewritten": aoEntry,
+					"public.ao_new_name":  aoEntry,
+				},
+				Tables: map[string]utils.TableIdentity{
+					"public.ao_unchanged": {Oid: 1, RelFileNode: 1},
+					"public.ao_recreated": {Oid: 6, RelFileNode: 6},
+					"public.ao_rewritten": {Oid: 3, RelFileNode: 7},
+					"public.ao_new_name":  {Oid: 4, RelFileNode: 4},
+				},
+			},
+		}
+		tblAOUnchanged := backup.Table{Relation: backup.Relation{Schema: "public", Name: "ao_unchanged"}}
+		tblAORecreated := backup.Table{Relation: backup.Relation{Schema: "public", Name: "ao_recreated"}}
+		tblAORewritten := backup.Table{Relation: backup.Relation{Schema: "public", Name: "ao_rewritten"}}
+		tblAONewName := backup.Table{Relation: backup.Relation{Schema: "public", Name: "ao_new_name"}}
+
+		It("includes tables that were renamed, recreated, or rewritten even if their modcount matches", func() {
+			filteredTables := backup.FilterTablesForIncremental(&prevTOC, &currTOC,
+				[]backup.Table{tblAOUnchanged, tblAORecreated, tblAORewritten, tblAONewName})
+
+			Expect(filteredTables).To(Equal([]backup.Table{tblAORecreated, tblAORewritten, tblAONewName}))
+		})
+		It("compares only modcounts if the previous backup recorded no table identities", func() {
+			prevTOCWithoutIdentities := utils.TOC{IncrementalMetadata: utils.IncrementalEntries{AO: prevTOC.IncrementalMetadata.AO}}
+
+			filteredTables := backup.FilterTablesForIncremental(&prevTOCWithoutIdentities, &currTOC,
+				[]backup.Table{tblAOUnchanged, tblAORecreated, tblAORewritten})
+
+			Expect(filteredTables).To(BeEmpty())
+		})
+		It("records the tables that were renamed, recreated, rewritten, or dropped", func() {
+			changes := backup.GetTableChanges(&prevTOC, &currTOC)
+
+			Expect(changes).To(Equal([]utils.TableChange{
+				{Table: "public.ao_new_name", PreviousName: "public.ao_old_name", Change: utils.TABLE_RENAMED},
+				{Table: "public.ao_recreated", Change: utils.TABLE_RECREATED},
+				{Table: "public.ao_rewritten", Change: utils.TABLE_REWRITTEN},
+				{Table: "public.ao_dropped", Change: utils.TABLE_DROPPED},
+			}))
+		})
+		It("records no changes if the previous backup recorded no table identities", func() {
+			Expect(backup.GetTableChanges(&utils.TOC{}, &currTOC)).To(BeEmpty())
+		})
+	})
 
 	Describe("GetLatestMatchingBackupConfig", func() {
 		history := backup_history.History{BackupConfigs: []backup_history.BackupConfig{
@@ -97,6 +195,53 @@ var _ = Describe("backup/incremental tests", func() {
 
 			Expect(latestBackupHistoryEntry).To(BeNil())
 		})
+		It("should skip backups that failed", func() {
+			historyWithFailure := backup_history.History{BackupConfigs: []backup_history.BackupConfig{
+				{DatabaseName: "test1", Timestamp: "timestamp2", Status: backup_history.BACKUP_STATUS_FAILURE},
+				{DatabaseName: "test1", Timestamp: "timestamp1", Status: backup_history.BACKUP_STATUS_SUCCESS},
+			}}
+			currentBackupConfig := backup_history.BackupConfig{DatabaseName: "test1"}
+
+			latestBackupHistoryEntry := backup.GetLatestMatchingBackupConfig(&historyWithFailure, &currentBackupConfig)
+
+			structmatcher.ExpectStructsToMatch(historyWithFailure.BackupConfigs[1], latestBackupHistoryEntry)
+		})
+		It("should skip backups that were deleted, or that need a deleted backup to be restored", func() {
+			historyWithDeletion := backup_history.History{BackupConfigs: []backup_history.BackupConfig{
+				{DatabaseName: "test1", Timestamp: "timestamp4", RestorePlan: []backup_history.RestorePlanEntry{{Timestamp: "timestamp2"}, {Timestamp: "timestamp4"}}},
+				{DatabaseName: "test1", Timestamp: "timestamp3", Deleted: true},
+				{DatabaseName: "test1", Timestamp: "timestamp2", Deleted: true},
+				{DatabaseName: "test1", Timestamp: "timestamp1"},
+			}}
+			currentBackupConfig := backup_history.BackupConfig{DatabaseName: "test1"}
+
+			latestBackupHistoryEntry := backup.GetLatestMatchingBackupConfig(&historyWithDeletion, &currentBackupConfig)
+
+			structmatcher.ExpectStructsToMatch(historyWithDeletion.BackupConfigs[3], latestBackupHistoryEntry)
+		})
+		It("should skip differential backups", func() {
+			historyWithDifferential := backup_history.History{BackupConfigs: []backup_history.BackupConfig{
+				{DatabaseName: "test1", Timestamp: "timestamp2", Incremental: true, Differential: true},
+				{DatabaseName: "test1", Timestamp: "timestamp1"},
+			}}
+			currentBackupConfig := backup_history.BackupConfig{DatabaseName: "test1"}
+
+			latestBackupHistoryEntry := backup.GetLatestMatchingBackupConfig(&historyWithDifferential, &currentBackupConfig)
+
+			structmatcher.ExpectStructsToMatch(historyWithDifferential.BackupConfigs[1], latestBackupHistoryEntry)
+		})
+		It("should skip backups of another cluster sharing the history file", func() {
+			sharedHistory := backup_history.History{BackupConfigs: []backup_history.BackupConfig{
+				{DatabaseName: "test1", Timestamp: "timestamp3", ClusterID: "otherhost:5432"},
+				{DatabaseName: "test1", Timestamp: "timestamp2", ClusterID: "mdw:5432"},
+				{DatabaseName: "test1", Timestamp: "timestamp1"},
+			}}
+			currentBackupConfig := backup_history.BackupConfig{DatabaseName: "test1", ClusterID: "mdw:5432"}
+
+			latestBackupHistoryEntry := backup.GetLatestMatchingBackupConfig(&sharedHistory, &currentBackupConfig)
+
+			structmatcher.ExpectStructsToMatch(sharedHistory.BackupConfigs[1], latestBackupHistoryEntry)
+		})
 		It("should return nil with an empty history", func() {
 			currentBackupConfig := backup_history.BackupConfig{}
 
@@ -107,6 +252,30 @@ var _ = Describe("backup/incremental tests", func() {
 		})
 	})
 
+	Describe("GetLatestMatchingFullBackupConfig", func() {
+		It("should return the latest matching full backup, skipping incremental backups", func() {
+			history := backup_history.History{BackupConfigs: []backup_history.BackupConfig{
+				{DatabaseName: "test1", Timestamp: "timestamp4", Incremental: true},
+				{DatabaseName: "test1", Timestamp: "timestamp3", Incremental: true},
+				{DatabaseName: "test2", Timestamp: "timestamp2"},
+				{DatabaseName: "test1", Timestamp: "timestamp1"},
+			}}
+			currentBackupConfig := backup_history.BackupConfig{DatabaseName: "test1"}
+
+			latestBackupHistoryEntry := backup.GetLatestMatchingFullBackupConfig(&history, &currentBackupConfig)
+
+			structmatcher.ExpectStructsToMatch(history.BackupConfigs[3], latestBackupHistoryEntry)
+		})
+		It("should return nil when there are only incremental backups", func() {
+			history := backup_history.History{BackupConfigs: []backup_history.BackupConfig{
+				{DatabaseName: "test1", Timestamp: "timestamp2", Incremental: true},
+			}}
+			currentBackupConfig := backup_history.BackupConfig{DatabaseName: "test1"}
+
+			Expect(backup.GetLatestMatchingFullBackupConfig(&history, &currentBackupConfig)).To(BeNil())
+		})
+	})
+
 	Describe("PopulateRestorePlan", func() {
 		testCluster := testutils.SetDefaultSegmentConfiguration()
 		testFPInfo := backup_filepath.NewFilePathInfo(testCluster, "", "ts0",
@@ -0,0 +1,91 @@
+package backup
+
+/*
+ * This file contains functions for recording the size and duration metrics,
+ * and the outcome, of a backup in its configuration file and history entry.
+ */
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/backup_history"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+func startBackupPhase(phase string) {
+	utils.EmitPhaseStart(phase)
+	backupReport.Metrics.StartPhase(phase, operating.System.Now())
+}
+
+func endBackupPhase(phase string) {
+	utils.EmitPhaseEnd(phase)
+	backupReport.Metrics.EndPhase(phase, operating.System.Now())
+}
+
+func RecordDataMetrics(toc *utils.TOC) {
+	backupReport.Metrics.TableCount = len(toc.DataEntries)
+	backupReport.Metrics.TotalRows = 0
+	for _, entry := range toc.DataEntries {
+		backupReport.Metrics.TotalRows += entry.RowsCopied
+	}
+}
+
+/*
+ * The sizes of the files in each segment's backup directory, which are the
+ * compressed (and encrypted) data files along with any segment TOC files.
+ * The metrics are informational, so a segment whose sizes cannot be read is
+ * left out instead of failing the backup.
+ */
+func GatherBackupFileSizesFromSegments() map[int]int64 {
+	remoteOutput := globalCluster.GenerateAndExecuteCommand("Gathering backup file sizes", func(contentID int) string {
+		return fmt.Sprintf(`find %s -type f -name 'gpbackup_*' -exec wc -c {} + | awk '$2 != "total" {sum += $1} END {print sum + 0}'`, globalFPInfo.GetDirForContent(contentID))
+	}, cluster.ON_SEGMENTS)
+
+	segmentBytes := make(map[int]int64, len(remoteOutput.Stdouts))
+	for contentID := range remoteOutput.Stdouts {
+		bytes, err := strconv.ParseInt(strings.TrimSpace(remoteOutput.Stdouts[contentID]), 10, 64)
+		if err != nil {
+			gplog.Warn("Unable to gather backup file sizes for segment %d on host %s", contentID, globalCluster.GetHostForContent(contentID))
+			continue
+		}
+		segmentBytes[contentID] = bytes
+	}
+	return segmentBytes
+}
+
+/*
+ * Failed backups are recorded in the history file as well as successful ones,
+ * so that their metrics and errors are kept; incremental backups are never
+ * based on them.  Failing to write the history file fails the backup, so the
+ * returned error message is the one to report.
+ */
+func RecordBackupOutcome(errMsg string) string {
+	backupReport.Metrics.Finish(backupStartTime, operating.System.Now())
+	backupReport.Status = backup_history.BACKUP_STATUS_SUCCESS
+	backupReport.ErrorMessage = ""
+	if errMsg != "" || gplog.GetErrorCode() != 0 {
+		backupReport.Status = backup_history.BACKUP_STATUS_FAILURE
+		backupReport.ErrorMessage = errMsg
+		if errMsg == "" {
+			backupReport.ErrorMessage = fmt.Sprintf("See log file %s for details.", gplog.GetLogFilePath())
+		}
+	}
+
+	err := backup_history.WriteBackupHistory(GetHistoryFilePath(), &backupReport.BackupConfig)
+	if err != nil {
+		historyErrMsg := fmt.Sprintf("Unable to write backup history file: %v", err)
+		gplog.Error(historyErrMsg)
+		gplog.SetErrorCode(2)
+		if errMsg == "" {
+			errMsg = historyErrMsg
+			backupReport.Status = backup_history.BACKUP_STATUS_FAILURE
+			backupReport.ErrorMessage = errMsg
+		}
+	}
+	return errMsg
+}
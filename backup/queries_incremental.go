@@ -2,6 +2,8 @@ package backup
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
@@ -12,7 +14,7 @@ func GetAOIncrementalMetadata(connectionPool *dbconn.DBConn) map[string]utils.AO
 	gplog.Verbose("Querying table row mod counts")
 	var modCounts = getAllModCounts(connectionPool)
 	gplog.Verbose("Querying last DDL modification timestamp for tables")
-	var lastDDLTimestamps = getLastDDLTimestamps(connectionPool)
+	var lastDDLTimestamps = getLastDDLTimestamps(connectionPool, "'ao', 'co'")
 	aoTableEntries := make(map[string]utils.AOEntry)
 	for aoTableFQN := range modCounts {
 		aoTableEntries[aoTableFQN] = utils.AOEntry{
@@ -24,6 +26,154 @@ func GetAOIncrementalMetadata(connectionPool *dbconn.DBConn) map[string]utils.AO
 	return aoTableEntries
 }
 
+/*
+ * Heap tables have no modification count, so each heap table is given a
+ * fingerprint of its relfilenode and of the number of rows inserted, updated,
+ * and deleted in it on the segments, which the statistics collector counts.
+ * The counts only ever grow, so any change to a table changes its fingerprint
+ * without the table being read.  Resetting the statistics also changes the
+ * fingerprints, so the tables are backed up again.  Tables without a
+ * fingerprint, such as those created after the fingerprints were taken, are
+ * always backed up.
+ */
+func GetHeapIncrementalMetadata(connectionPool *dbconn.DBConn, heapTables []Table, fingerprints map[uint32]string) map[string]utils.HeapEntry {
+	heapTableEntries := make(map[string]utils.HeapEntry)
+	if len(fingerprints) == 0 {
+		return heapTableEntries
+	}
+	gplog.Verbose("Querying last DDL modification timestamp for heap tables")
+	var lastDDLTimestamps = getLastDDLTimestamps(connectionPool, "'h'")
+	for _, table := range heapTables {
+		fingerprint, ok := fingerprints[table.Oid]
+		if !ok {
+			continue
+		}
+		heapTableEntries[table.FQN()] = utils.HeapEntry{
+			Fingerprint:      fingerprint,
+			LastDDLTimestamp: lastDDLTimestamps[table.FQN()],
+		}
+	}
+
+	return heapTableEntries
+}
+
+/*
+ * Records the oid and relfilenode of each table, which let an incremental
+ * backup recognize tables that were renamed, dropped, recreated, or rewritten
+ * since the backup it is based on.
+ */
+func GetTableIdentities(connectionPool *dbconn.DBConn, tables []Table) map[string]utils.TableIdentity {
+	tableOidList := make([]string, 0, len(tables))
+	tableFQNs := make(map[uint32]string, len(tables))
+	for _, table := range tables {
+		if !table.SkipDataBackup() {
+			tableOidList = append(tableOidList, fmt.Sprintf("%d", table.Oid))
+			tableFQNs[table.Oid] = table.FQN()
+		}
+	}
+	identities := make(map[string]utils.TableIdentity, len(tableOidList))
+	if len(tableOidList) == 0 {
+		return identities
+	}
+
+	gplog.Verbose("Querying relfilenodes for tables")
+	query := fmt.Sprintf(`
+	SELECT
+		c.oid,
+		c.relfilenode
+	FROM pg_class c
+	WHERE c.oid IN (%s)`, strings.Join(tableOidList, ","))
+
+	var results []utils.TableIdentity
+	err := connectionPool.Select(&results, query)
+	gplog.FatalOnError(err)
+	for _, result := range results {
+		identities[tableFQNs[result.Oid]] = result
+	}
+	return identities
+}
+
+/*
+ * The statistics counters are not transactional, so the fingerprints must be
+ * taken before the connections begin the transactions whose snapshot the
+ * backup reads.  A change committed in between is then in the backup but not
+ * in the fingerprint, which only makes the next incremental backup back the
+ * table up again, whereas a change counted in the fingerprint but missing from
+ * the backup would never be backed up.  The statistics collector reports the
+ * counts with a short delay, which errs in the same direction.  If
+ * track_counts is off, the counts never change, so no fingerprints are taken
+ * and every heap table is backed up.
+ *
+ * The tables are split among the connections so that the counts of many
+ * tables are queried in parallel, a batch of tables per connection.
+ */
+func GetHeapFingerprints(connectionPool *dbconn.DBConn) map[uint32]string {
+	fingerprints := make(map[uint32]string)
+	if dbconn.MustSelectString(connectionPool, "SELECT current_setting('track_counts') AS string") != "on" {
+		gplog.Warn("track_counts is off, so changes to heap tables cannot be detected and every heap table will be backed up by incremental backups based on this backup")
+		return fingerprints
+	}
+	gplog.Verbose("Querying row modification counts for heap tables")
+	query := fmt.Sprintf(`
+	SELECT
+		c.oid AS string
+	FROM pg_class c
+	JOIN pg_namespace n ON c.relnamespace = n.oid
+	WHERE c.relkind = 'r'
+	AND c.relstorage = 'h'
+	AND %s`, SchemaFilterClause("n"))
+	heapTableOids := dbconn.MustSelectStringSlice(connectionPool, query)
+	oidBatches := make([][]string, connectionPool.NumConns)
+	for i, oid := range heapTableOids {
+		connNum := i % connectionPool.NumConns
+		oidBatches[connNum] = append(oidBatches[connNum], oid)
+	}
+	var fingerprintsMutex sync.Mutex
+	var workerPool sync.WaitGroup
+	var queryErr error
+	for connNum, oidBatch := range oidBatches {
+		if len(oidBatch) == 0 {
+			continue
+		}
+		workerPool.Add(1)
+		go func(whichConn int, oidList string) {
+			defer workerPool.Done()
+			query := fmt.Sprintf(`
+	SELECT
+		c.oid,
+		c.relfilenode || ':' || s.inserted || ':' || s.updated || ':' || s.deleted AS fingerprint
+	FROM pg_class c
+	JOIN (
+		SELECT
+			oid,
+			sum(pg_stat_get_tuples_inserted(oid)) AS inserted,
+			sum(pg_stat_get_tuples_updated(oid)) AS updated,
+			sum(pg_stat_get_tuples_deleted(oid)) AS deleted
+		FROM gp_dist_random('pg_class')
+		WHERE oid IN (%s)
+		GROUP BY oid
+	) s ON c.oid = s.oid`, oidList)
+			results := make([]struct {
+				Oid         uint32
+				Fingerprint string
+			}, 0)
+			err := connectionPool.Select(&results, query, whichConn)
+			fingerprintsMutex.Lock()
+			defer fingerprintsMutex.Unlock()
+			if err != nil {
+				queryErr = err
+				return
+			}
+			for _, result := range results {
+				fingerprints[result.Oid] = result.Fingerprint
+			}
+		}(connNum, strings.Join(oidBatch, ","))
+	}
+	workerPool.Wait()
+	gplog.FatalOnError(queryErr)
+	return fingerprints
+}
+
 func getAllModCounts(connectionPool *dbconn.DBConn) map[string]int64 {
 	var segTableFQNs = getAOSegTableFQNs(connectionPool)
 	modCounts := make(map[string]int64)
@@ -99,7 +249,7 @@ func getModCount(connectionPool *dbconn.DBConn, aosegtablefqn string) int64 {
 	return results[0].Modcount
 }
 
-func getLastDDLTimestamps(connectionPool *dbconn.DBConn) map[string]string {
+func getLastDDLTimestamps(connectionPool *dbconn.DBConn, relStorages string) map[string]string {
 	query := fmt.Sprintf(`
 	SELECT
 		quote_ident(aoschema) || '.' || quote_ident(aorelname) as aotablefqn,
@@ -117,7 +267,7 @@ func getLastDDLTimestamps(connectionPool *dbconn.DBConn) map[string]string {
 			ON
 				c.relnamespace = n.oid
 			WHERE
-				c.relstorage IN ('ao', 'co')
+				c.relstorage IN (%s)
 			AND
 				%s
 		) aotables
@@ -135,7 +285,7 @@ func getLastDDLTimestamps(connectionPool *dbconn.DBConn) map[string]string {
 		) lastop
 	ON
 		aotables.aooid = lastop.objid
-`, relationAndSchemaFilterClause())
+`, relStorages, relationAndSchemaFilterClause())
 
 	var results []struct {
 		AOTableFQN       string
@@ -461,6 +461,44 @@ FROM pg_foreign_table ft JOIN pg_foreign_server fs on ft.ftserver = fs.oid;
 	return resultMap
 }
 
+/*
+ * The size of a partitioned table includes all of its partitions, as they are
+ * all copied out through the parent table unless --leaf-partition-data is used.
+ */
+func GetTableSizes(connectionPool *dbconn.DBConn, tables []Table) map[uint32]int64 {
+	tableOidList := make([]string, 0, len(tables))
+	for _, table := range tables {
+		if !table.SkipDataBackup() {
+			tableOidList = append(tableOidList, fmt.Sprintf("%d", table.Oid))
+		}
+	}
+	sizeMap := make(map[uint32]int64, len(tableOidList))
+	if len(tableOidList) == 0 {
+		return sizeMap
+	}
+
+	query := fmt.Sprintf(`
+SELECT
+	c.oid,
+	(pg_relation_size(c.oid) + coalesce((SELECT sum(pg_relation_size(r.parchildrelid))
+		FROM pg_partition p
+		JOIN pg_partition_rule r ON r.paroid = p.oid
+		WHERE p.parrelid = c.oid), 0))::bigint AS size
+FROM pg_class c
+WHERE c.oid IN (%s)`, strings.Join(tableOidList, ","))
+
+	var results []struct {
+		Oid  uint32
+		Size int64
+	}
+	err := connectionPool.Select(&results, query)
+	gplog.FatalOnError(err)
+	for _, result := range results {
+		sizeMap[result.Oid] = result.Size
+	}
+	return sizeMap
+}
+
 type Dependency struct {
 	Oid              uint32
 	ReferencedObject string
@@ -0,0 +1,56 @@
+package backup
+
+/*
+ * This file contains functions for applying a retention policy after a
+ * successful backup, using gpbackup_manager.
+ */
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+func IsRetentionPolicySet() bool {
+	return MustGetFlagInt(utils.KEEP_FULL) > 0 || MustGetFlagInt(utils.KEEP_DAYS) > 0
+}
+
+func GetApplyRetentionArgs() []string {
+	args := []string{"apply-retention", "--" + utils.DBNAME, MustGetFlagString(utils.DBNAME)}
+	if keepFull := MustGetFlagInt(utils.KEEP_FULL); keepFull > 0 {
+		args = append(args, "--"+utils.KEEP_FULL, fmt.Sprintf("%d", keepFull))
+	}
+	if keepDays := MustGetFlagInt(utils.KEEP_DAYS); keepDays > 0 {
+		args = append(args, "--"+utils.KEEP_DAYS, fmt.Sprintf("%d", keepDays))
+	}
+	for _, flagName := range []string{utils.ENCRYPTION_KEY_FILE, utils.HISTORY_FILE, utils.PLUGIN_CONFIG} {
+		if value := MustGetFlagString(flagName); value != "" {
+			args = append(args, "--"+flagName, value)
+		}
+	}
+	return args
+}
+
+/*
+ * gpbackup_manager is installed alongside gpbackup.  The backup has already
+ * succeeded by the time the policy is applied, so a failure to apply it is
+ * only a warning.  Backups that gpbackup_manager cannot delete are skipped
+ * and listed in its output, which is logged.
+ */
+func ApplyRetentionPolicy() {
+	managerPath := "gpbackup_manager"
+	if executable, err := os.Executable(); err == nil {
+		managerPath = filepath.Join(filepath.Dir(executable), "gpbackup_manager")
+	}
+	args := GetApplyRetentionArgs()
+	gplog.Info("Applying retention policy to backups of database %s", MustGetFlagString(utils.DBNAME))
+	output, err := exec.Command(managerPath, args...).CombinedOutput()
+	gplog.Verbose("gpbackup_manager output:\n%s", output)
+	if err != nil {
+		gplog.Warn("Unable to apply retention policy: %v.  See the gpbackup_manager log file for details.", err)
+	}
+}
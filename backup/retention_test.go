@@ -0,0 +1,34 @@
+package backup_test
+
+import (
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/retention tests", func() {
+	Describe("GetApplyRetentionArgs", func() {
+		It("passes the retention policy for the database to gpbackup_manager", func() {
+			cmdFlags.Set(utils.DBNAME, "testdb")
+			cmdFlags.Set(utils.KEEP_FULL, "2")
+
+			Expect(backup.IsRetentionPolicySet()).To(BeTrue())
+			Expect(backup.GetApplyRetentionArgs()).To(Equal([]string{"apply-retention", "--dbname", "testdb", "--keep-full", "2"}))
+		})
+		It("passes the flags needed to find the history file and delete encrypted and plugin backups", func() {
+			cmdFlags.Set(utils.DBNAME, "testdb")
+			cmdFlags.Set(utils.KEEP_DAYS, "30")
+			cmdFlags.Set(utils.ENCRYPTION_KEY_FILE, "/tmp/backup.key")
+			cmdFlags.Set(utils.HISTORY_FILE, "/shared/gpbackup_history.yaml")
+			cmdFlags.Set(utils.PLUGIN_CONFIG, "/tmp/plugin_config")
+
+			Expect(backup.GetApplyRetentionArgs()).To(Equal([]string{"apply-retention", "--dbname", "testdb", "--keep-days", "30",
+				"--encryption-key-file", "/tmp/backup.key", "--history-file", "/shared/gpbackup_history.yaml", "--plugin-config", "/tmp/plugin_config"}))
+		})
+		It("does not apply a retention policy when none is given", func() {
+			Expect(backup.IsRetentionPolicySet()).To(BeFalse())
+		})
+	})
+})
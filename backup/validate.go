@@ -98,7 +98,7 @@ func DBValidate(conn *dbconn.DBConn, tableList []string, excludeSet bool) {
 
 func ValidateFlagCombinations(flags *pflag.FlagSet) {
 	utils.CheckExclusiveFlags(flags, utils.DEBUG, utils.QUIET, utils.VERBOSE)
-	utils.CheckExclusiveFlags(flags, utils.DATA_ONLY, utils.METADATA_ONLY, utils.INCREMENTAL)
+	utils.CheckExclusiveFlags(flags, utils.DATA_ONLY, utils.METADATA_ONLY, utils.INCREMENTAL, utils.DIFFERENTIAL)
 	utils.CheckExclusiveFlags(flags, utils.INCLUDE_SCHEMA, utils.INCLUDE_RELATION, utils.INCLUDE_RELATION_FILE)
 	utils.CheckExclusiveFlags(flags, utils.EXCLUDE_SCHEMA, utils.INCLUDE_SCHEMA)
 	utils.CheckExclusiveFlags(flags, utils.EXCLUDE_SCHEMA, utils.EXCLUDE_RELATION, utils.INCLUDE_RELATION, utils.EXCLUDE_RELATION_FILE, utils.INCLUDE_RELATION_FILE)
@@ -106,13 +106,19 @@ func ValidateFlagCombinations(flags *pflag.FlagSet) {
 	utils.CheckExclusiveFlags(flags, utils.JOBS, utils.METADATA_ONLY, utils.SINGLE_DATA_FILE)
 	utils.CheckExclusiveFlags(flags, utils.METADATA_ONLY, utils.LEAF_PARTITION_DATA)
 	utils.CheckExclusiveFlags(flags, utils.NO_COMPRESSION, utils.COMPRESSION_LEVEL)
+	utils.CheckExclusiveFlags(flags, utils.NO_COMPRESSION, utils.COMPRESSION_TYPE)
 	utils.CheckExclusiveFlags(flags, utils.PLUGIN_CONFIG, utils.BACKUP_DIR)
-	if MustGetFlagString(utils.FROM_TIMESTAMP) != "" && !MustGetFlagBool(utils.INCREMENTAL) {
-		gplog.Fatal(errors.Errorf("--from-timestamp must be specified with --incremental"), "")
+	utils.CheckExclusiveFlags(flags, utils.RESUME, utils.SINGLE_DATA_FILE)
+	utils.CheckExclusiveFlags(flags, utils.RESUME, utils.METADATA_ONLY)
+	if MustGetFlagString(utils.FROM_TIMESTAMP) != "" && !MustGetFlagBool(utils.INCREMENTAL) && !MustGetFlagBool(utils.DIFFERENTIAL) {
+		gplog.Fatal(errors.Errorf("--from-timestamp must be specified with --incremental or --differential"), "")
 	}
 	if MustGetFlagBool(utils.INCREMENTAL) && !MustGetFlagBool(utils.LEAF_PARTITION_DATA) {
 		gplog.Fatal(errors.Errorf("--leaf-partition-data must be specified with --incremental"), "")
 	}
+	if MustGetFlagBool(utils.DIFFERENTIAL) && !MustGetFlagBool(utils.LEAF_PARTITION_DATA) {
+		gplog.Fatal(errors.Errorf("--leaf-partition-data must be specified with --differential"), "")
+	}
 }
 
 func ValidateFlagValues() {
@@ -120,16 +126,37 @@ func ValidateFlagValues() {
 	gplog.FatalOnError(err)
 	err = utils.ValidateFullPath(MustGetFlagString(utils.PLUGIN_CONFIG))
 	gplog.FatalOnError(err)
-	ValidateCompressionLevel(MustGetFlagInt(utils.COMPRESSION_LEVEL))
+	err = utils.ValidateFullPath(MustGetFlagString(utils.ENCRYPTION_KEY_FILE))
+	gplog.FatalOnError(err)
+	err = utils.ValidateFullPath(MustGetFlagString(utils.PROGRESS_FILE))
+	gplog.FatalOnError(err)
+	err = utils.ValidateFullPath(MustGetFlagString(utils.HISTORY_FILE))
+	gplog.FatalOnError(err)
+	_, err = utils.ParseBandwidth(MustGetFlagString(utils.MAX_BANDWIDTH))
+	gplog.FatalOnError(err)
+	_, err = utils.ParseBandwidth(MustGetFlagString(utils.MAX_HOST_BANDWIDTH))
+	gplog.FatalOnError(err)
+	ValidateCompressionTypeAndLevel(MustGetFlagString(utils.COMPRESSION_TYPE), MustGetFlagInt(utils.COMPRESSION_LEVEL))
 	if MustGetFlagString(utils.FROM_TIMESTAMP) != "" && !backup_filepath.IsValidTimestamp(MustGetFlagString(utils.FROM_TIMESTAMP)) {
 		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.",
 			MustGetFlagString(utils.FROM_TIMESTAMP)), "")
 	}
+	if MustGetFlagString(utils.RESUME) != "" && !backup_filepath.IsValidTimestamp(MustGetFlagString(utils.RESUME)) {
+		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.",
+			MustGetFlagString(utils.RESUME)), "")
+	}
+	if MustGetFlagInt(utils.KEEP_FULL) < 0 || MustGetFlagInt(utils.KEEP_DAYS) < 0 {
+		gplog.Fatal(errors.Errorf("--%s and --%s must not be negative", utils.KEEP_FULL, utils.KEEP_DAYS), "")
+	}
 }
 
-func ValidateCompressionLevel(compressionLevel int) {
-	if compressionLevel < 1 || compressionLevel > 9 {
-		gplog.Fatal(errors.Errorf("Compression level must be between 1 and 9"), "")
+func ValidateCompressionTypeAndLevel(compressionType string, compressionLevel int) {
+	maxLevel, ok := utils.GetMaxCompressionLevel(compressionType)
+	if !ok {
+		gplog.Fatal(errors.Errorf("Unknown compression type '%s'. Valid types are 'gzip', 'lz4', and 'zstd'.", compressionType), "")
+	}
+	if compressionLevel < 1 || compressionLevel > maxLevel {
+		gplog.Fatal(errors.Errorf("Compression level for %s must be between 1 and %d", compressionType, maxLevel), "")
 	}
 }
 
@@ -142,6 +169,18 @@ func ValidateFromTimestamp(fromTimestamp string) {
 	}
 	fromBackupConfig := backup_history.ReadConfigFile(fromTimestampFPInfo.GetConfigFilePath())
 
+	if fromBackupConfig.Failed() {
+		gplog.Fatal(errors.Errorf("The backup with timestamp = %s failed and cannot be used as the base "+
+			"of an incremental backup.", fromTimestampFPInfo.Timestamp), "")
+	}
+	if fromBackupConfig.Differential {
+		gplog.Fatal(errors.Errorf("The backup with timestamp = %s is a differential backup and cannot be used as the base "+
+			"of another backup.", fromTimestampFPInfo.Timestamp), "")
+	}
+	if MustGetFlagBool(utils.DIFFERENTIAL) && fromBackupConfig.Incremental {
+		gplog.Fatal(errors.Errorf("The backup with timestamp = %s is an incremental backup and cannot be used as the base "+
+			"of a differential backup.", fromTimestampFPInfo.Timestamp), "")
+	}
 	if !MatchesIncrementalFlags(fromBackupConfig, &backupReport.BackupConfig) {
 		gplog.Fatal(errors.Errorf("The flags of the backup with timestamp = %s does not match "+
 			"that of the current one. Please refer to the report to view the flags supplied for the"+
@@ -177,20 +177,37 @@ var _ = Describe("backup/validate tests", func() {
 			})
 		})
 	})
-	Describe("ValidateCompressionLevel", func() {
-		It("validates a compression level between 1 and 9", func() {
+	Describe("ValidateCompressionTypeAndLevel", func() {
+		It("validates a gzip compression level between 1 and 9", func() {
 			compressLevel := 5
-			backup.ValidateCompressionLevel(compressLevel)
+			backup.ValidateCompressionTypeAndLevel("gzip", compressLevel)
 		})
 		It("panics if given a compression level < 1", func() {
 			compressLevel := 0
-			defer testhelper.ShouldPanicWithMessage("Compression level must be between 1 and 9")
-			backup.ValidateCompressionLevel(compressLevel)
+			defer testhelper.ShouldPanicWithMessage("Compression level for gzip must be between 1 and 9")
+			backup.ValidateCompressionTypeAndLevel("gzip", compressLevel)
 		})
-		It("panics if given a compression level > 9", func() {
+		It("panics if given a gzip compression level > 9", func() {
 			compressLevel := 11
-			defer testhelper.ShouldPanicWithMessage("Compression level must be between 1 and 9")
-			backup.ValidateCompressionLevel(compressLevel)
+			defer testhelper.ShouldPanicWithMessage("Compression level for gzip must be between 1 and 9")
+			backup.ValidateCompressionTypeAndLevel("gzip", compressLevel)
+		})
+		It("validates a zstd compression level between 1 and 19", func() {
+			compressLevel := 15
+			backup.ValidateCompressionTypeAndLevel("zstd", compressLevel)
+		})
+		It("panics if given a zstd compression level > 19", func() {
+			compressLevel := 20
+			defer testhelper.ShouldPanicWithMessage("Compression level for zstd must be between 1 and 19")
+			backup.ValidateCompressionTypeAndLevel("zstd", compressLevel)
+		})
+		It("validates a lz4 compression level between 1 and 12", func() {
+			compressLevel := 12
+			backup.ValidateCompressionTypeAndLevel("lz4", compressLevel)
+		})
+		It("panics if given an unknown compression type", func() {
+			defer testhelper.ShouldPanicWithMessage("Unknown compression type 'bzip2'. Valid types are 'gzip', 'lz4', and 'zstd'.")
+			backup.ValidateCompressionTypeAndLevel("bzip2", 1)
 		})
 	})
 })
@@ -45,6 +45,12 @@ func InitializeConnectionPool() {
 	InitializeMetadataParams(connectionPool)
 	for connNum := 0; connNum < connectionPool.NumConns; connNum++ {
 		connectionPool.MustExec("SET application_name TO 'gpbackup'", connNum)
+	}
+	// Heap table fingerprints must be taken before the backup snapshot; see GetHeapFingerprints
+	if MustGetFlagBool(utils.LEAF_PARTITION_DATA) && !MustGetFlagBool(utils.METADATA_ONLY) && !MustGetFlagBool(utils.DATA_ONLY) {
+		heapFingerprints = GetHeapFingerprints(connectionPool)
+	}
+	for connNum := 0; connNum < connectionPool.NumConns; connNum++ {
 		connectionPool.MustBegin(connNum)
 		SetSessionGUCs(connNum)
 	}
@@ -66,28 +72,35 @@ func SetSessionGUCs(connNum int) {
 }
 
 func NewBackupConfig(dbName string, dbVersion string, backupVersion string, plugin string, timestamp string, opts options.Options) *backup_history.BackupConfig {
+	compressionType := ""
+	if !MustGetFlagBool(utils.NO_COMPRESSION) {
+		compressionType = MustGetFlagString(utils.COMPRESSION_TYPE)
+	}
 	backupConfig := backup_history.BackupConfig{
-		BackupDir:             MustGetFlagString(utils.BACKUP_DIR),
-		BackupVersion:         backupVersion,
-		Compressed:            !MustGetFlagBool(utils.NO_COMPRESSION),
-		DatabaseName:          dbName,
-		DatabaseVersion:       dbVersion,
-		DataOnly:              MustGetFlagBool(utils.DATA_ONLY),
-		ExcludeRelations:      MustGetFlagStringSlice(utils.EXCLUDE_RELATION),
-		ExcludeSchemaFiltered: len(MustGetFlagStringSlice(utils.EXCLUDE_SCHEMA)) > 0,
-		ExcludeSchemas:        MustGetFlagStringSlice(utils.EXCLUDE_SCHEMA),
-		ExcludeTableFiltered:  len(MustGetFlagStringSlice(utils.EXCLUDE_RELATION)) > 0,
-		IncludeRelations:      opts.GetOriginalIncludedTables(),
-		IncludeSchemaFiltered: len(MustGetFlagStringSlice(utils.INCLUDE_SCHEMA)) > 0,
-		IncludeSchemas:        MustGetFlagStringSlice(utils.INCLUDE_SCHEMA),
-		IncludeTableFiltered:  len(MustGetFlagStringArray(utils.INCLUDE_RELATION)) > 0,
-		Incremental:           MustGetFlagBool(utils.INCREMENTAL),
-		LeafPartitionData:     MustGetFlagBool(utils.LEAF_PARTITION_DATA),
-		MetadataOnly:          MustGetFlagBool(utils.METADATA_ONLY),
-		Plugin:                plugin,
-		SingleDataFile:        MustGetFlagBool(utils.SINGLE_DATA_FILE),
-		Timestamp:             timestamp,
-		WithStatistics:        MustGetFlagBool(utils.WITH_STATS),
+		BackupDir:                MustGetFlagString(utils.BACKUP_DIR),
+		BackupVersion:            backupVersion,
+		Compressed:               !MustGetFlagBool(utils.NO_COMPRESSION),
+		CompressionType:          compressionType,
+		DatabaseName:             dbName,
+		DatabaseVersion:          dbVersion,
+		DataOnly:                 MustGetFlagBool(utils.DATA_ONLY),
+		EncryptionKeyFingerprint: utils.GetEncryptionKeyFingerprint(),
+		ExcludeRelations:         MustGetFlagStringSlice(utils.EXCLUDE_RELATION),
+		ExcludeSchemaFiltered:    len(MustGetFlagStringSlice(utils.EXCLUDE_SCHEMA)) > 0,
+		ExcludeSchemas:           MustGetFlagStringSlice(utils.EXCLUDE_SCHEMA),
+		ExcludeTableFiltered:     len(MustGetFlagStringSlice(utils.EXCLUDE_RELATION)) > 0,
+		IncludeRelations:         opts.GetOriginalIncludedTables(),
+		IncludeSchemaFiltered:    len(MustGetFlagStringSlice(utils.INCLUDE_SCHEMA)) > 0,
+		IncludeSchemas:           MustGetFlagStringSlice(utils.INCLUDE_SCHEMA),
+		IncludeTableFiltered:     len(MustGetFlagStringArray(utils.INCLUDE_RELATION)) > 0,
+		Differential:             MustGetFlagBool(utils.DIFFERENTIAL),
+		Incremental:              MustGetFlagBool(utils.INCREMENTAL) || MustGetFlagBool(utils.DIFFERENTIAL),
+		LeafPartitionData:        MustGetFlagBool(utils.LEAF_PARTITION_DATA),
+		MetadataOnly:             MustGetFlagBool(utils.METADATA_ONLY),
+		Plugin:                   plugin,
+		SingleDataFile:           MustGetFlagBool(utils.SINGLE_DATA_FILE),
+		Timestamp:                timestamp,
+		WithStatistics:           MustGetFlagBool(utils.WITH_STATS),
 	}
 
 	return &backupConfig
@@ -101,6 +114,7 @@ func InitializeBackupReport(opts options.Options) {
 	}
 	config := NewBackupConfig(escapedDBName, connectionPool.Version.VersionString, version,
 		plugin, globalFPInfo.Timestamp, opts)
+	config.ClusterID = backup_history.GetClusterID(globalCluster.GetHostForContent(-1), connectionPool.Port)
 
 	isFilteredBackup := config.IncludeTableFiltered || config.IncludeSchemaFiltered ||
 		config.ExcludeTableFiltered || config.ExcludeSchemaFiltered
@@ -146,6 +160,74 @@ func CreateBackupDirectoriesOnAllHosts() {
 	})
 }
 
+/*
+ * Each COPY in a multiple-data-file backup leaves the checksum of its data
+ * file in a sidecar file next to it; collect those checksums for the TOC and
+ * remove the sidecar files so they are not mistaken for backup files.
+ */
+func GatherDataFileChecksumsFromSegments(tables []Table) map[uint32]map[int]string {
+	extension := utils.GetPipeThroughProgram().Extension
+	remoteOutput := globalCluster.GenerateAndExecuteCommand("Gathering data file checksums", func(contentID int) string {
+		checksumFiles := fmt.Sprintf("%s/*%s", globalFPInfo.GetDirForContent(contentID), checksumFileExtension)
+		// The checksums of a resumed backup that were gathered before it was interrupted are in the checkpoint
+		return fmt.Sprintf("if ls %s > /dev/null 2>&1; then cat %s && rm -f %s; fi", checksumFiles, checksumFiles, checksumFiles)
+	}, cluster.ON_SEGMENTS)
+	globalCluster.CheckClusterError(remoteOutput, "Unable to gather data file checksums", func(contentID int) string {
+		return fmt.Sprintf("Unable to gather data file checksums for segment %d on host %s", contentID, globalCluster.GetHostForContent(contentID))
+	})
+
+	checksumMap := make(map[uint32]map[int]string, len(tables))
+	for contentID := range remoteOutput.Stdouts {
+		filenameToOid := make(map[string]uint32, len(tables))
+		for _, table := range tables {
+			if !table.SkipDataBackup() {
+				filenameToOid[globalFPInfo.GetTableBackupFilePath(contentID, table.Oid, extension, false)] = table.Oid
+			}
+		}
+		for _, line := range strings.Split(remoteOutput.Stdouts[contentID], "\n") {
+			fields := strings.Fields(line) // Format is "[checksum]  [filename]"
+			if len(fields) != 2 {
+				continue
+			}
+			oid, ok := filenameToOid[fields[1]]
+			if !ok {
+				continue
+			}
+			if checksumMap[oid] == nil {
+				checksumMap[oid] = make(map[int]string)
+			}
+			checksumMap[oid][contentID] = fields[0]
+		}
+	}
+	return checksumMap
+}
+
+/*
+ * gpbackup_helper writes the segment TOC once it has written all of the data,
+ * so this waits for each TOC to appear (or for the helper to fail) before
+ * taking its checksum.
+ */
+func GatherSegmentTOCChecksumsFromSegments() map[int]string {
+	remoteOutput := globalCluster.GenerateAndExecuteCommand("Gathering segment TOC checksums", func(contentID int) string {
+		tocFile := globalFPInfo.GetSegmentTOCFilePath(contentID)
+		errorFile := fmt.Sprintf("%s_error", globalFPInfo.GetSegmentPipeFilePath(contentID))
+		return fmt.Sprintf(`while [[ ! -f "%s" && ! -f "%s" ]]; do sleep 1; done; %s "%s"`, tocFile, errorFile, utils.ChecksumProgram, tocFile)
+	}, cluster.ON_SEGMENTS)
+	globalCluster.CheckClusterError(remoteOutput, "Unable to gather segment TOC checksums", func(contentID int) string {
+		return fmt.Sprintf("Unable to gather segment TOC checksum for segment %d on host %s", contentID, globalCluster.GetHostForContent(contentID))
+	})
+
+	checksumMap := make(map[int]string, len(remoteOutput.Stdouts))
+	for contentID := range remoteOutput.Stdouts {
+		fields := strings.Fields(remoteOutput.Stdouts[contentID]) // Format is "[checksum]  [filename]"
+		if len(fields) == 0 {
+			gplog.Fatal(nil, "Unable to read segment TOC checksum for segment %d on host %s", contentID, globalCluster.GetHostForContent(contentID))
+		}
+		checksumMap[contentID] = fields[0]
+	}
+	return checksumMap
+}
+
 /*
  * Metadata retrieval wrapper functions
  */
@@ -620,7 +702,22 @@ func BackupStatistics(statisticsFile *utils.FileWithByteCount, tables []Table) {
 	PrintStatisticsStatements(statisticsFile, globalTOC, tables, attStats, tupleStats)
 }
 
-func BackupIncrementalMetadata() {
+/*
+ * Heap table fingerprints are only recorded for backups that can be the base
+ * of an incremental backup, which must be taken with --leaf-partition-data.
+ */
+func BackupIncrementalMetadata(tables []Table) {
 	aoTableEntries := GetAOIncrementalMetadata(connectionPool)
 	globalTOC.IncrementalMetadata.AO = aoTableEntries
+	globalTOC.IncrementalMetadata.Tables = GetTableIdentities(connectionPool, tables)
+	if !MustGetFlagBool(utils.LEAF_PARTITION_DATA) {
+		return
+	}
+	heapTables := make([]Table, 0)
+	for _, table := range tables {
+		if _, isAOTable := aoTableEntries[table.FQN()]; !isAOTable && !table.SkipDataBackup() {
+			heapTables = append(heapTables, table)
+		}
+	}
+	globalTOC.IncrementalMetadata.Heap = GetHeapIncrementalMetadata(connectionPool, heapTables, heapFingerprints)
 }
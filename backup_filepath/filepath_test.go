@@ -110,6 +110,19 @@ var _ = Describe("filepath tests", func() {
 			Expect(fpInfo.GetTableBackupFilePath(-1, 1234, "", true)).To(Equal("/foo/bar/gpseg-1/backups/20170101/20170101010101/gpbackup_-1_20170101010101"))
 		})
 	})
+	Describe("GetSegmentHelperFilePath", func() {
+		It("returns helper file path for copy command", func() {
+			fpInfo := backup_filepath.NewFilePathInfo(c, "", "20170101010101", "gpseg")
+			fpInfo.PID = 1234
+			Expect(fpInfo.GetSegmentHelperFilePathForCopyCommand("checksums")).To(Equal("<SEG_DATA_DIR>/gpbackup_<SEGID>_20170101010101_checksums_1234"))
+		})
+		It("returns helper file path in the segment data directory, even with a user specified path", func() {
+			c.Segments[0] = cluster.SegConfig{DataDir: segDirOne}
+			fpInfo := backup_filepath.NewFilePathInfo(c, "/foo/bar", "20170101010101", "gpseg")
+			fpInfo.PID = 1234
+			Expect(fpInfo.GetSegmentHelperFilePath(0, "checksums")).To(Equal("/data/gpseg0/gpbackup_0_20170101010101_checksums_1234"))
+		})
+	})
 	Describe("ParseSegPrefix", func() {
 		AfterEach(func() {
 			operating.System.Glob = filepath.Glob
@@ -3,54 +3,171 @@ package backup_history
 //TODO: change package name to conform to Go standards
 
 import (
+	"fmt"
+	"os"
 	"sort"
 	"time"
 
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
 	"github.com/greenplum-db/gp-common-go-libs/operating"
-	"github.com/nightlyone/lockfile"
+	"github.com/greenplum-db/gpbackup/backup_filepath"
+	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 )
 
+const (
+	BACKUP_STATUS_SUCCESS = "Success"
+	BACKUP_STATUS_FAILURE = "Failure"
+)
+
 type RestorePlanEntry struct {
 	Timestamp string
 	TableFQNs []string
 }
 
+type PhaseMetrics struct {
+	Phase           string
+	StartTime       string
+	EndTime         string
+	DurationSeconds float64
+}
+
+/*
+ * Metrics describing what a backup wrote and how long it took, kept for
+ * capacity planning.  SegmentBytes holds the size of the (compressed) backup
+ * files on each segment, keyed by content ID, and is not recorded for backups
+ * that use a plugin.
+ */
+type BackupMetrics struct {
+	StartTime       string
+	EndTime         string
+	DurationSeconds float64
+	TableCount      int
+	TotalRows       int64
+	TotalBytes      int64
+	SegmentBytes    map[int]int64  `yaml:",omitempty"`
+	Phases          []PhaseMetrics `yaml:",omitempty"`
+}
+
 type BackupConfig struct {
-	BackupDir             string
-	BackupVersion         string
-	Compressed            bool
-	DatabaseName          string
-	DatabaseVersion       string
-	DataOnly              bool
-	Deleted               bool
-	ExcludeRelations      []string
-	ExcludeSchemaFiltered bool
-	ExcludeSchemas        []string
-	ExcludeTableFiltered  bool
-	IncludeRelations      []string
-	IncludeSchemaFiltered bool
-	IncludeSchemas        []string
-	IncludeTableFiltered  bool
-	Incremental           bool
-	LeafPartitionData     bool
-	MetadataOnly          bool
-	Plugin                string
-	RestorePlan           []RestorePlanEntry
-	SingleDataFile        bool
-	Timestamp             string
-	WithStatistics        bool
+	BackupDir                string
+	BackupVersion            string
+	ClusterID                string
+	Compressed               bool
+	CompressionType          string
+	DatabaseName             string
+	DatabaseVersion          string
+	DataOnly                 bool
+	Deleted                  bool
+	Differential             bool
+	EncryptionKeyFingerprint string
+	ExcludeRelations         []string
+	ExcludeSchemaFiltered    bool
+	ExcludeSchemas           []string
+	ExcludeTableFiltered     bool
+	IncludeRelations         []string
+	IncludeSchemaFiltered    bool
+	IncludeSchemas           []string
+	IncludeTableFiltered     bool
+	ErrorMessage             string
+	Incremental              bool
+	LeafPartitionData        bool
+	MetadataOnly             bool
+	Metrics                  BackupMetrics
+	Plugin                   string
+	RestorePlan              []RestorePlanEntry
+	SingleDataFile           bool
+	Status                   string
+	Timestamp                string
+	TOCChecksum              string
+	WithStatistics           bool
+}
+
+/*
+ * Backups taken before --compression-type was added do not record a compression
+ * type, but any compressed backup from that time was compressed with gzip.
+ */
+func (backupConfig *BackupConfig) GetCompressionType() string {
+	if backupConfig.Compressed && backupConfig.CompressionType == "" {
+		return "gzip"
+	}
+	return backupConfig.CompressionType
+}
+
+/*
+ * A cluster is identified by the host and port of its master, so that the
+ * backups of several clusters sharing a --history-file can be told apart.
+ */
+func GetClusterID(masterHost string, masterPort int) string {
+	return fmt.Sprintf("%s:%d", masterHost, masterPort)
+}
+
+/*
+ * Backups taken before cluster IDs were recorded were written to the history
+ * file in the master data directory of their own cluster, so they match it.
+ */
+func (backupConfig *BackupConfig) MatchesCluster(clusterID string) bool {
+	return backupConfig.ClusterID == "" || backupConfig.ClusterID == clusterID
+}
+
+/*
+ * Backups taken before failed backups were recorded have no status, but only
+ * successful backups were recorded at that time.
+ */
+func (backupConfig *BackupConfig) Failed() bool {
+	return backupConfig.Status == BACKUP_STATUS_FAILURE
+}
+
+// Milliseconds are kept so that the durations of short phases can be computed
+const metricsTimeFormat = "2006-01-02 15:04:05.000"
+
+func (metrics *BackupMetrics) StartPhase(phase string, startTime time.Time) {
+	metrics.Phases = append(metrics.Phases, PhaseMetrics{Phase: phase, StartTime: startTime.Format(metricsTimeFormat)})
+}
+
+func (metrics *BackupMetrics) EndPhase(phase string, endTime time.Time) {
+	for i := len(metrics.Phases) - 1; i >= 0; i-- {
+		if metrics.Phases[i].Phase == phase {
+			startTime, _ := time.ParseInLocation(metricsTimeFormat, metrics.Phases[i].StartTime, endTime.Location())
+			metrics.Phases[i].EndTime = endTime.Format(metricsTimeFormat)
+			metrics.Phases[i].DurationSeconds = endTime.Sub(startTime).Seconds()
+			return
+		}
+	}
+}
+
+func (metrics *BackupMetrics) Finish(startTime time.Time, endTime time.Time) {
+	metrics.StartTime = startTime.Format(metricsTimeFormat)
+	metrics.EndTime = endTime.Format(metricsTimeFormat)
+	metrics.DurationSeconds = endTime.Sub(startTime).Seconds()
+}
+
+func (metrics *BackupMetrics) SetSegmentBytes(segmentBytes map[int]int64) {
+	metrics.SegmentBytes = segmentBytes
+	metrics.TotalBytes = 0
+	for _, bytes := range segmentBytes {
+		metrics.TotalBytes += bytes
+	}
 }
 
 func ReadConfigFile(filename string) *BackupConfig {
+	config, err := LoadConfigFile(filename)
+	gplog.FatalOnError(err)
+	return config
+}
+
+func LoadConfigFile(filename string) (*BackupConfig, error) {
 	config := &BackupConfig{}
 	contents, err := operating.System.ReadFile(filename)
-	gplog.FatalOnError(err)
+	if err != nil {
+		return nil, err
+	}
 	err = yaml.Unmarshal(contents, config)
-	gplog.FatalOnError(err)
-	return config
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
 }
 
 func WriteConfigFile(config *BackupConfig, configFilename string) {
@@ -66,6 +183,25 @@ type History struct {
 	BackupConfigs []BackupConfig
 }
 
+/*
+ * The history file is the --history-file given, if any, and otherwise is in
+ * the master data directory, even when the backup files are written to a
+ * --backup-dir.  An empty masterDataDir is looked up in MASTER_DATA_DIRECTORY.
+ */
+func GetHistoryFilePath(historyFileFlag string, masterDataDir string) (string, error) {
+	if historyFileFlag != "" {
+		return historyFileFlag, nil
+	}
+	if masterDataDir == "" {
+		masterDataDir = operating.System.Getenv("MASTER_DATA_DIRECTORY")
+	}
+	if masterDataDir == "" {
+		return "", errors.New("MASTER_DATA_DIRECTORY must be set to locate the backup history file")
+	}
+	fpInfo := backup_filepath.FilePathInfo{SegDirMap: map[int]string{-1: masterDataDir}}
+	return fpInfo.GetBackupHistoryFilePath(), nil
+}
+
 func NewHistory(filename string) (*History, error) {
 	history := &History{BackupConfigs: make([]BackupConfig, 0)}
 	contents, err := operating.System.ReadFile(filename)
@@ -80,15 +216,110 @@ func NewHistory(filename string) (*History, error) {
 	return history, nil
 }
 
+/*
+ * A backup that is resumed after failing is recorded again under the same
+ * timestamp, so its new entry replaces the old one.
+ */
 func (history *History) AddBackupConfig(backupConfig *BackupConfig) {
+	for i := range history.BackupConfigs {
+		if history.BackupConfigs[i].Timestamp == backupConfig.Timestamp {
+			history.BackupConfigs[i] = *backupConfig
+			return
+		}
+	}
 	history.BackupConfigs = append(history.BackupConfigs, *backupConfig)
 	sort.Slice(history.BackupConfigs, func(i, j int) bool {
 		return history.BackupConfigs[i].Timestamp > history.BackupConfigs[j].Timestamp
 	})
 }
 
+func (history *History) FindBackupConfig(timestamp string) *BackupConfig {
+	for i := range history.BackupConfigs {
+		if history.BackupConfigs[i].Timestamp == timestamp {
+			return &history.BackupConfigs[i]
+		}
+	}
+	return nil
+}
+
+/*
+ * Returns the timestamps of the backups, other than the given one, that need
+ * the given backup to be restored because it is in their restore plan.
+ * Deleted and failed backups cannot be restored, so they need nothing.
+ */
+func (history *History) GetDependentBackups(timestamp string) []string {
+	dependents := make([]string, 0)
+	for _, backupConfig := range history.BackupConfigs {
+		if backupConfig.Timestamp == timestamp || backupConfig.Deleted || backupConfig.Failed() {
+			continue
+		}
+		for _, entry := range backupConfig.RestorePlan {
+			if entry.Timestamp == timestamp {
+				dependents = append(dependents, backupConfig.Timestamp)
+				break
+			}
+		}
+	}
+	return dependents
+}
+
+/*
+ * Returns the backups that can be restored, newest first: those that, along
+ * with every backup in their restore plan, still exist and did not fail.
+ */
+func (history *History) GetRestorableBackups() []BackupConfig {
+	unrestorableTimestamps := make(map[string]bool)
+	for _, backupConfig := range history.BackupConfigs {
+		if backupConfig.Deleted || backupConfig.Failed() {
+			unrestorableTimestamps[backupConfig.Timestamp] = true
+		}
+	}
+	restorableBackups := make([]BackupConfig, 0)
+	for _, backupConfig := range history.BackupConfigs {
+		isRestorable := !unrestorableTimestamps[backupConfig.Timestamp]
+		for _, entry := range backupConfig.RestorePlan {
+			if unrestorableTimestamps[entry.Timestamp] {
+				isRestorable = false
+				break
+			}
+		}
+		if isRestorable {
+			restorableBackups = append(restorableBackups, backupConfig)
+		}
+	}
+	return restorableBackups
+}
+
+/*
+ * The history file is read again while it is locked, so that entries written
+ * by a backup that finished in the meantime are not lost.
+ */
+func MarkBackupDeleted(historyFilePath string, timestamp string) error {
+	lock, err := lockHistoryFile(historyFilePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = lock.Unlock()
+	}()
+
+	history, err := NewHistory(historyFilePath)
+	if err != nil {
+		return err
+	}
+	backupConfig := history.FindBackupConfig(timestamp)
+	if backupConfig == nil {
+		return errors.Errorf("Backup %s was not found in history file %s", timestamp, historyFilePath)
+	}
+	backupConfig.Deleted = true
+	return history.WriteToFileAndMakeReadOnly(historyFilePath)
+}
+
 func WriteBackupHistory(historyFilePath string, currentBackupConfig *BackupConfig) error {
-	lock := lockHistoryFile()
+	lock, err := lockHistoryFile(historyFilePath)
+	if err != nil {
+		return err
+	}
 	defer func() {
 		_ = lock.Unlock()
 	}()
@@ -96,7 +327,6 @@ func WriteBackupHistory(historyFilePath string, currentBackupConfig *BackupConfi
 	var history *History
 
 	if iohelper.FileExistsAndIsReadable(historyFilePath) {
-		var err error
 		history, err = NewHistory(historyFilePath)
 		if err != nil {
 			return err
@@ -112,49 +342,49 @@ func WriteBackupHistory(historyFilePath string, currentBackupConfig *BackupConfi
 }
 
 func (history *History) RewriteHistoryFile(historyFilePath string) error {
-	lock := lockHistoryFile()
+	lock, err := lockHistoryFile(historyFilePath)
+	if err != nil {
+		return err
+	}
 	defer func() {
 		_ = lock.Unlock()
 	}()
 
-	err := history.WriteToFileAndMakeReadOnly(historyFilePath)
-	return err
-}
-
-func lockHistoryFile() lockfile.Lockfile {
-	lock, err := lockfile.New("/tmp/gpbackup_history.yaml.lck")
-	gplog.FatalOnError(err)
-	err = lock.TryLock()
-	for err != nil {
-		time.Sleep(50 * time.Millisecond)
-		err = lock.TryLock()
-	}
-	return lock
+	return history.WriteToFileAndMakeReadOnly(historyFilePath)
 }
 
+/*
+ * The history is written to a temporary file next to the history file and
+ * then renamed over it, so that a crash while writing cannot leave the history
+ * file truncated.
+ */
 func (history *History) WriteToFileAndMakeReadOnly(filename string) error {
-	_, err := operating.System.Stat(filename)
-	fileExists := (err == nil)
-	if fileExists {
-		err = operating.System.Chmod(filename, 0644)
-		if err != nil {
-			return err
-		}
+	historyFileContents, err := yaml.Marshal(history)
+	if err != nil {
+		return err
 	}
-	var historyFileContents []byte
-	historyFileContents, err = yaml.Marshal(history)
+	tempFilename := fmt.Sprintf("%s.%d.tmp", filename, os.Getpid())
+	tempFile, err := os.OpenFile(tempFilename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
 	if err != nil {
 		return err
 	}
-	historyFile := iohelper.MustOpenFileForWriting(filename)
-	_, err = historyFile.Write(historyFileContents)
+	defer func() {
+		_ = os.Remove(tempFilename)
+	}()
+	_, err = tempFile.Write(historyFileContents)
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
 	if err != nil {
 		return err
 	}
-	err = operating.System.Chmod(filename, 0444)
+	err = operating.System.Chmod(tempFilename, 0444)
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return os.Rename(tempFilename, filename)
 }
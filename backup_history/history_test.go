@@ -4,6 +4,8 @@ import (
 	"errors"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
 	"github.com/greenplum-db/gp-common-go-libs/operating"
@@ -87,6 +89,19 @@ var _ bool = Describe("backup/history tests", func() {
 			Expect(err).ToNot(HaveOccurred())
 			structmatcher.ExpectStructsToMatch(&historyWithEntries, resultHistory)
 		})
+		It("replaces the file without leaving a temporary file behind", func() {
+			err := ioutil.WriteFile(historyFilePath, []byte("old contents"), 0444)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = historyWithEntries.WriteToFileAndMakeReadOnly(historyFilePath)
+			Expect(err).ToNot(HaveOccurred())
+
+			tempFiles, _ := filepath.Glob(historyFilePath + ".*.tmp")
+			Expect(tempFiles).To(BeEmpty())
+			resultHistory, err := backup_history.NewHistory(historyFilePath)
+			Expect(err).ToNot(HaveOccurred())
+			structmatcher.ExpectStructsToMatch(&historyWithEntries, resultHistory)
+		})
 		It("writes file when file exists and is readonly ", func() {
 			err := ioutil.WriteFile(historyFilePath, []byte{}, 0444)
 			Expect(err).ToNot(HaveOccurred())
@@ -99,6 +114,26 @@ var _ bool = Describe("backup/history tests", func() {
 			structmatcher.ExpectStructsToMatch(&historyWithEntries, resultHistory)
 		})
 	})
+	Describe("GetHistoryFilePath", func() {
+		AfterEach(func() {
+			operating.System = operating.InitializeSystemFunctions()
+		})
+		It("uses the --history-file path if one is given", func() {
+			Expect(backup_history.GetHistoryFilePath("/shared/history.yaml", "/data/master/gpseg-1")).To(Equal("/shared/history.yaml"))
+		})
+		It("defaults to the history file in the given master data directory", func() {
+			Expect(backup_history.GetHistoryFilePath("", "/data/master/gpseg-1")).To(Equal("/data/master/gpseg-1/gpbackup_history.yaml"))
+		})
+		It("looks up the master data directory if none is given", func() {
+			operating.System.Getenv = func(key string) string { return "/data/master/gpseg-1" }
+			Expect(backup_history.GetHistoryFilePath("", "")).To(Equal("/data/master/gpseg-1/gpbackup_history.yaml"))
+		})
+		It("returns an error if the master data directory is not set", func() {
+			operating.System.Getenv = func(key string) string { return "" }
+			_, err := backup_history.GetHistoryFilePath("", "")
+			Expect(err).To(MatchError("MASTER_DATA_DIRECTORY must be set to locate the backup history file"))
+		})
+	})
 	Describe("NewHistory", func() {
 		It("creates a history object with entries from the file when history file exists", func() {
 			historyWithEntries := backup_history.History{
@@ -161,6 +196,79 @@ var _ bool = Describe("backup/history tests", func() {
 			}
 			structmatcher.ExpectStructsToMatch(&expectedHistory, &testHistory)
 		})
+		It("replaces the entry of a backup that is recorded again", func() {
+			testHistory := backup_history.History{
+				BackupConfigs: []backup_history.BackupConfig{testConfig3, testConfig1},
+			}
+			failedConfig := testConfig1
+			failedConfig.Status = backup_history.BACKUP_STATUS_FAILURE
+			testHistory.AddBackupConfig(&failedConfig)
+			resumedConfig := testConfig1
+			resumedConfig.Status = backup_history.BACKUP_STATUS_SUCCESS
+
+			testHistory.AddBackupConfig(&resumedConfig)
+
+			Expect(testHistory.BackupConfigs).To(HaveLen(2))
+			Expect(testHistory.BackupConfigs[1].Status).To(Equal(backup_history.BACKUP_STATUS_SUCCESS))
+		})
+	})
+	Describe("GetDependentBackups", func() {
+		It("returns the restorable backups whose restore plans include the backup", func() {
+			testHistory := backup_history.History{BackupConfigs: []backup_history.BackupConfig{
+				{Timestamp: "timestamp4", RestorePlan: []backup_history.RestorePlanEntry{{Timestamp: "timestamp1"}, {Timestamp: "timestamp4"}}},
+				{Timestamp: "timestamp3", Deleted: true, RestorePlan: []backup_history.RestorePlanEntry{{Timestamp: "timestamp1"}, {Timestamp: "timestamp3"}}},
+				{Timestamp: "timestamp2", Status: backup_history.BACKUP_STATUS_FAILURE, RestorePlan: []backup_history.RestorePlanEntry{{Timestamp: "timestamp1"}, {Timestamp: "timestamp2"}}},
+				{Timestamp: "timestamp1", RestorePlan: []backup_history.RestorePlanEntry{{Timestamp: "timestamp1"}}},
+			}}
+
+			Expect(testHistory.GetDependentBackups("timestamp1")).To(Equal([]string{"timestamp4"}))
+			Expect(testHistory.GetDependentBackups("timestamp4")).To(BeEmpty())
+		})
+	})
+	Describe("GetRestorableBackups", func() {
+		It("returns the backups that, with every backup in their restore plans, were not deleted and did not fail", func() {
+			testHistory := backup_history.History{BackupConfigs: []backup_history.BackupConfig{
+				{Timestamp: "timestamp4", RestorePlan: []backup_history.RestorePlanEntry{{Timestamp: "timestamp2"}, {Timestamp: "timestamp4"}}},
+				{Timestamp: "timestamp3", RestorePlan: []backup_history.RestorePlanEntry{{Timestamp: "timestamp1"}, {Timestamp: "timestamp3"}}},
+				{Timestamp: "timestamp2", Status: backup_history.BACKUP_STATUS_FAILURE},
+				{Timestamp: "timestamp1", RestorePlan: []backup_history.RestorePlanEntry{{Timestamp: "timestamp1"}}},
+				{Timestamp: "timestamp0", Deleted: true},
+			}}
+
+			restorableBackups := testHistory.GetRestorableBackups()
+
+			Expect(restorableBackups).To(HaveLen(2))
+			Expect(restorableBackups[0].Timestamp).To(Equal("timestamp3"))
+			Expect(restorableBackups[1].Timestamp).To(Equal("timestamp1"))
+		})
+	})
+	Describe("BackupMetrics", func() {
+		startTime := time.Date(2017, 1, 1, 1, 1, 1, 0, time.Local)
+		It("records the start, end, and duration of each phase", func() {
+			metrics := backup_history.BackupMetrics{}
+			metrics.StartPhase("predata", startTime)
+			metrics.EndPhase("predata", startTime.Add(1500*time.Millisecond))
+			metrics.StartPhase("data", startTime.Add(2*time.Second))
+
+			Expect(metrics.Phases).To(Equal([]backup_history.PhaseMetrics{
+				{Phase: "predata", StartTime: "2017-01-01 01:01:01.000", EndTime: "2017-01-01 01:01:02.500", DurationSeconds: 1.5},
+				{Phase: "data", StartTime: "2017-01-01 01:01:03.000"},
+			}))
+		})
+		It("records the total duration of the backup", func() {
+			metrics := backup_history.BackupMetrics{}
+			metrics.Finish(startTime, startTime.Add(time.Minute))
+
+			Expect(metrics.StartTime).To(Equal("2017-01-01 01:01:01.000"))
+			Expect(metrics.EndTime).To(Equal("2017-01-01 01:02:01.000"))
+			Expect(metrics.DurationSeconds).To(Equal(float64(60)))
+		})
+		It("totals the bytes written to each segment", func() {
+			metrics := backup_history.BackupMetrics{}
+			metrics.SetSegmentBytes(map[int]int64{0: 1024, 1: 2048})
+
+			Expect(metrics.TotalBytes).To(Equal(int64(3072)))
+		})
 	})
 	Describe("WriteBackupHistory", func() {
 		AfterEach(func() {
@@ -196,5 +304,33 @@ var _ bool = Describe("backup/history tests", func() {
 			structmatcher.ExpectStructsToMatch(&expectedHistory, resultHistory)
 			Expect(testLogfile).To(gbytes.Say("No existing backups found. Creating new backup history file."))
 		})
+		It("marks a backup deleted", func() {
+			os.Remove(historyFilePath)
+			Expect(backup_history.WriteBackupHistory(historyFilePath, &testConfig1)).To(Succeed())
+			Expect(backup_history.WriteBackupHistory(historyFilePath, &testConfig2)).To(Succeed())
+
+			Expect(backup_history.MarkBackupDeleted(historyFilePath, "timestamp1")).To(Succeed())
+
+			resultHistory, err := backup_history.NewHistory(historyFilePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resultHistory.FindBackupConfig("timestamp1").Deleted).To(BeTrue())
+			Expect(resultHistory.FindBackupConfig("timestamp2").Deleted).To(BeFalse())
+		})
+		It("records the status, error, and metrics of a failed backup", func() {
+			os.Remove(historyFilePath)
+			failedConfig := testConfig3
+			failedConfig.Status = backup_history.BACKUP_STATUS_FAILURE
+			failedConfig.ErrorMessage = "some error"
+			failedConfig.Metrics = backup_history.BackupMetrics{TableCount: 2, TotalRows: 10, TotalBytes: 1024, SegmentBytes: map[int]int64{0: 1024}}
+			err := backup_history.WriteBackupHistory(historyFilePath, &failedConfig)
+			Expect(err).ToNot(HaveOccurred())
+
+			resultHistory, err := backup_history.NewHistory(historyFilePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resultHistory.BackupConfigs).To(HaveLen(1))
+			Expect(resultHistory.BackupConfigs[0].Failed()).To(BeTrue())
+			Expect(resultHistory.BackupConfigs[0].ErrorMessage).To(Equal("some error"))
+			Expect(resultHistory.BackupConfigs[0].Metrics).To(Equal(failedConfig.Metrics))
+		})
 	})
 })
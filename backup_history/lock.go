@@ -0,0 +1,186 @@
+package backup_history
+
+/*
+ * This file contains functions for the advisory lock that serializes writes
+ * to a backup history file.
+ */
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/pkg/errors"
+)
+
+/*
+ * A history file is only locked for as long as it takes to read and rewrite
+ * it, so a lock held by another host for longer than this was left behind by
+ * a process that died.
+ */
+var HistoryLockStaleAge = 5 * time.Minute
+
+/*
+ * The lock is a file next to the history file recording the host and process
+ * that hold it, so that the lock works for every gpbackup process that can
+ * reach the history file, including those on other hosts sharing its storage.
+ * The owner token also holds a random nonce, so that a process only ever
+ * removes the lock that it took itself.
+ */
+type HistoryLock struct {
+	Path  string
+	Token string
+}
+
+func GetHistoryLockFilePath(historyFilePath string) string {
+	return historyFilePath + ".lck"
+}
+
+func (lock *HistoryLock) Unlock() error {
+	contents, err := ioutil.ReadFile(lock.Path)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(contents)) != lock.Token {
+		return errors.Errorf("Lock file %s is no longer held by this process", lock.Path)
+	}
+	return os.Remove(lock.Path)
+}
+
+/*
+ * Returns a nil lock if the history file is locked by another live process.
+ * The lock file is written in full under a name of its own and then linked
+ * into place, which fails if the history file is already locked, so a lock
+ * file is never seen without its owner.  A stale lock, held by a process on
+ * this host that is no longer running or by a process on another host for
+ * longer than HistoryLockStaleAge, is moved aside and the history file is
+ * locked in its place.
+ */
+func TryLockHistoryFile(historyFilePath string) (*HistoryLock, error) {
+	lockPath := GetHistoryLockFilePath(historyFilePath)
+	hostname, _ := operating.System.Hostname()
+	nonceBytes := make([]byte, 8)
+	_, err := rand.Read(nonceBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot generate lock owner token")
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	lock := &HistoryLock{Path: lockPath, Token: fmt.Sprintf("%s %d %s", hostname, os.Getpid(), nonce)}
+
+	newLockPath := fmt.Sprintf("%s.%s", lockPath, nonce)
+	err = ioutil.WriteFile(newLockPath, []byte(lock.Token+"\n"), 0644)
+	if err != nil {
+		_ = os.Remove(newLockPath)
+		return nil, errors.Wrapf(err, "Cannot write lock file %s", newLockPath)
+	}
+	defer func() {
+		_ = os.Remove(newLockPath)
+	}()
+	for {
+		err = os.Link(newLockPath, lockPath)
+		if err == nil {
+			return lock, nil
+		}
+		if !os.IsExist(err) {
+			return nil, errors.Wrapf(err, "Cannot create lock file %s", lockPath)
+		}
+
+		contents, owner, isStale, err := readHistoryLockOwner(lockPath, hostname)
+		if os.IsNotExist(err) {
+			// The lock was released while we were reading it
+			continue
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "Cannot read lock file %s", lockPath)
+		}
+		if !isStale {
+			return nil, nil
+		}
+		gplog.Warn("Removing stale lock on history file %s held by %s", historyFilePath, owner)
+		err = moveStaleLockAside(lockPath, contents, nonce)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Cannot remove stale lock file %s", lockPath)
+		}
+	}
+}
+
+/*
+ * Of the processes that find the same stale lock, only one can rename it
+ * aside.  If the lock file that was renamed is not the stale one, another
+ * process has locked the history file in the meantime, so its lock is put
+ * back.
+ */
+func moveStaleLockAside(lockPath string, staleContents string, nonce string) error {
+	stalePath := fmt.Sprintf("%s.%s.stale", lockPath, nonce)
+	err := os.Rename(lockPath, stalePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(stalePath)
+	}()
+	contents, err := ioutil.ReadFile(stalePath)
+	if err != nil {
+		return err
+	}
+	if string(contents) != staleContents {
+		err = os.Link(stalePath, lockPath)
+		if err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func readHistoryLockOwner(lockPath string, hostname string) (string, string, bool, error) {
+	fileInfo, err := os.Stat(lockPath)
+	if err != nil {
+		return "", "", false, err
+	}
+	contents, err := ioutil.ReadFile(lockPath)
+	if err != nil {
+		return "", "", false, err
+	}
+	fields := strings.Fields(string(contents))
+	if len(fields) < 2 {
+		return string(contents), "an unknown process", time.Since(fileInfo.ModTime()) > HistoryLockStaleAge, nil
+	}
+	lockHost := fields[0]
+	lockPid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return string(contents), "an unknown process", time.Since(fileInfo.ModTime()) > HistoryLockStaleAge, nil
+	}
+	if lockHost == hostname && lockPid > 0 {
+		return string(contents), fmt.Sprintf("process %d", lockPid), !isProcessRunning(lockPid), nil
+	}
+	return string(contents), fmt.Sprintf("process %d on host %s", lockPid, lockHost), time.Since(fileInfo.ModTime()) > HistoryLockStaleAge, nil
+}
+
+func isProcessRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+func lockHistoryFile(historyFilePath string) (*HistoryLock, error) {
+	loggedWait := false
+	for {
+		lock, err := TryLockHistoryFile(historyFilePath)
+		if err != nil || lock != nil {
+			return lock, err
+		}
+		if !loggedWait {
+			gplog.Verbose("Waiting for lock on history file %s", historyFilePath)
+			loggedWait = true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,87 @@
+package backup_history_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/greenplum-db/gpbackup/backup_history"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("backup_history/lock tests", func() {
+	var historyDir, historyFilePath, lockFilePath string
+	var hostname string
+	BeforeEach(func() {
+		historyDir, _ = ioutil.TempDir("", "history")
+		historyFilePath = path.Join(historyDir, "gpbackup_history.yaml")
+		lockFilePath = backup_history.GetHistoryLockFilePath(historyFilePath)
+		hostname, _ = os.Hostname()
+	})
+	AfterEach(func() {
+		_ = os.RemoveAll(historyDir)
+	})
+	writeLockFile := func(contents string, age time.Duration) {
+		Expect(ioutil.WriteFile(lockFilePath, []byte(contents), 0644)).To(Succeed())
+		modTime := time.Now().Add(-age)
+		Expect(os.Chtimes(lockFilePath, modTime, modTime)).To(Succeed())
+	}
+	Describe("TryLockHistoryFile", func() {
+		It("creates a lock file next to the history file recording the lock owner", func() {
+			lock, err := backup_history.TryLockHistoryFile(historyFilePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lock.Path).To(Equal(historyFilePath + ".lck"))
+			contents, _ := ioutil.ReadFile(lockFilePath)
+			Expect(string(contents)).To(Equal(lock.Token + "\n"))
+			Expect(lock.Token).To(MatchRegexp(fmt.Sprintf("^%s %d [0-9a-f]{16}$", hostname, os.Getpid())))
+
+			Expect(lock.Unlock()).To(Succeed())
+			Expect(lockFilePath).ToNot(BeAnExistingFile())
+			files, _ := ioutil.ReadDir(historyDir)
+			Expect(files).To(BeEmpty())
+		})
+		It("does not remove a lock that another process has taken over", func() {
+			lock, _ := backup_history.TryLockHistoryFile(historyFilePath)
+			writeLockFile("otherhost 1234 0123456789abcdef\n", 0)
+
+			Expect(lock.Unlock()).To(MatchError(fmt.Sprintf("Lock file %s is no longer held by this process", lockFilePath)))
+			Expect(lockFilePath).To(BeAnExistingFile())
+		})
+		It("does not lock a history file locked by a running process", func() {
+			writeLockFile(fmt.Sprintf("%s %d\n", hostname, os.Getppid()), time.Hour)
+
+			lock, err := backup_history.TryLockHistoryFile(historyFilePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lock).To(BeNil())
+		})
+		It("replaces a lock held by a process on this host that is no longer running", func() {
+			writeLockFile(fmt.Sprintf("%s %d\n", hostname, 1<<30), 0)
+
+			lock, err := backup_history.TryLockHistoryFile(historyFilePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lock).ToNot(BeNil())
+			Expect(testLogfile).To(gbytes.Say(fmt.Sprintf("Removing stale lock on history file %s held by process %d", historyFilePath, 1<<30)))
+		})
+		It("does not lock a history file recently locked by another host", func() {
+			writeLockFile("otherhost 1234\n", time.Second)
+
+			lock, err := backup_history.TryLockHistoryFile(historyFilePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lock).To(BeNil())
+		})
+		It("replaces a lock held by another host for longer than the stale age", func() {
+			writeLockFile("otherhost 1234\n", backup_history.HistoryLockStaleAge+time.Minute)
+
+			lock, err := backup_history.TryLockHistoryFile(historyFilePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lock).ToNot(BeNil())
+			Expect(testLogfile).To(gbytes.Say("held by process 1234 on host otherhost"))
+			contents, _ := ioutil.ReadFile(lockFilePath)
+			Expect(string(contents)).To(Equal(lock.Token + "\n"))
+		})
+	})
+})
@@ -10,6 +10,8 @@ import (
 	"strings"
 
 	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4"
 	"github.com/pkg/errors"
 )
 
@@ -20,14 +22,16 @@ import (
 func doBackupAgent() error {
 	var lastRead uint64
 	var (
-		finalWriter io.Writer
-		gzipWriter  *gzip.Writer
-		bufIoWriter *bufio.Writer
-		writeHandle io.WriteCloser
-		writeCmd    *exec.Cmd
+		finalWriter    io.Writer
+		compressWriter io.WriteCloser
+		encryptWriter  io.WriteCloser
+		bufIoWriter    *bufio.Writer
+		writeHandle    io.WriteCloser
+		writeCmd       *exec.Cmd
 	)
 	toc := &utils.SegmentTOC{}
 	toc.DataEntries = make(map[uint]utils.SegmentDataEntry, 0)
+	fileChecksum := utils.NewChecksumHash()
 
 	oidList, err := getOidListFromFile()
 	if err != nil {
@@ -59,22 +63,27 @@ func doBackupAgent() error {
 			return err
 		}
 		if i == 0 {
-			finalWriter, gzipWriter, bufIoWriter, writeHandle, writeCmd, err = getBackupPipeWriter(*compressionLevel)
+			finalWriter, compressWriter, encryptWriter, bufIoWriter, writeHandle, writeCmd, err = getBackupPipeWriter(*compressionType, *compressionLevel, fileChecksum)
 			if err != nil {
 				return err
 			}
 		}
 
 		log(fmt.Sprintf("Backing up table with oid %d\n", oid))
-		numBytes, err := io.Copy(finalWriter, reader)
+		tableChecksum := utils.NewChecksumHash()
+		numBytes, err := io.Copy(io.MultiWriter(finalWriter, tableChecksum), reader)
 		if err != nil {
 			return errors.Wrap(err, strings.Trim(errBuf.String(), "\x00"))
 		}
 		log(fmt.Sprintf("Read %d bytes\n", numBytes))
 
 		lastProcessed := lastRead + uint64(numBytes)
-		toc.AddSegmentDataEntry(uint(oid), lastRead, lastProcessed)
+		toc.AddSegmentDataEntry(uint(oid), lastRead, lastProcessed, utils.FormatChecksum(tableChecksum))
 		lastRead = lastProcessed
+		err = writeProgress(int64(i+1), int64(lastRead))
+		if err != nil {
+			return err
+		}
 
 		lastPipe = currentPipe
 		currentPipe = nextPipe
@@ -89,11 +98,15 @@ func doBackupAgent() error {
 	 * The order for flushing and closing the writers below is very specific
 	 * to ensure all data is written to the file and file handles are not leaked.
 	 */
-	if gzipWriter != nil {
-		_ = gzipWriter.Close()
+	if compressWriter != nil {
+		_ = compressWriter.Close()
+	}
+	if encryptWriter != nil {
+		_ = encryptWriter.Close()
 	}
 	_ = bufIoWriter.Flush()
 	_ = writeHandle.Close()
+	toc.Checksum = utils.FormatChecksum(fileChecksum)
 	if *pluginConfigFile != "" {
 		/*
 		 * When using a plugin, the agent may take longer to finish than the
@@ -128,7 +141,7 @@ func getBackupPipeReader(currentPipe string) (io.Reader, io.ReadCloser, error) {
 	return reader, readHandle, nil
 }
 
-func getBackupPipeWriter(compressLevel int) (io.Writer, *gzip.Writer, *bufio.Writer, io.WriteCloser, *exec.Cmd, error) {
+func getBackupPipeWriter(compressType string, compressLevel int, fileChecksum io.Writer) (io.Writer, io.WriteCloser, io.WriteCloser, *bufio.Writer, io.WriteCloser, *exec.Cmd, error) {
 	var writeHandle io.WriteCloser
 	var err error
 	var writeCmd *exec.Cmd
@@ -138,21 +151,45 @@ func getBackupPipeWriter(compressLevel int) (io.Writer, *gzip.Writer, *bufio.Wri
 		writeHandle, err = os.Create(*dataFile)
 	}
 	if err != nil {
-		return nil, nil, nil, nil, nil, err
+		return nil, nil, nil, nil, nil, nil, err
 	}
 
 	var finalWriter io.Writer
-	var gzipWriter *gzip.Writer
-	bufIoWriter := bufio.NewWriter(writeHandle)
+	var compressWriter io.WriteCloser
+	var encryptWriter io.WriteCloser
+	// The file checksum covers the bytes as written, after any compression and encryption
+	bufIoWriter := bufio.NewWriter(utils.NewThrottledWriter(io.MultiWriter(writeHandle, fileChecksum), *maxBandwidth))
 	finalWriter = bufIoWriter
+	if encryptionKey != nil {
+		encryptWriter, err = utils.NewEncryptWriter(finalWriter, encryptionKey)
+		if err != nil {
+			return nil, nil, nil, nil, nil, nil, err
+		}
+		finalWriter = encryptWriter
+	}
 	if compressLevel > 0 {
-		gzipWriter, err = gzip.NewWriterLevel(bufIoWriter, compressLevel)
+		compressWriter, err = getCompressionWriter(finalWriter, compressType, compressLevel)
 		if err != nil {
-			return nil, nil, nil, nil, nil, err
+			return nil, nil, nil, nil, nil, nil, err
 		}
-		finalWriter = gzipWriter
+		finalWriter = compressWriter
+	}
+	return finalWriter, compressWriter, encryptWriter, bufIoWriter, writeHandle, writeCmd, nil
+}
+
+func getCompressionWriter(writer io.Writer, compressType string, compressLevel int) (io.WriteCloser, error) {
+	switch compressType {
+	case "zstd":
+		return zstd.NewWriter(writer, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(compressLevel)))
+	case "lz4":
+		lz4Writer := lz4.NewWriter(writer)
+		lz4Writer.Header.CompressionLevel = compressLevel
+		return lz4Writer, nil
+	case "gzip", "":
+		// Older versions of gpbackup only pass a compression level, implying gzip
+		return gzip.NewWriterLevel(writer, compressLevel)
 	}
-	return finalWriter, gzipWriter, bufIoWriter, writeHandle, writeCmd, nil
+	return nil, errors.Errorf("Unknown compression type %s", compressType)
 }
 
 func startBackupPluginCommand() (*exec.Cmd, io.WriteCloser, error) {
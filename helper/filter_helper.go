@@ -0,0 +1,126 @@
+package helper
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * Filter specific functions
+ */
+
+/*
+ * When encryption or throttling is enabled for a backup with one data file per
+ * table, or the data files are stored with a plugin, each COPY pipes table
+ * data through gpbackup_helper instead of a compression program, so that
+ * compression, encryption, throttling, and computing the data file checksum
+ * happen in a single process whose exit code COPY sees.  The bandwidth limit
+ * and the checksum apply to the bytes written, which are the bytes of the data
+ * file.
+ */
+func doOutputFilter() error {
+	fileChecksum := utils.NewChecksumHash()
+	bufIoWriter := bufio.NewWriter(io.MultiWriter(os.Stdout, fileChecksum))
+	finalWriter := utils.NewThrottledWriter(bufIoWriter, *maxBandwidth)
+	var encryptWriter io.WriteCloser
+	var err error
+	if encryptionKey != nil {
+		encryptWriter, err = utils.NewEncryptWriter(finalWriter, encryptionKey)
+		if err != nil {
+			return err
+		}
+		finalWriter = encryptWriter
+	}
+	var compressWriter io.WriteCloser
+	if *compressionLevel > 0 {
+		compressWriter, err = getCompressionWriter(finalWriter, *compressionType, *compressionLevel)
+		if err != nil {
+			return err
+		}
+		finalWriter = compressWriter
+	}
+	_, err = io.Copy(finalWriter, bufio.NewReader(os.Stdin))
+	if err != nil {
+		return err
+	}
+	if compressWriter != nil {
+		err = compressWriter.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if encryptWriter != nil {
+		err = encryptWriter.Close()
+		if err != nil {
+			return err
+		}
+	}
+	err = bufIoWriter.Flush()
+	if err != nil {
+		return err
+	}
+	if *checksumFile == "" {
+		return nil
+	}
+	// The checksum is recorded in the format of sha256sum, as for data files on disk
+	return ioutil.WriteFile(*checksumFile, []byte(fmt.Sprintf("%s  %s\n", utils.FormatChecksum(fileChecksum), *dataFile)), 0644)
+}
+
+/*
+ * The bandwidth limit and the checksum apply to the bytes read, which are the
+ * bytes of the data file.  The checksum can only be verified once the whole
+ * file is read, so a mismatch makes the filter exit with an error, which fails
+ * the COPY that loaded the table.
+ */
+func doInputFilter() error {
+	expectedChecksum := ""
+	if *checksumManifest != "" {
+		checksumMap, err := utils.ReadChecksumManifest(*checksumManifest)
+		if err != nil {
+			return err
+		}
+		// Backups taken before checksums were introduced have none to verify
+		expectedChecksum = checksumMap[*dataFile]
+	}
+	fileChecksum := utils.NewChecksumHash()
+	fileReader := io.TeeReader(bufio.NewReader(os.Stdin), fileChecksum)
+	reader := utils.NewThrottledReader(fileReader, *maxBandwidth)
+	var err error
+	if encryptionKey != nil {
+		reader, err = utils.NewDecryptReader(reader, encryptionKey)
+		if err != nil {
+			return err
+		}
+	}
+	decompressReader, err := getDecompressionReader(reader, *compressionType)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = decompressReader.Close()
+	}()
+	bufIoWriter := bufio.NewWriter(os.Stdout)
+	_, err = io.Copy(bufIoWriter, decompressReader)
+	if err != nil {
+		return err
+	}
+	err = bufIoWriter.Flush()
+	if err != nil {
+		return err
+	}
+	// Drain any bytes the decompressor did not need so the checksum covers the whole file
+	_, err = io.Copy(ioutil.Discard, fileReader)
+	if err != nil {
+		return err
+	}
+	if actualChecksum := utils.FormatChecksum(fileChecksum); expectedChecksum != "" && actualChecksum != expectedChecksum {
+		return errors.Errorf("Checksum mismatch for file %s: expected %s, found %s", *dataFile, expectedChecksum, actualChecksum)
+	}
+	return nil
+}
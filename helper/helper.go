@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"runtime/debug"
 	"sort"
@@ -17,6 +18,7 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
 	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
 )
 
 /*
@@ -26,6 +28,7 @@ import (
 var (
 	CleanupGroup  *sync.WaitGroup
 	currentPipe   string
+	encryptionKey []byte
 	errBuf        bytes.Buffer
 	lastPipe      string
 	nextPipe      string
@@ -39,20 +42,32 @@ var (
  * Command-line flags
  */
 var (
-	backupAgent      *bool
-	compressionLevel *int
-	content          *int
-	dataFile         *string
-	oidFile          *string
-	pipeFile         *string
-	pluginConfigFile *string
-	printVersion     *bool
-	restoreAgent     *bool
-	tocFile          *string
+	backupAgent       *bool
+	checksumFile      *string
+	checksumManifest  *string
+	compressionLevel  *int
+	compressionType   *string
+	compress          *bool
+	content           *int
+	dataFile          *string
+	decompress        *bool
+	decrypt           *bool
+	encrypt           *bool
+	encryptionKeyFile *string
+	maxBandwidth      *int64
+	oidFile           *string
+	pipeFile          *string
+	pluginConfigFile  *string
+	printFingerprint  *bool
+	printVersion      *bool
+	progressFile      *string
+	restoreAgent      *bool
+	tocChecksum       *string
+	tocFile           *string
+	verifyAgent       *bool
 )
 
 func DoHelper() {
-	var err error
 	defer func() {
 		if wasTerminated {
 			CleanupGroup.Wait()
@@ -64,16 +79,47 @@ func DoHelper() {
 
 	InitializeGlobals()
 	utils.InitializeSignalHandler(DoCleanup, fmt.Sprintf("helper agent on segment %d", *content), &wasTerminated)
-	if *backupAgent {
-		err = doBackupAgent()
-	} else if *restoreAgent {
-		err = doRestoreAgent()
-	}
+	err := doAgent()
 	if err != nil {
 		gplog.Error(fmt.Sprintf("%v: %s", err, debug.Stack()))
-		handle, _ := iohelper.OpenFileForWriting(fmt.Sprintf("%s_error", *pipeFile))
-		_ = handle.Close()
+		// The verify agent and the filters have no pipe, so their exit code reports the error
+		if *pipeFile != "" {
+			handle, _ := iohelper.OpenFileForWriting(fmt.Sprintf("%s_error", *pipeFile))
+			_ = handle.Close()
+		}
+	}
+}
+
+func doAgent() error {
+	if (*encrypt || *decrypt) && *encryptionKeyFile == "" {
+		return errors.New("--encrypt and --decrypt require --encryption-key-file")
+	}
+	if *encryptionKeyFile != "" {
+		var err error
+		encryptionKey, err = utils.ReadEncryptionKeyFile(*encryptionKeyFile)
+		if err != nil {
+			return err
+		}
 	}
+	if *printFingerprint {
+		if encryptionKey == nil {
+			return errors.New("--print-key-fingerprint requires --encryption-key-file")
+		}
+		fmt.Println(utils.GetKeyFingerprint(encryptionKey))
+		return nil
+	}
+	if *backupAgent {
+		return doBackupAgent()
+	} else if *restoreAgent {
+		return doRestoreAgent()
+	} else if *verifyAgent {
+		return doVerifyAgent()
+	} else if *encrypt || *compress {
+		return doOutputFilter()
+	} else if *decrypt || *decompress {
+		return doInputFilter()
+	}
+	return nil
 }
 
 func InitializeGlobals() {
@@ -82,15 +128,28 @@ func InitializeGlobals() {
 	gplog.InitializeLogging("gpbackup_helper", "")
 
 	backupAgent = flag.Bool("backup-agent", false, "Use gpbackup_helper as an agent for backup")
+	checksumFile = flag.String("checksum-file", "", "Absolute path to the file in which to record the checksum of the data file written by --compress or --encrypt. Leave empty to not record a checksum.")
+	checksumManifest = flag.String("checksum-manifest", "", "Absolute path to a checksum manifest against which --decompress or --decrypt verifies the data file it reads. Leave empty to not verify a checksum.")
+	compress = flag.Bool("compress", false, "Compress stdin to stdout")
 	content = flag.Int("content", -2, "Content ID of the corresponding segment")
-	compressionLevel = flag.Int("compression-level", 0, "The level of compression to use with gzip. O indicates no compression.")
+	compressionLevel = flag.Int("compression-level", 0, "The level of compression to use. O indicates no compression.")
+	compressionType = flag.String("compression-type", "", "The type of compression to use (gzip, lz4, or zstd). Leave empty for no compression.")
 	dataFile = flag.String("data-file", "", "Absolute path to the data file")
+	decompress = flag.Bool("decompress", false, "Decompress stdin to stdout")
+	decrypt = flag.Bool("decrypt", false, "Decrypt and then decompress stdin to stdout")
+	encrypt = flag.Bool("encrypt", false, "Compress and then encrypt stdin to stdout")
+	encryptionKeyFile = flag.String("encryption-key-file", "", "Absolute path to the file containing the encryption key. Leave empty for no encryption.")
+	maxBandwidth = flag.Int64("max-bandwidth", 0, "The maximum number of bytes per second to read from or write to the data file. Leave as 0 for no limit.")
 	oidFile = flag.String("oid-file", "", "Absolute path to the file containing a list of oids to restore")
 	pipeFile = flag.String("pipe-file", "", "Absolute path to the pipe file")
 	pluginConfigFile = flag.String("plugin-config", "", "The configuration file to use for a plugin")
+	printFingerprint = flag.Bool("print-key-fingerprint", false, "Print the fingerprint of the key in --encryption-key-file and exit")
 	printVersion = flag.Bool("version", false, "Print version number and exit")
+	progressFile = flag.String("progress-file", "", "Absolute path to a file in which to record the number of tables and bytes processed so far. Leave empty to not record progress.")
 	restoreAgent = flag.Bool("restore-agent", false, "Use gpbackup_helper as an agent for restore")
+	tocChecksum = flag.String("toc-checksum", "", "The checksum against which --verify-agent checks the table of contents file before reading it. Leave empty to not verify a checksum.")
 	tocFile = flag.String("toc-file", "", "Absolute path to the table of contents file")
+	verifyAgent = flag.Bool("verify-agent", false, "Use gpbackup_helper as an agent to verify a single data file backup")
 
 	flag.Parse()
 	if *printVersion {
@@ -142,6 +201,22 @@ func flushAndCloseRestoreWriter() error {
 	return nil
 }
 
+/*
+ * The progress file is replaced rather than rewritten in place so that
+ * gpbackup or gprestore never reads a partially written file.
+ */
+func writeProgress(tables int64, bytes int64) error {
+	if *progressFile == "" {
+		return nil
+	}
+	tempFile := *progressFile + ".tmp"
+	err := ioutil.WriteFile(tempFile, []byte(utils.FormatSegmentProgress(tables, bytes)), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tempFile, *progressFile)
+}
+
 func fileExists(filename string) bool {
 	_, err := operating.System.Stat(filename)
 	return err == nil
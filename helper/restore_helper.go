@@ -5,11 +5,14 @@ import (
 	"compress/gzip"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"strings"
 
 	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4"
 	"github.com/pkg/errors"
 )
 
@@ -20,6 +23,7 @@ import (
 func doRestoreAgent() error {
 	tocEntries := utils.NewSegmentTOC(*tocFile).DataEntries
 	var lastByte uint64
+	var totalBytesRead int64
 	oidList, err := getOidListFromFile()
 	if err != nil {
 		return err
@@ -36,10 +40,13 @@ func doRestoreAgent() error {
 	if err != nil {
 		return err
 	}
-	reader, err := getRestorePipeReader()
+	reader, decompressReader, err := getRestorePipeReader()
 	if err != nil {
 		return err
 	}
+	defer func() {
+		_ = decompressReader.Close()
+	}()
 
 	for i, oid := range oidList {
 		if wasTerminated {
@@ -63,17 +70,31 @@ func doRestoreAgent() error {
 			return err
 		}
 		log(fmt.Sprintf("Discarded %d bytes", start-lastByte))
-		bytesRead, err := io.CopyN(writer, reader, int64(end-start))
+		tableChecksum := utils.NewChecksumHash()
+		bytesRead, err := io.CopyN(io.MultiWriter(writer, tableChecksum), reader, int64(end-start))
 		log(fmt.Sprintf("Read %d bytes", bytesRead))
 		if err != nil {
 			return errors.Wrap(err, strings.Trim(errBuf.String(), "\x00"))
 		}
+		/*
+		 * The pipe is left open on a mismatch, so that the COPY reading it finds
+		 * the error file created before the pipe is closed and fails.
+		 */
+		expectedChecksum := tocEntries[uint(oid)].Checksum
+		if actualChecksum := utils.FormatChecksum(tableChecksum); expectedChecksum != "" && actualChecksum != expectedChecksum {
+			return errors.Errorf("Checksum mismatch for table with oid %d in file %s: expected %s, found %s", oid, *dataFile, expectedChecksum, actualChecksum)
+		}
 		log(fmt.Sprintf("Closing pipe for oid %d", oid))
 		err = flushAndCloseRestoreWriter()
 		if err != nil {
 			return err
 		}
 		lastByte = end
+		totalBytesRead += bytesRead
+		err = writeProgress(int64(i+1), totalBytesRead)
+		if err != nil {
+			return err
+		}
 
 		lastPipe = currentPipe
 		currentPipe = nextPipe
@@ -92,7 +113,7 @@ func doRestoreAgent() error {
 	return nil
 }
 
-func getRestorePipeReader() (*bufio.Reader, error) {
+func getRestorePipeReader() (*bufio.Reader, io.Closer, error) {
 	var readHandle io.Reader
 	var err error
 	if *pluginConfigFile != "" {
@@ -101,25 +122,61 @@ func getRestorePipeReader() (*bufio.Reader, error) {
 		readHandle, err = os.Open(*dataFile)
 	}
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	readHandle = utils.NewThrottledReader(readHandle, *maxBandwidth)
 
-	var bufIoReader *bufio.Reader
-	if strings.HasSuffix(*dataFile, ".gz") {
-		gzipReader, err := gzip.NewReader(readHandle)
+	if encryptionKey != nil {
+		readHandle, err = utils.NewDecryptReader(readHandle, encryptionKey)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		bufIoReader = bufio.NewReader(gzipReader)
-	} else {
-		bufIoReader = bufio.NewReader(readHandle)
 	}
+	decompressReader, err := getDecompressionReader(readHandle, *compressionType)
+	if err != nil {
+		return nil, nil, err
+	}
+	bufIoReader := bufio.NewReader(decompressReader)
 	// Check that no error has occurred in plugin command
 	errString := strings.Trim(errBuf.String(), "\x00")
 	if len(errString) != 0 {
-		return nil, errors.New(errString)
+		_ = decompressReader.Close()
+		return nil, nil, errors.New(errString)
+	}
+	return bufIoReader, decompressReader, nil
+}
+
+// The zstd decoder runs goroutines that are only stopped by closing it
+type zstdReadCloser struct {
+	*zstd.Decoder
+}
+
+func (reader zstdReadCloser) Close() error {
+	reader.Decoder.Close()
+	return nil
+}
+
+/*
+ * The returned reader must be closed once the stream has been read, which
+ * releases the resources of the decompressor.  Closing it does not close the
+ * underlying reader.
+ */
+func getDecompressionReader(reader io.Reader, compressType string) (io.ReadCloser, error) {
+	switch compressType {
+	case "gzip":
+		return gzip.NewReader(reader)
+	case "zstd":
+		decoder, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return zstdReadCloser{decoder}, nil
+	case "lz4":
+		return ioutil.NopCloser(lz4.NewReader(reader)), nil
+	case "":
+		return ioutil.NopCloser(reader), nil
 	}
-	return bufIoReader, nil
+	return nil, errors.Errorf("Unknown compression type %s", compressType)
 }
 
 func getRestorePipeWriter(currentPipe string) (*bufio.Writer, *os.File, error) {
@@ -0,0 +1,125 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+/*
+ * Verify specific functions
+ */
+
+/*
+ * The verify agent reads the whole data file, decompressing it and checking
+ * that the byte ranges in the segment TOC account for every byte of it.  Any
+ * problems found are printed to stdout, one per line, for gpbackup_manager to
+ * collect; an error is only returned if the agent itself cannot run.
+ */
+func doVerifyAgent() error {
+	// A corrupted TOC cannot be trusted to locate the tables, so nothing else is checked
+	err := utils.VerifyFileChecksum(*tocFile, *tocChecksum)
+	if err != nil {
+		fmt.Println(err)
+		log(fmt.Sprintf("Segment TOC %s failed checksum verification", *tocFile))
+		return nil
+	}
+	toc := utils.NewSegmentTOC(*tocFile)
+	oidList, err := getOidListFromFile()
+	if err != nil {
+		return err
+	}
+	problems := verifySegmentTOCEntries(toc, oidList)
+	problems = append(problems, verifySegmentDataFile(toc)...)
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	log(fmt.Sprintf("Found %d problem(s) with data file %s", len(problems), *dataFile))
+	return nil
+}
+
+func getSortedSegmentTOCOids(toc *utils.SegmentTOC) []uint {
+	oids := make([]uint, 0, len(toc.DataEntries))
+	for oid := range toc.DataEntries {
+		oids = append(oids, oid)
+	}
+	sort.Slice(oids, func(i int, j int) bool {
+		return toc.DataEntries[oids[i]].StartByte < toc.DataEntries[oids[j]].StartByte
+	})
+	return oids
+}
+
+func verifySegmentTOCEntries(toc *utils.SegmentTOC, oidList []int) []string {
+	problems := make([]string, 0)
+	for _, oid := range oidList {
+		if _, ok := toc.DataEntries[uint(oid)]; !ok {
+			problems = append(problems, fmt.Sprintf("%s: no entry for table with oid %d", *tocFile, oid))
+		}
+	}
+	var lastByte uint64
+	for _, oid := range getSortedSegmentTOCOids(toc) {
+		entry := toc.DataEntries[oid]
+		if entry.StartByte != lastByte || entry.EndByte < entry.StartByte {
+			problems = append(problems, fmt.Sprintf("%s: byte range %d-%d for table with oid %d does not follow the previous range ending at %d",
+				*tocFile, entry.StartByte, entry.EndByte, oid, lastByte))
+		}
+		lastByte = entry.EndByte
+	}
+	return problems
+}
+
+func verifySegmentDataFile(toc *utils.SegmentTOC) []string {
+	dataHandle, err := os.Open(*dataFile)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: missing or unreadable: %v", *dataFile, err)}
+	}
+	defer dataHandle.Close()
+	fileChecksum := utils.NewChecksumHash()
+	fileReader := io.TeeReader(dataHandle, fileChecksum)
+	var decryptReader io.Reader = fileReader
+	if encryptionKey != nil {
+		decryptReader, err = utils.NewDecryptReader(fileReader, encryptionKey)
+		if err != nil {
+			return []string{fmt.Sprintf("%s: could not be decrypted: %v", *dataFile, err)}
+		}
+	}
+	reader, err := getDecompressionReader(decryptReader, *compressionType)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: could not be decompressed: %v", *dataFile, err)}
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	problems := make([]string, 0)
+	for _, oid := range getSortedSegmentTOCOids(toc) {
+		entry := toc.DataEntries[oid]
+		tableChecksum := utils.NewChecksumHash()
+		bytesRead, err := io.CopyN(tableChecksum, reader, int64(entry.EndByte-entry.StartByte))
+		if err != nil {
+			return append(problems, fmt.Sprintf("%s: could not read byte range %d-%d for table with oid %d; read %d bytes: %v",
+				*dataFile, entry.StartByte, entry.EndByte, oid, bytesRead, err))
+		}
+		if actualChecksum := utils.FormatChecksum(tableChecksum); entry.Checksum != "" && actualChecksum != entry.Checksum {
+			problems = append(problems, fmt.Sprintf("%s: checksum mismatch for table with oid %d: expected %s, found %s",
+				*dataFile, oid, entry.Checksum, actualChecksum))
+		}
+	}
+	extraBytes, err := io.Copy(ioutil.Discard, reader)
+	if err != nil {
+		return append(problems, fmt.Sprintf("%s: could not be decrypted or decompressed: %v", *dataFile, err))
+	}
+	if extraBytes > 0 {
+		problems = append(problems, fmt.Sprintf("%s: %d bytes found after the last byte range in the segment TOC", *dataFile, extraBytes))
+	}
+	// Drain any bytes the decompressor did not need so the file checksum covers the whole file
+	_, _ = io.Copy(ioutil.Discard, fileReader)
+	if actualChecksum := utils.FormatChecksum(fileChecksum); toc.Checksum != "" && actualChecksum != toc.Checksum {
+		problems = append(problems, fmt.Sprintf("%s: checksum mismatch: expected %s, found %s", *dataFile, toc.Checksum, actualChecksum))
+	}
+	return problems
+}
@@ -14,8 +14,11 @@ import (
 	"time"
 
 	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/klauspost/compress/zstd"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/pierrec/lz4"
 )
 
 var (
@@ -27,6 +30,7 @@ var (
 	dataFileFullPath = filepath.Join(testDir, "test_data")
 	pluginBackupPath = filepath.Join(pluginDir, "test_data")
 	errorFile        = fmt.Sprintf("%s_error", pipeFile)
+	keyFile          = fmt.Sprintf("%s/test_key", testDir)
 	pluginConfigPath = fmt.Sprintf("%s/go/src/github.com/greenplum-db/gpbackup/plugins/example_plugin_config.yaml", os.Getenv("HOME"))
 )
 
@@ -36,7 +40,8 @@ const (
 here is some data
 here is some data
 `
-	expectedTOC = `dataentries:
+	encryptionKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	expectedTOC   = `dataentries:
   1:
     startbyte: 0
     endbyte: 18
@@ -114,6 +119,44 @@ var _ = Describe("gpbackup_helper end to end integration tests", func() {
 			Expect(err).ToNot(HaveOccurred())
 			assertBackupArtifacts(true, false)
 		})
+		It("runs backup gpbackup_helper with zstd compression", func() {
+			helperCmd := gpbackupHelper(gpbackupHelperPath, "--backup-agent", "--compression-type", "zstd", "--compression-level", "3", "--data-file", dataFileFullPath+".zst")
+			writeToPipes(defaultData)
+			err := helperCmd.Wait()
+			printHelperLogOnError(err)
+			Expect(err).ToNot(HaveOccurred())
+			contents, err := ioutil.ReadFile(dataFileFullPath + ".zst")
+			Expect(err).ToNot(HaveOccurred())
+			r, _ := zstd.NewReader(bytes.NewReader(contents))
+			contents, _ = ioutil.ReadAll(r)
+			Expect(string(contents)).To(Equal(expectedData))
+		})
+		It("runs backup gpbackup_helper with lz4 compression", func() {
+			helperCmd := gpbackupHelper(gpbackupHelperPath, "--backup-agent", "--compression-type", "lz4", "--compression-level", "1", "--data-file", dataFileFullPath+".lz4")
+			writeToPipes(defaultData)
+			err := helperCmd.Wait()
+			printHelperLogOnError(err)
+			Expect(err).ToNot(HaveOccurred())
+			contents, err := ioutil.ReadFile(dataFileFullPath + ".lz4")
+			Expect(err).ToNot(HaveOccurred())
+			contents, _ = ioutil.ReadAll(lz4.NewReader(bytes.NewReader(contents)))
+			Expect(string(contents)).To(Equal(expectedData))
+		})
+		It("runs backup gpbackup_helper with compression and encryption", func() {
+			key := writeEncryptionKeyFile()
+			helperCmd := gpbackupHelper(gpbackupHelperPath, "--backup-agent", "--compression-level", "1", "--encryption-key-file", keyFile, "--data-file", dataFileFullPath+".gz.enc")
+			writeToPipes(defaultData)
+			err := helperCmd.Wait()
+			printHelperLogOnError(err)
+			Expect(err).ToNot(HaveOccurred())
+			file, err := os.Open(dataFileFullPath + ".gz.enc")
+			Expect(err).ToNot(HaveOccurred())
+			decryptReader, err := utils.NewDecryptReader(file, key)
+			Expect(err).ToNot(HaveOccurred())
+			r, _ := gzip.NewReader(decryptReader)
+			contents, _ := ioutil.ReadAll(r)
+			Expect(string(contents)).To(Equal(expectedData))
+		})
 		It("runs backup gpbackup_helper without compression with plugin", func() {
 			helperCmd := gpbackupHelper(gpbackupHelperPath, "--backup-agent", "--compression-level", "0", "--data-file", dataFileFullPath, "--plugin-config", pluginConfigPath)
 			writeToPipes(defaultData)
@@ -140,6 +183,34 @@ var _ = Describe("gpbackup_helper end to end integration tests", func() {
 			assertErrorsHandled()
 		})
 	})
+	Context("encryption filter tests", func() {
+		It("round trips data through the encrypt and decrypt filters", func() {
+			writeEncryptionKeyFile()
+			encryptCmd := exec.Command(gpbackupHelperPath, "--encrypt", "--encryption-key-file", keyFile, "--compression-type", "zstd", "--compression-level", "3")
+			encryptCmd.Stdin = strings.NewReader(expectedData)
+			encrypted, err := encryptCmd.Output()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(utils.IsEncrypted(encrypted)).To(BeTrue())
+
+			decryptCmd := exec.Command(gpbackupHelperPath, "--decrypt", "--encryption-key-file", keyFile, "--compression-type", "zstd")
+			decryptCmd.Stdin = bytes.NewReader(encrypted)
+			decrypted, err := decryptCmd.Output()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(decrypted)).To(Equal(expectedData))
+		})
+		It("fails to decrypt data that has been truncated", func() {
+			writeEncryptionKeyFile()
+			encryptCmd := exec.Command(gpbackupHelperPath, "--encrypt", "--encryption-key-file", keyFile)
+			encryptCmd.Stdin = strings.NewReader(expectedData)
+			encrypted, err := encryptCmd.Output()
+			Expect(err).ToNot(HaveOccurred())
+
+			decryptCmd := exec.Command(gpbackupHelperPath, "--decrypt", "--encryption-key-file", keyFile)
+			decryptCmd.Stdin = bytes.NewReader(encrypted[:len(encrypted)-1])
+			_, err = decryptCmd.Output()
+			Expect(err).To(HaveOccurred())
+		})
+	})
 	Context("restore tests", func() {
 		It("runs restore gpbackup_helper without compression", func() {
 			setupRestoreFiles(false, false)
@@ -155,7 +226,7 @@ var _ = Describe("gpbackup_helper end to end integration tests", func() {
 		})
 		It("runs restore gpbackup_helper with compression", func() {
 			setupRestoreFiles(true, false)
-			helperCmd := gpbackupHelper(gpbackupHelperPath, "--restore-agent", "--data-file", dataFileFullPath+".gz")
+			helperCmd := gpbackupHelper(gpbackupHelperPath, "--restore-agent", "--compression-type", "gzip", "--data-file", dataFileFullPath+".gz")
 			for _, i := range []int{1, 3} {
 				contents, _ := ioutil.ReadFile(fmt.Sprintf("%s_%d", pipeFile, i))
 				Expect(string(contents)).To(Equal("here is some data\n"))
@@ -179,7 +250,7 @@ var _ = Describe("gpbackup_helper end to end integration tests", func() {
 		})
 		It("runs restore gpbackup_helper with compression with plugin", func() {
 			setupRestoreFiles(true, true)
-			gpbackupHelper(gpbackupHelperPath, "--restore-agent", "--data-file", dataFileFullPath+".gz", "--plugin-config", pluginConfigPath)
+			gpbackupHelper(gpbackupHelperPath, "--restore-agent", "--compression-type", "gzip", "--data-file", dataFileFullPath+".gz", "--plugin-config", pluginConfigPath)
 			for _, i := range []int{1, 3} {
 				contents, _ := ioutil.ReadFile(fmt.Sprintf("%s_%d", pipeFile, i))
 				Expect(string(contents)).To(Equal("here is some data\n"))
@@ -188,7 +259,7 @@ var _ = Describe("gpbackup_helper end to end integration tests", func() {
 		})
 		It("Generates error file when restore agent interrupted", func() {
 			setupRestoreFiles(true, false)
-			helperCmd := gpbackupHelper(gpbackupHelperPath, "--restore-agent", "--data-file", dataFileFullPath+".gz")
+			helperCmd := gpbackupHelper(gpbackupHelperPath, "--restore-agent", "--compression-type", "gzip", "--data-file", dataFileFullPath+".gz")
 			time.Sleep(200 * time.Millisecond)
 			err := helperCmd.Process.Signal(os.Interrupt)
 			Expect(err).ToNot(HaveOccurred())
@@ -199,6 +270,14 @@ var _ = Describe("gpbackup_helper end to end integration tests", func() {
 	})
 })
 
+func writeEncryptionKeyFile() []byte {
+	err := ioutil.WriteFile(keyFile, []byte(encryptionKey+"\n"), 0600)
+	Expect(err).ToNot(HaveOccurred())
+	key, err := utils.ReadEncryptionKeyFile(keyFile)
+	Expect(err).ToNot(HaveOccurred())
+	return key
+}
+
 func setupRestoreFiles(withCompression bool, withPlugin bool) {
 	dataFile := dataFileFullPath
 	if withPlugin {
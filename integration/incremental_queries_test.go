@@ -2,9 +2,11 @@ package integration
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/testutils"
 	"github.com/greenplum-db/gpbackup/utils"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -261,4 +263,68 @@ var _ = Describe("backup integration tests", func() {
 			})
 		})
 	})
+	Describe("GetHeapFingerprints and GetHeapIncrementalMetadata", func() {
+		var heapTableFQN = "public.heap_foo"
+		var heapTables []backup.Table
+		// The statistics collector reports row counts with a short delay
+		getFingerprint := func() string {
+			return backup.GetHeapFingerprints(connectionPool)[heapTables[0].Oid]
+		}
+		BeforeEach(func() {
+			testhelper.AssertQueryRuns(connectionPool, fmt.Sprintf("CREATE TABLE %s (i int) DISTRIBUTED BY (i)", heapTableFQN))
+			testhelper.AssertQueryRuns(connectionPool, fmt.Sprintf(insertSQL, heapTableFQN))
+			oid := testutils.OidFromObjectName(connectionPool, "public", "heap_foo", backup.TYPE_RELATION)
+			heapTables = []backup.Table{{Relation: backup.Relation{Oid: oid, Schema: "public", Name: "heap_foo"}}}
+			Eventually(getFingerprint, 5*time.Second, 100*time.Millisecond).Should(HaveSuffix(":1:0:0"))
+		})
+		AfterEach(func() {
+			testhelper.AssertQueryRuns(connectionPool, fmt.Sprintf(dropTableSQL, heapTableFQN))
+		})
+		It("should have the same fingerprint when the table is unchanged", func() {
+			initialHeapIncrementalMetadata := backup.GetHeapIncrementalMetadata(connectionPool, heapTables, backup.GetHeapFingerprints(connectionPool))
+			heapIncrementalMetadata := backup.GetHeapIncrementalMetadata(connectionPool, heapTables, backup.GetHeapFingerprints(connectionPool))
+
+			Expect(heapIncrementalMetadata[heapTableFQN].Fingerprint).To(Not(BeEmpty()))
+			Expect(heapIncrementalMetadata[heapTableFQN].LastDDLTimestamp).To(Not(BeEmpty()))
+			Expect(heapIncrementalMetadata[heapTableFQN]).To(Equal(initialHeapIncrementalMetadata[heapTableFQN]))
+		})
+		It("should have the same fingerprint after the table is vacuumed and frozen", func() {
+			initialFingerprint := getFingerprint()
+			testhelper.AssertQueryRuns(connectionPool, fmt.Sprintf("VACUUM FREEZE %s", heapTableFQN))
+
+			Consistently(getFingerprint, time.Second, 100*time.Millisecond).Should(Equal(initialFingerprint))
+		})
+		It("should have a changed fingerprint after a row is updated", func() {
+			initialFingerprint := getFingerprint()
+			testhelper.AssertQueryRuns(connectionPool, fmt.Sprintf("UPDATE %s SET i = 10", heapTableFQN))
+
+			Eventually(getFingerprint, 5*time.Second, 100*time.Millisecond).Should(Not(Equal(initialFingerprint)))
+		})
+		It("should have a changed fingerprint after a row is deleted and an identical row inserted", func() {
+			initialFingerprint := getFingerprint()
+			testhelper.AssertQueryRuns(connectionPool, fmt.Sprintf(deleteSQL, heapTableFQN))
+			testhelper.AssertQueryRuns(connectionPool, fmt.Sprintf(insertSQL, heapTableFQN))
+
+			Eventually(getFingerprint, 5*time.Second, 100*time.Millisecond).Should(Not(Equal(initialFingerprint)))
+		})
+		It("should have a changed fingerprint after the table is truncated", func() {
+			initialFingerprint := getFingerprint()
+			testhelper.AssertQueryRuns(connectionPool, fmt.Sprintf("TRUNCATE %s", heapTableFQN))
+
+			Expect(getFingerprint()).To(Not(Equal(initialFingerprint)))
+		})
+		It("should leave out tables that have no fingerprint", func() {
+			heapIncrementalMetadata := backup.GetHeapIncrementalMetadata(connectionPool, heapTables, map[uint32]string{})
+
+			Expect(heapIncrementalMetadata).To(BeEmpty())
+		})
+		It("should have a changed last DDL timestamp after a column add", func() {
+			initialHeapIncrementalMetadata := backup.GetHeapIncrementalMetadata(connectionPool, heapTables, backup.GetHeapFingerprints(connectionPool))
+			testhelper.AssertQueryRuns(connectionPool, fmt.Sprintf(addColumnSQL, heapTableFQN))
+			heapIncrementalMetadata := backup.GetHeapIncrementalMetadata(connectionPool, heapTables, backup.GetHeapFingerprints(connectionPool))
+
+			Expect(heapIncrementalMetadata[heapTableFQN].LastDDLTimestamp).
+				To(Not(Equal(initialHeapIncrementalMetadata[heapTableFQN].LastDDLTimestamp)))
+		})
+	})
 })
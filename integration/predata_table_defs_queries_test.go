@@ -576,6 +576,33 @@ SET SUBPARTITION TEMPLATE
 		})
 	})
 
+	Describe("GetTableSizes", func() {
+		It("returns the size of a table, including the sizes of its partitions", func() {
+			testhelper.AssertQueryRuns(connectionPool, "CREATE TABLE public.simple_table(i int) DISTRIBUTED BY (i)")
+			defer testhelper.AssertQueryRuns(connectionPool, "DROP TABLE public.simple_table")
+			testhelper.AssertQueryRuns(connectionPool, "INSERT INTO public.simple_table SELECT generate_series(1, 10000)")
+			testhelper.AssertQueryRuns(connectionPool, `CREATE TABLE public.part_table(i int) DISTRIBUTED BY (i)
+PARTITION BY RANGE (i) (START (1) END (10001) EVERY (5000))`)
+			defer testhelper.AssertQueryRuns(connectionPool, "DROP TABLE public.part_table")
+			testhelper.AssertQueryRuns(connectionPool, "INSERT INTO public.part_table SELECT generate_series(1, 10000)")
+			simpleOid := testutils.OidFromObjectName(connectionPool, "public", "simple_table", backup.TYPE_RELATION)
+			partOid := testutils.OidFromObjectName(connectionPool, "public", "part_table", backup.TYPE_RELATION)
+			tables := []backup.Table{
+				{Relation: backup.Relation{Oid: simpleOid, Schema: "public", Name: "simple_table"}},
+				{Relation: backup.Relation{Oid: partOid, Schema: "public", Name: "part_table"}},
+			}
+
+			result := backup.GetTableSizes(connectionPool, tables)
+
+			Expect(result).To(HaveLen(2))
+			Expect(result[simpleOid]).To(BeNumerically(">", 0))
+			Expect(result[partOid]).To(BeNumerically(">", 0))
+		})
+		It("returns an empty map when there are no tables", func() {
+			Expect(backup.GetTableSizes(connectionPool, []backup.Table{})).To(BeEmpty())
+		})
+	})
+
 	Describe("GetForeignTableDefinitions", func() {
 		It("Returns a map when a FOREIGN table exists", func() {
 			testutils.SkipIfBefore6(connectionPool)
@@ -0,0 +1,351 @@
+package manager
+
+/*
+ * This file contains functions for listing and showing the backups recorded
+ * in the backup history file.
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/backup_filepath"
+	"github.com/greenplum-db/gpbackup/backup_history"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	BACKUP_TYPE_FULL         = "full"
+	BACKUP_TYPE_INCREMENTAL  = "incremental"
+	BACKUP_TYPE_DIFFERENTIAL = "differential"
+	FORMAT_TABLE             = "table"
+	FORMAT_JSON              = "json"
+)
+
+var dateRangeRegex = regexp.MustCompile(`^[0-9]{8}([0-9]{6})?$`)
+
+/*
+ * After and Before are dates (YYYYMMDD) or timestamps (YYYYMMDDHHMMSS); a
+ * backup matches if it was taken at or after After and before Before.
+ */
+type BackupFilter struct {
+	DatabaseName string
+	After        string
+	Before       string
+	Plugin       string
+	BackupType   string
+	Status       string
+}
+
+func ValidateBackupFilter(filter BackupFilter) error {
+	for _, date := range []string{filter.After, filter.Before} {
+		if date != "" && !dateRangeRegex.MatchString(date) {
+			return errors.Errorf("Date %s is invalid.  Dates must be in the format YYYYMMDD or YYYYMMDDHHMMSS.", date)
+		}
+	}
+	if filter.BackupType != "" && filter.BackupType != BACKUP_TYPE_FULL && filter.BackupType != BACKUP_TYPE_INCREMENTAL && filter.BackupType != BACKUP_TYPE_DIFFERENTIAL {
+		return errors.Errorf("Backup type %s is invalid.  Valid types are '%s', '%s', and '%s'.", filter.BackupType, BACKUP_TYPE_FULL, BACKUP_TYPE_INCREMENTAL, BACKUP_TYPE_DIFFERENTIAL)
+	}
+	status := strings.ToLower(filter.Status)
+	if status != "" && status != strings.ToLower(backup_history.BACKUP_STATUS_SUCCESS) && status != strings.ToLower(backup_history.BACKUP_STATUS_FAILURE) {
+		return errors.Errorf("Status %s is invalid.  Valid statuses are 'success' and 'failure'.", filter.Status)
+	}
+	return nil
+}
+
+// Dates are padded with zeroes so they compare as the first second of the day
+func padDate(date string) string {
+	return date + strings.Repeat("0", 14-len(date))
+}
+
+// Database names are recorded quoted if they need to be, as in "MyDatabase"
+func unquoteDatabaseName(dbName string) string {
+	if len(dbName) >= 2 && strings.HasPrefix(dbName, `"`) && strings.HasSuffix(dbName, `"`) {
+		return strings.Replace(dbName[1:len(dbName)-1], `""`, `"`, -1)
+	}
+	return dbName
+}
+
+func (filter BackupFilter) Matches(backupConfig *backup_history.BackupConfig) bool {
+	if filter.DatabaseName != "" && backupConfig.DatabaseName != filter.DatabaseName && unquoteDatabaseName(backupConfig.DatabaseName) != filter.DatabaseName {
+		return false
+	}
+	if filter.After != "" && backupConfig.Timestamp < padDate(filter.After) {
+		return false
+	}
+	if filter.Before != "" && backupConfig.Timestamp >= padDate(filter.Before) {
+		return false
+	}
+	if filter.Plugin != "" && backupConfig.Plugin != filter.Plugin && filepath.Base(backupConfig.Plugin) != filter.Plugin {
+		return false
+	}
+	if filter.BackupType != "" && GetBackupType(backupConfig) != filter.BackupType {
+		return false
+	}
+	if filter.Status != "" && !strings.EqualFold(GetBackupStatus(backupConfig), filter.Status) {
+		return false
+	}
+	return true
+}
+
+func FilterBackups(history *backup_history.History, filter BackupFilter) []backup_history.BackupConfig {
+	backupConfigs := make([]backup_history.BackupConfig, 0)
+	for _, backupConfig := range history.BackupConfigs {
+		if filter.Matches(&backupConfig) {
+			backupConfigs = append(backupConfigs, backupConfig)
+		}
+	}
+	return backupConfigs
+}
+
+func GetBackupType(backupConfig *backup_history.BackupConfig) string {
+	if backupConfig.Differential {
+		return BACKUP_TYPE_DIFFERENTIAL
+	}
+	if backupConfig.Incremental {
+		return BACKUP_TYPE_INCREMENTAL
+	}
+	return BACKUP_TYPE_FULL
+}
+
+// Entries written before failed backups were recorded are all successful
+func GetBackupStatus(backupConfig *backup_history.BackupConfig) string {
+	if backupConfig.Status == "" {
+		return backup_history.BACKUP_STATUS_SUCCESS
+	}
+	return backupConfig.Status
+}
+
+// Turns 1536 into "1.5 KB"
+func formatSize(bytes int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
+	size := float64(bytes)
+	unit := 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
+
+// Turns 3723 into "1:02:03", the format used in backup reports
+func formatDuration(seconds float64) string {
+	total := int64(seconds)
+	return fmt.Sprintf("%d:%02d:%02d", total/3600, total/60%60, total%60)
+}
+
+/*
+ * Metrics are not recorded for backups taken with older versions of gpbackup,
+ * so they are shown as "-" instead of as zero.
+ */
+func PrintBackupTable(writer io.Writer, backupConfigs []backup_history.BackupConfig) {
+	tabWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tabWriter, "TIMESTAMP\tDATABASE\tTYPE\tSTATUS\tPLUGIN\tTABLES\tSIZE\tDURATION")
+	for _, backupConfig := range backupConfigs {
+		plugin, tables, size, duration := "-", "-", "-", "-"
+		if backupConfig.Plugin != "" {
+			plugin = filepath.Base(backupConfig.Plugin)
+		}
+		if backupConfig.Metrics.EndTime != "" {
+			tables = strconv.Itoa(backupConfig.Metrics.TableCount)
+			duration = formatDuration(backupConfig.Metrics.DurationSeconds)
+			if backupConfig.Plugin == "" {
+				size = formatSize(backupConfig.Metrics.TotalBytes)
+			}
+		}
+		status := GetBackupStatus(&backupConfig)
+		if backupConfig.Deleted {
+			status += " (deleted)"
+		}
+		fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", backupConfig.Timestamp, backupConfig.DatabaseName,
+			GetBackupType(&backupConfig), status, plugin, tables, size, duration)
+	}
+	_ = tabWriter.Flush()
+}
+
+func PrintJSON(writer io.Writer, value interface{}) error {
+	contents, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(writer, string(contents))
+	return err
+}
+
+func ValidateOutputFormat(format string) error {
+	if format != FORMAT_TABLE && format != FORMAT_JSON {
+		return errors.Errorf("Output format %s is invalid.  Valid formats are '%s' and '%s'.", format, FORMAT_TABLE, FORMAT_JSON)
+	}
+	return nil
+}
+
+func GetHistoryFilePath() string {
+	gplog.FatalOnError(utils.ValidateFullPath(MustGetFlagString(utils.HISTORY_FILE)))
+	historyFilePath, err := backup_history.GetHistoryFilePath(MustGetFlagString(utils.HISTORY_FILE), "")
+	gplog.FatalOnError(err)
+	return historyFilePath
+}
+
+func readHistory() *backup_history.History {
+	historyFilename := GetHistoryFilePath()
+	if !iohelper.FileExistsAndIsReadable(historyFilename) {
+		gplog.Fatal(errors.Errorf("Cannot access history file %s", historyFilename), "")
+	}
+	history, err := backup_history.NewHistory(historyFilename)
+	gplog.FatalOnError(err)
+	return history
+}
+
+func DoListBackups(writer io.Writer) {
+	filter := BackupFilter{
+		DatabaseName: MustGetFlagString(utils.DBNAME),
+		After:        MustGetFlagString(utils.AFTER),
+		Before:       MustGetFlagString(utils.BEFORE),
+		Plugin:       MustGetFlagString(utils.PLUGIN),
+		BackupType:   MustGetFlagString(utils.BACKUP_TYPE),
+		Status:       MustGetFlagString(utils.STATUS),
+	}
+	gplog.FatalOnError(ValidateBackupFilter(filter))
+	format := MustGetFlagString(utils.FORMAT)
+	gplog.FatalOnError(ValidateOutputFormat(format))
+
+	backupConfigs := FilterBackups(readHistory(), filter)
+	if format == FORMAT_JSON {
+		gplog.FatalOnError(PrintJSON(writer, backupConfigs))
+	} else {
+		PrintBackupTable(writer, backupConfigs)
+	}
+}
+
+type RestorePlanChainEntry struct {
+	Timestamp  string
+	Status     string
+	TableCount int
+}
+
+type BackupDetails struct {
+	BackupConfig     backup_history.BackupConfig
+	RestorePlanChain []RestorePlanChainEntry
+	ObjectCounts     map[string]int
+}
+
+/*
+ * The restore plan lists, for each backup in an incremental chain, the tables
+ * whose data is restored from it.  A backup in the chain that is no longer in
+ * the history file is shown with an unknown status.
+ */
+func GetRestorePlanChain(history *backup_history.History, backupConfig *backup_history.BackupConfig) []RestorePlanChainEntry {
+	statuses := make(map[string]string, len(history.BackupConfigs))
+	for _, entry := range history.BackupConfigs {
+		statuses[entry.Timestamp] = GetBackupStatus(&entry)
+	}
+	chain := make([]RestorePlanChainEntry, 0, len(backupConfig.RestorePlan))
+	for _, entry := range backupConfig.RestorePlan {
+		status, ok := statuses[entry.Timestamp]
+		if !ok {
+			status = "Unknown"
+		}
+		chain = append(chain, RestorePlanChainEntry{Timestamp: entry.Timestamp, Status: status, TableCount: len(entry.TableFQNs)})
+	}
+	return chain
+}
+
+// Reads the counts printed by PrintObjectCounts at the end of a backup report
+func ParseObjectCounts(report string) map[string]int {
+	objectCounts := make(map[string]int, 0)
+	header := "Count of Database Objects in Backup:"
+	headerIndex := strings.Index(report, header)
+	if headerIndex == -1 {
+		return objectCounts
+	}
+	for _, line := range strings.Split(report[headerIndex+len(header):], "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		count, err := strconv.Atoi(fields[len(fields)-1])
+		if err != nil {
+			continue
+		}
+		objectCounts[strings.Join(fields[:len(fields)-1], " ")] = count
+	}
+	return objectCounts
+}
+
+func GetBackupDetails(history *backup_history.History, timestamp string) (*BackupDetails, error) {
+	for _, backupConfig := range history.BackupConfigs {
+		if backupConfig.Timestamp != timestamp {
+			continue
+		}
+		details := &BackupDetails{
+			BackupConfig:     backupConfig,
+			RestorePlanChain: GetRestorePlanChain(history, &backupConfig),
+			ObjectCounts:     make(map[string]int, 0),
+		}
+		fpInfo := GetMasterFilePathInfo(backupConfig.BackupDir, timestamp)
+		reportFilename := fpInfo.GetBackupReportFilePath()
+		if contents, err := operating.System.ReadFile(reportFilename); err == nil {
+			details.ObjectCounts = ParseObjectCounts(string(contents))
+		} else {
+			gplog.Verbose("Cannot read report file %s; object counts will not be shown", reportFilename)
+		}
+		return details, nil
+	}
+	return nil, errors.Errorf("Backup %s was not found in the backup history", timestamp)
+}
+
+func PrintBackupDetails(writer io.Writer, details *BackupDetails) error {
+	configContents, err := yaml.Marshal(details.BackupConfig)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(writer, "Backup %s\n\n%s\nRestore Plan:\n", details.BackupConfig.Timestamp, configContents)
+	tabWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	for _, entry := range details.RestorePlanChain {
+		fmt.Fprintf(tabWriter, "  %s\t%s\t%d tables\n", entry.Timestamp, entry.Status, entry.TableCount)
+	}
+	_ = tabWriter.Flush()
+	if len(details.ObjectCounts) > 0 {
+		fmt.Fprintf(writer, "\nCount of Database Objects in Backup:\n")
+		objectTypes := make([]string, 0, len(details.ObjectCounts))
+		for objectType := range details.ObjectCounts {
+			objectTypes = append(objectTypes, objectType)
+		}
+		sort.Strings(objectTypes)
+		for _, objectType := range objectTypes {
+			fmt.Fprintf(writer, "%-29s%d\n", objectType, details.ObjectCounts[objectType])
+		}
+	}
+	return nil
+}
+
+func DoShowBackup(writer io.Writer, timestamp string) {
+	if !backup_filepath.IsValidTimestamp(timestamp) {
+		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", timestamp), "")
+	}
+	format := MustGetFlagString(utils.FORMAT)
+	gplog.FatalOnError(ValidateOutputFormat(format))
+
+	details, err := GetBackupDetails(readHistory(), timestamp)
+	gplog.FatalOnError(err)
+	if format == FORMAT_JSON {
+		gplog.FatalOnError(PrintJSON(writer, details))
+	} else {
+		gplog.FatalOnError(PrintBackupDetails(writer, details))
+	}
+}
@@ -0,0 +1,147 @@
+package manager_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/backup_history"
+	"github.com/greenplum-db/gpbackup/manager"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("manager/catalog tests", func() {
+	history := &backup_history.History{BackupConfigs: []backup_history.BackupConfig{
+		{DatabaseName: "testdb", Timestamp: "20170103010101", Incremental: true, Status: backup_history.BACKUP_STATUS_FAILURE,
+			RestorePlan: []backup_history.RestorePlanEntry{{Timestamp: "20170101010101", TableFQNs: []string{"public.foo"}}, {Timestamp: "20170103010101", TableFQNs: []string{"public.bar", "public.baz"}}}},
+		{DatabaseName: `"TestDB"`, Timestamp: "20170102010101", Plugin: "/usr/local/bin/gpbackup_s3_plugin"},
+		{DatabaseName: "testdb", Timestamp: "20170101010101", Status: backup_history.BACKUP_STATUS_SUCCESS,
+			Metrics: backup_history.BackupMetrics{EndTime: "2017-01-01 02:03:04.000", DurationSeconds: 3723, TableCount: 2, TotalBytes: 1536}},
+	}}
+	timestampsOf := func(backupConfigs []backup_history.BackupConfig) []string {
+		timestamps := make([]string, 0)
+		for _, backupConfig := range backupConfigs {
+			timestamps = append(timestamps, backupConfig.Timestamp)
+		}
+		return timestamps
+	}
+	Describe("FilterBackups", func() {
+		It("returns all backups when no filters are given", func() {
+			Expect(timestampsOf(manager.FilterBackups(history, manager.BackupFilter{}))).To(Equal([]string{"20170103010101", "20170102010101", "20170101010101"}))
+		})
+		It("filters by database, matching quoted database names", func() {
+			Expect(timestampsOf(manager.FilterBackups(history, manager.BackupFilter{DatabaseName: "testdb"}))).To(Equal([]string{"20170103010101", "20170101010101"}))
+			Expect(timestampsOf(manager.FilterBackups(history, manager.BackupFilter{DatabaseName: "TestDB"}))).To(Equal([]string{"20170102010101"}))
+		})
+		It("filters by date range", func() {
+			Expect(timestampsOf(manager.FilterBackups(history, manager.BackupFilter{After: "20170102", Before: "20170103"}))).To(Equal([]string{"20170102010101"}))
+			Expect(timestampsOf(manager.FilterBackups(history, manager.BackupFilter{After: "20170102010101"}))).To(Equal([]string{"20170103010101", "20170102010101"}))
+		})
+		It("filters by plugin path or name", func() {
+			Expect(timestampsOf(manager.FilterBackups(history, manager.BackupFilter{Plugin: "gpbackup_s3_plugin"}))).To(Equal([]string{"20170102010101"}))
+			Expect(timestampsOf(manager.FilterBackups(history, manager.BackupFilter{Plugin: "/usr/local/bin/gpbackup_s3_plugin"}))).To(Equal([]string{"20170102010101"}))
+		})
+		It("filters by backup type", func() {
+			Expect(timestampsOf(manager.FilterBackups(history, manager.BackupFilter{BackupType: "incremental"}))).To(Equal([]string{"20170103010101"}))
+			Expect(timestampsOf(manager.FilterBackups(history, manager.BackupFilter{BackupType: "full"}))).To(Equal([]string{"20170102010101", "20170101010101"}))
+		})
+		It("filters by status, treating entries without a status as successful", func() {
+			Expect(timestampsOf(manager.FilterBackups(history, manager.BackupFilter{Status: "success"}))).To(Equal([]string{"20170102010101", "20170101010101"}))
+			Expect(timestampsOf(manager.FilterBackups(history, manager.BackupFilter{Status: "Failure"}))).To(Equal([]string{"20170103010101"}))
+		})
+	})
+	Describe("GetBackupType", func() {
+		It("reports differential backups, which are also incremental, as differential", func() {
+			Expect(manager.GetBackupType(&backup_history.BackupConfig{})).To(Equal("full"))
+			Expect(manager.GetBackupType(&backup_history.BackupConfig{Incremental: true})).To(Equal("incremental"))
+			Expect(manager.GetBackupType(&backup_history.BackupConfig{Incremental: true, Differential: true})).To(Equal("differential"))
+		})
+	})
+	Describe("ValidateBackupFilter", func() {
+		It("accepts valid filters", func() {
+			Expect(manager.ValidateBackupFilter(manager.BackupFilter{After: "20170101", Before: "20170101010101", BackupType: "full", Status: "failure"})).To(Succeed())
+		})
+		It("rejects an invalid date", func() {
+			err := manager.ValidateBackupFilter(manager.BackupFilter{After: "2017-01-01"})
+			Expect(err).To(MatchError("Date 2017-01-01 is invalid.  Dates must be in the format YYYYMMDD or YYYYMMDDHHMMSS."))
+		})
+		It("rejects an invalid type or status", func() {
+			Expect(manager.ValidateBackupFilter(manager.BackupFilter{BackupType: "synthetic"})).ToNot(Succeed())
+			Expect(manager.ValidateBackupFilter(manager.BackupFilter{Status: "running"})).ToNot(Succeed())
+		})
+	})
+	Describe("PrintBackupTable", func() {
+		It("prints one row per backup, with metrics where they were recorded", func() {
+			buffer := gbytes.NewBuffer()
+			manager.PrintBackupTable(buffer, history.BackupConfigs)
+			Expect(string(buffer.Contents())).To(Equal(`TIMESTAMP       DATABASE  TYPE         STATUS   PLUGIN              TABLES  SIZE    DURATION
+20170103010101  testdb    incremental  Failure  -                   -       -       -
+20170102010101  "TestDB"  full         Success  gpbackup_s3_plugin  -       -       -
+20170101010101  testdb    full         Success  -                   2       1.5 KB  1:02:03
+`))
+		})
+	})
+	Describe("PrintJSON", func() {
+		It("prints the backups as a JSON array", func() {
+			buffer := gbytes.NewBuffer()
+			Expect(manager.PrintJSON(buffer, manager.FilterBackups(history, manager.BackupFilter{BackupType: "incremental"}))).To(Succeed())
+			backupConfigs := make([]backup_history.BackupConfig, 0)
+			Expect(json.Unmarshal(buffer.Contents(), &backupConfigs)).To(Succeed())
+			Expect(backupConfigs).To(Equal(history.BackupConfigs[:1]))
+		})
+	})
+	Describe("GetRestorePlanChain", func() {
+		It("lists each backup in the restore plan with its status and number of tables", func() {
+			chain := manager.GetRestorePlanChain(history, &history.BackupConfigs[0])
+			Expect(chain).To(Equal([]manager.RestorePlanChainEntry{
+				{Timestamp: "20170101010101", Status: "Success", TableCount: 1},
+				{Timestamp: "20170103010101", Status: "Failure", TableCount: 2},
+			}))
+		})
+	})
+	Describe("ParseObjectCounts", func() {
+		It("reads the object counts from a backup report", func() {
+			report := `Greenplum Database Backup Report
+
+Backup Status: Success
+
+Count of Database Objects in Backup:
+Resource Queues              1
+Tables                       12
+`
+			Expect(manager.ParseObjectCounts(report)).To(Equal(map[string]int{"Resource Queues": 1, "Tables": 12}))
+		})
+		It("returns no counts for a report without them", func() {
+			Expect(manager.ParseObjectCounts("Backup Status: Success")).To(BeEmpty())
+		})
+	})
+	Describe("GetBackupDetails", func() {
+		var masterDataDir string
+		BeforeEach(func() {
+			masterDataDir, _ = ioutil.TempDir("", "catalog")
+			operating.System.Getenv = func(key string) string { return masterDataDir }
+		})
+		AfterEach(func() {
+			operating.System = operating.InitializeSystemFunctions()
+			_ = os.RemoveAll(masterDataDir)
+		})
+		It("includes the object counts from the backup report", func() {
+			reportDir := path.Join(masterDataDir, "backups", "20170101", "20170101010101")
+			_ = os.MkdirAll(reportDir, 0755)
+			_ = ioutil.WriteFile(path.Join(reportDir, "gpbackup_20170101010101_report"), []byte("Count of Database Objects in Backup:\nTables                       2\n"), 0644)
+
+			details, err := manager.GetBackupDetails(history, "20170101010101")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(details.BackupConfig).To(Equal(history.BackupConfigs[2]))
+			Expect(details.ObjectCounts).To(Equal(map[string]int{"Tables": 2}))
+		})
+		It("returns an error for a backup that is not in the history", func() {
+			_, err := manager.GetBackupDetails(history, "20170104010101")
+			Expect(err).To(MatchError("Backup 20170104010101 was not found in the backup history"))
+		})
+	})
+})
@@ -0,0 +1,154 @@
+package manager
+
+/*
+ * This file contains functions for deleting backups and marking them deleted
+ * in the backup history file.
+ */
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/backup_filepath"
+	"github.com/greenplum-db/gpbackup/backup_history"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+func DoDeleteBackup() {
+	timestamp := MustGetFlagString(utils.TIMESTAMP)
+	if !backup_filepath.IsValidTimestamp(timestamp) {
+		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", timestamp), "")
+	}
+	err := utils.ValidateFullPath(MustGetFlagString(utils.ENCRYPTION_KEY_FILE))
+	gplog.FatalOnError(err)
+	err = utils.InitializeEncryption(MustGetFlagString(utils.ENCRYPTION_KEY_FILE))
+	gplog.FatalOnError(err)
+
+	history := readHistory()
+	backupConfig := history.FindBackupConfig(timestamp)
+	if backupConfig == nil {
+		gplog.Fatal(errors.Errorf("Backup %s was not found in the backup history", timestamp), "")
+	}
+	if backupConfig.Deleted {
+		gplog.Info("Backup %s has already been deleted", timestamp)
+		return
+	}
+	CheckBackupCanBeDeleted(history, timestamp, MustGetFlagBool(utils.FORCE))
+
+	var pluginConfig *utils.PluginConfig
+	if backupConfig.Plugin != "" {
+		pluginConfig = readPluginConfigForDelete(backupConfig)
+	}
+	err = DeleteBackup(backupConfig, pluginConfig)
+	gplog.FatalOnError(err)
+	err = backup_history.MarkBackupDeleted(GetHistoryFilePath(), timestamp)
+	gplog.FatalOnError(err)
+	gplog.Info("Backup %s deleted", timestamp)
+}
+
+/*
+ * Deleting a backup that a later incremental backup still needs would leave
+ * that backup impossible to restore, so it is only done when forced.
+ */
+func CheckBackupCanBeDeleted(history *backup_history.History, timestamp string, force bool) {
+	dependents := history.GetDependentBackups(timestamp)
+	if len(dependents) == 0 {
+		return
+	}
+	if !force {
+		gplog.Fatal(errors.Errorf("Backup %s is needed to restore the incremental backup(s) %s.  Delete those backups first, or use --%s to delete it anyway.",
+			timestamp, strings.Join(dependents, ", "), utils.FORCE), "")
+	}
+	gplog.Warn("Deleting backup %s, which is needed to restore the incremental backup(s) %s; those backups can no longer be restored", timestamp, strings.Join(dependents, ", "))
+}
+
+func readPluginConfigForDelete(backupConfig *backup_history.BackupConfig) *utils.PluginConfig {
+	pluginConfigFile := MustGetFlagString(utils.PLUGIN_CONFIG)
+	if pluginConfigFile == "" {
+		gplog.Fatal(errors.Errorf("Backup %s was taken with plugin %s.  The --%s flag is required to delete it.", backupConfig.Timestamp, backupConfig.Plugin, utils.PLUGIN_CONFIG), "")
+	}
+	return readLocalPluginConfig(pluginConfigFile)
+}
+
+func readLocalPluginConfig(pluginConfigFile string) *utils.PluginConfig {
+	pluginConfig, err := utils.ReadPluginConfig(pluginConfigFile)
+	gplog.FatalOnError(err)
+	// The plugin only runs on the master, so it can read the config file where it is
+	pluginConfig.ConfigPath = pluginConfigFile
+	return pluginConfig
+}
+
+/*
+ * The TOC records the segment configuration needed to find the backup
+ * directories on the segments.  Legacy backups and backups that failed before
+ * writing a TOC do not record one, so the segment configuration of the live
+ * cluster is used for them instead.  Plugin backups keep their data with the
+ * plugin, so without a TOC only the local master files can be removed.
+ */
+func DeleteBackup(backupConfig *backup_history.BackupConfig, pluginConfig *utils.PluginConfig) error {
+	timestamp := backupConfig.Timestamp
+	masterFPInfo := GetMasterFilePathInfo(backupConfig.BackupDir, timestamp)
+	if pluginConfig != nil {
+		gplog.Info("Deleting files for backup %s with plugin %s", timestamp, pluginConfig.ExecutablePath)
+		err := pluginConfig.DeleteBackup(timestamp)
+		if err != nil {
+			return err
+		}
+	}
+
+	tocFilename := masterFPInfo.GetTOCFilePath()
+	var segConfig []cluster.SegConfig
+	if iohelper.FileExistsAndIsReadable(tocFilename) {
+		segConfig = utils.NewTOC(tocFilename).SegmentConfig
+	}
+	if len(segConfig) == 0 {
+		if pluginConfig != nil {
+			gplog.Info("Deleting local files for backup %s", timestamp)
+			return os.RemoveAll(masterFPInfo.GetDirForContent(-1))
+		}
+		gplog.Verbose("Backup %s does not record the segment configuration of its cluster, so the current segment configuration is used to locate its files", timestamp)
+		var clusterID string
+		segConfig, clusterID = getCurrentSegmentConfiguration()
+		if !backupConfig.MatchesCluster(clusterID) {
+			return errors.Errorf("Backup %s was taken on cluster %s, so its files cannot be located from this cluster (%s).", timestamp, backupConfig.ClusterID, clusterID)
+		}
+	}
+
+	globalCluster = cluster.NewCluster(segConfig)
+	fpInfo := backup_filepath.NewFilePathInfo(globalCluster, backupConfig.BackupDir, timestamp, masterFPInfo.UserSpecifiedSegPrefix)
+	return DeleteBackupFilesOnAllHosts(fpInfo)
+}
+
+func getCurrentSegmentConfiguration() ([]cluster.SegConfig, string) {
+	conn := dbconn.NewDBConnFromEnvironment("postgres")
+	conn.MustConnect(1)
+	defer conn.Close()
+	segConfig := cluster.MustGetSegmentConfiguration(conn)
+	return segConfig, backup_history.GetClusterID(cluster.NewCluster(segConfig).GetHostForContent(-1), conn.Port)
+}
+
+func GetDeleteBackupDirectoryCommand(backupDir string) string {
+	// The date directory above the backup directory is removed only once it is empty
+	return fmt.Sprintf("rm -rf %s && (rmdir %s 2>/dev/null || true)", backupDir, path.Dir(backupDir))
+}
+
+func DeleteBackupFilesOnAllHosts(fpInfo backup_filepath.FilePathInfo) error {
+	gplog.Info("Deleting files for backup %s on master and segments", fpInfo.Timestamp)
+	remoteOutput := globalCluster.GenerateAndExecuteCommand("Deleting backup files", func(contentID int) string {
+		return GetDeleteBackupDirectoryCommand(fpInfo.GetDirForContent(contentID))
+	}, cluster.ON_SEGMENTS_AND_MASTER)
+	globalCluster.CheckClusterError(remoteOutput, "Unable to delete backup files", func(contentID int) string {
+		return fmt.Sprintf("Unable to delete backup files for segment %d on host %s", contentID, globalCluster.GetHostForContent(contentID))
+	}, true)
+	if remoteOutput.NumErrors > 0 {
+		return errors.Errorf("Unable to delete the files for backup %s on %d segment(s).  See %s for details.", fpInfo.Timestamp, remoteOutput.NumErrors, gplog.GetLogFilePath())
+	}
+	return nil
+}
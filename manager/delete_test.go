@@ -0,0 +1,42 @@
+package manager_test
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/backup_history"
+	"github.com/greenplum-db/gpbackup/manager"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("manager/delete tests", func() {
+	history := &backup_history.History{BackupConfigs: []backup_history.BackupConfig{
+		{Timestamp: "20170104010101", Incremental: true, Status: backup_history.BACKUP_STATUS_FAILURE,
+			RestorePlan: []backup_history.RestorePlanEntry{{Timestamp: "20170101010101"}, {Timestamp: "20170104010101"}}},
+		{Timestamp: "20170103010101", Incremental: true, Deleted: true,
+			RestorePlan: []backup_history.RestorePlanEntry{{Timestamp: "20170101010101"}, {Timestamp: "20170103010101"}}},
+		{Timestamp: "20170102010101", Incremental: true,
+			RestorePlan: []backup_history.RestorePlanEntry{{Timestamp: "20170101010101"}, {Timestamp: "20170102010101"}}},
+		{Timestamp: "20170101010101",
+			RestorePlan: []backup_history.RestorePlanEntry{{Timestamp: "20170101010101"}}},
+	}}
+	Describe("CheckBackupCanBeDeleted", func() {
+		It("allows deleting a backup that no other backup needs", func() {
+			manager.CheckBackupCanBeDeleted(history, "20170102010101", false)
+		})
+		It("refuses to delete a backup that a later incremental backup needs", func() {
+			defer testhelper.ShouldPanicWithMessage("Backup 20170101010101 is needed to restore the incremental backup(s) 20170102010101.  Delete those backups first, or use --force to delete it anyway.")
+			manager.CheckBackupCanBeDeleted(history, "20170101010101", false)
+		})
+		It("deletes a backup that a later incremental backup needs when forced", func() {
+			manager.CheckBackupCanBeDeleted(history, "20170101010101", true)
+			Expect(testLogfile).To(gbytes.Say("Deleting backup 20170101010101, which is needed to restore the incremental backup"))
+		})
+	})
+	Describe("GetDeleteBackupDirectoryCommand", func() {
+		It("removes the backup directory and its date directory once empty", func() {
+			command := manager.GetDeleteBackupDirectoryCommand("/data/gpseg0/backups/20170101/20170101010101")
+			Expect(command).To(Equal("rm -rf /data/gpseg0/backups/20170101/20170101010101 && (rmdir /data/gpseg0/backups/20170101 2>/dev/null || true)"))
+		})
+	})
+})
@@ -0,0 +1,242 @@
+package manager
+
+/*
+ * This file contains the subcommand definitions for gpbackup_manager, which
+ * operates on existing backups rather than on a database.
+ */
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// This function handles setup that can be done before parsing flags.
+func DoInit(cmd *cobra.Command) {
+	CleanupGroup = &sync.WaitGroup{}
+	CleanupGroup.Add(1)
+	gplog.InitializeLogging("gpbackup_manager", "")
+	SetPersistentFlagDefaults(cmd.PersistentFlags())
+	cmd.AddCommand(newVerifyBackupCommand(), newListBackupsCommand(), newShowBackupCommand(), newDeleteBackupCommand(), newApplyRetentionCommand(), newRebuildHistoryCommand(), newSynthesizeFullCommand())
+	utils.InitializeSignalHandler(DoCleanup, "gpbackup_manager process", &wasTerminated)
+}
+
+func SetPersistentFlagDefaults(flagSet *pflag.FlagSet) {
+	flagSet.Bool(utils.DEBUG, false, "Print verbose and debug log messages")
+	flagSet.String(utils.HISTORY_FILE, "", "The absolute path of the backup history file. Defaults to gpbackup_history.yaml in the master data directory.")
+	flagSet.Bool(utils.QUIET, false, "Suppress non-warning, non-error log messages")
+	flagSet.Bool(utils.VERBOSE, false, "Print verbose log messages")
+}
+
+func newVerifyBackupCommand() *cobra.Command {
+	verifyCmd := &cobra.Command{
+		Use:   "verify-backup",
+		Short: "Verify that every file in a backup set is present, readable, and uncorrupted, without connecting to a database",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			defer DoTeardown()
+			cmdFlags = cmd.Flags()
+			SetLoggerVerbosity()
+			DoVerify()
+		}}
+	SetVerifyFlagDefaults(verifyCmd.Flags())
+	_ = verifyCmd.MarkFlagRequired(utils.TIMESTAMP)
+	return verifyCmd
+}
+
+func SetVerifyFlagDefaults(flagSet *pflag.FlagSet) {
+	flagSet.String(utils.BACKUP_DIR, "", "The absolute path of the directory in which the backup files to be verified are located")
+	flagSet.String(utils.ENCRYPTION_KEY_FILE, "", "The absolute path of a file, present on all hosts, containing the key with which the backup was encrypted")
+	flagSet.String(utils.TIMESTAMP, "", "The timestamp of the backup to be verified, in the format YYYYMMDDHHMMSS")
+}
+
+func newListBackupsCommand() *cobra.Command {
+	listCmd := &cobra.Command{
+		Use:   "list-backups",
+		Short: "List the backups recorded in the backup history file, optionally filtered",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			defer DoTeardown()
+			cmdFlags = cmd.Flags()
+			SetLoggerVerbosity()
+			DoListBackups(os.Stdout)
+		}}
+	SetListBackupsFlagDefaults(listCmd.Flags())
+	return listCmd
+}
+
+func SetListBackupsFlagDefaults(flagSet *pflag.FlagSet) {
+	flagSet.String(utils.AFTER, "", "Only list backups taken on or after this date or timestamp, in the format YYYYMMDD or YYYYMMDDHHMMSS")
+	flagSet.String(utils.BACKUP_TYPE, "", "Only list backups of this type, either 'full', 'incremental', or 'differential'")
+	flagSet.String(utils.BEFORE, "", "Only list backups taken before this date or timestamp, in the format YYYYMMDD or YYYYMMDDHHMMSS")
+	flagSet.String(utils.DBNAME, "", "Only list backups of this database")
+	flagSet.String(utils.FORMAT, FORMAT_TABLE, "The output format, either 'table' or 'json'")
+	flagSet.String(utils.PLUGIN, "", "Only list backups taken with this plugin, given as the path or name of the plugin executable")
+	flagSet.String(utils.STATUS, "", "Only list backups with this status, either 'success' or 'failure'")
+}
+
+func newShowBackupCommand() *cobra.Command {
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show the configuration, restore plan, and object counts of a backup recorded in the backup history file",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			defer DoTeardown()
+			cmdFlags = cmd.Flags()
+			SetLoggerVerbosity()
+			DoShowBackup(os.Stdout, MustGetFlagString(utils.TIMESTAMP))
+		}}
+	SetShowBackupFlagDefaults(showCmd.Flags())
+	_ = showCmd.MarkFlagRequired(utils.TIMESTAMP)
+	return showCmd
+}
+
+func SetShowBackupFlagDefaults(flagSet *pflag.FlagSet) {
+	flagSet.String(utils.FORMAT, FORMAT_TABLE, "The output format, either 'table' or 'json'")
+	flagSet.String(utils.TIMESTAMP, "", "The timestamp of the backup to be shown, in the format YYYYMMDDHHMMSS")
+}
+
+func newDeleteBackupCommand() *cobra.Command {
+	deleteCmd := &cobra.Command{
+		Use:   "delete-backup",
+		Short: "Delete the files of a backup from the master and all segments, or from the plugin destination, and mark it deleted in the backup history file",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			defer DoTeardown()
+			cmdFlags = cmd.Flags()
+			SetLoggerVerbosity()
+			DoDeleteBackup()
+		}}
+	SetDeleteBackupFlagDefaults(deleteCmd.Flags())
+	_ = deleteCmd.MarkFlagRequired(utils.TIMESTAMP)
+	return deleteCmd
+}
+
+func SetDeleteBackupFlagDefaults(flagSet *pflag.FlagSet) {
+	flagSet.String(utils.ENCRYPTION_KEY_FILE, "", "The absolute path of a file containing the key with which the backup was encrypted, needed to read its table of contents")
+	flagSet.Bool(utils.FORCE, false, "Delete the backup even if a later incremental backup still needs it to be restored")
+	flagSet.String(utils.PLUGIN_CONFIG, "", "The configuration file of the plugin with which the backup was taken")
+	flagSet.String(utils.TIMESTAMP, "", "The timestamp of the backup to be deleted, in the format YYYYMMDDHHMMSS")
+}
+
+func newApplyRetentionCommand() *cobra.Command {
+	retentionCmd := &cobra.Command{
+		Use:   "apply-retention",
+		Short: "Delete the backups recorded in the backup history file that fall outside a retention policy",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			defer DoTeardown()
+			cmdFlags = cmd.Flags()
+			SetLoggerVerbosity()
+			DoApplyRetention(os.Stdout)
+		}}
+	SetApplyRetentionFlagDefaults(retentionCmd.Flags())
+	return retentionCmd
+}
+
+func SetApplyRetentionFlagDefaults(flagSet *pflag.FlagSet) {
+	flagSet.String(utils.DBNAME, "", "Only apply the retention policy to backups of this database")
+	flagSet.Bool(utils.DRY_RUN, false, "List the backups that fall outside the retention policy without deleting them")
+	flagSet.String(utils.ENCRYPTION_KEY_FILE, "", "The absolute path of a file containing the key with which the backups were encrypted, needed to read their tables of contents")
+	flagSet.Int(utils.KEEP_DAYS, 0, "Keep every backup taken within this many days")
+	flagSet.Int(utils.KEEP_FULL, 0, "Keep this many of the most recent successful full backups of each database, along with the incremental backups based on them")
+	flagSet.String(utils.PLUGIN_CONFIG, "", "The configuration file of the plugin with which the backups were taken")
+}
+
+func newRebuildHistoryCommand() *cobra.Command {
+	rebuildCmd := &cobra.Command{
+		Use:   "rebuild-history",
+		Short: "Rebuild the backup history file from the configuration files of the backups on disk",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			defer DoTeardown()
+			cmdFlags = cmd.Flags()
+			SetLoggerVerbosity()
+			DoRebuildHistory()
+		}}
+	SetRebuildHistoryFlagDefaults(rebuildCmd.Flags())
+	return rebuildCmd
+}
+
+func SetRebuildHistoryFlagDefaults(flagSet *pflag.FlagSet) {
+	flagSet.StringSlice(utils.BACKUP_DIR, []string{}, "A backup directory, given to gpbackup with --backup-dir, in which to look for backups in addition to the master data directory. --backup-dir can be specified multiple times.")
+	flagSet.String(utils.PLUGIN_CONFIG, "", "The configuration file of a plugin with which to fetch the config, TOC, and report files of plugin backups that are not on disk")
+	flagSet.StringSlice(utils.TIMESTAMP, []string{}, "The timestamp of a plugin backup with no files on disk to fetch with --plugin-config, in the format YYYYMMDDHHMMSS. --timestamp can be specified multiple times.")
+}
+
+func newSynthesizeFullCommand() *cobra.Command {
+	synthesizeCmd := &cobra.Command{
+		Use:   "synthesize-full",
+		Short: "Consolidate an incremental backup and the backups in its restore plan into a new full backup, without connecting to a database",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			defer DoTeardown()
+			cmdFlags = cmd.Flags()
+			SetLoggerVerbosity()
+			DoSynthesizeFull()
+		}}
+	SetSynthesizeFullFlagDefaults(synthesizeCmd.Flags())
+	_ = synthesizeCmd.MarkFlagRequired(utils.TIMESTAMP)
+	return synthesizeCmd
+}
+
+func SetSynthesizeFullFlagDefaults(flagSet *pflag.FlagSet) {
+	flagSet.String(utils.ENCRYPTION_KEY_FILE, "", "The absolute path of a file containing the key with which the backups were encrypted, needed to read and write their tables of contents")
+	flagSet.String(utils.TIMESTAMP, "", "The timestamp of the incremental backup to be consolidated, in the format YYYYMMDDHHMMSS")
+}
+
+func SetLoggerVerbosity() {
+	if MustGetFlagBool(utils.QUIET) {
+		gplog.SetVerbosity(gplog.LOGERROR)
+	} else if MustGetFlagBool(utils.DEBUG) {
+		gplog.SetVerbosity(gplog.LOGDEBUG)
+	} else if MustGetFlagBool(utils.VERBOSE) {
+		gplog.SetVerbosity(gplog.LOGVERBOSE)
+	}
+}
+
+func DoTeardown() {
+	defer func() {
+		DoCleanup()
+		os.Exit(gplog.GetErrorCode())
+	}()
+
+	if err := recover(); err != nil {
+		// Check if gplog.Fatal did not cause the panic
+		if gplog.GetErrorCode() != 2 {
+			gplog.Error(fmt.Sprintf("%v: %s", err, debug.Stack()))
+			gplog.SetErrorCode(2)
+		} else {
+			fmt.Println(err)
+		}
+	}
+	if wasTerminated {
+		// The signal handler will take care of cleanup and return codes.
+		CleanupGroup.Wait()
+	}
+}
+
+func DoCleanup() {
+	defer func() {
+		if err := recover(); err != nil {
+			gplog.Warn("Encountered error during cleanup: %v", err)
+		}
+		gplog.Verbose("Cleanup complete")
+		CleanupGroup.Done()
+	}()
+
+	gplog.Verbose("Beginning cleanup")
+	for _, fpInfo := range helperFPInfoList {
+		utils.CleanUpHelperFilesOnAllHosts(globalCluster, fpInfo)
+	}
+}
+
+func GetVersion() string {
+	return version
+}
@@ -0,0 +1,25 @@
+package manager_test
+
+import (
+	"testing"
+
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var (
+	testStdout  *gbytes.Buffer
+	testStderr  *gbytes.Buffer
+	testLogfile *gbytes.Buffer
+)
+
+func TestManager(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Manager Suite")
+}
+
+var _ = BeforeSuite(func() {
+	testStdout, testStderr, testLogfile = testhelper.SetupTestLogger()
+})
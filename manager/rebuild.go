@@ -0,0 +1,129 @@
+package manager
+
+/*
+ * This file contains functions for rebuilding the backup history file from
+ * the configuration files of the backups on disk.
+ */
+
+import (
+	"path"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/backup_filepath"
+	"github.com/greenplum-db/gpbackup/backup_history"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * Returns the timestamps of the backups whose master backup directories are
+ * under the given backup directory, or under the master data directory if no
+ * backup directory is given, following the layout in backup_filepath.
+ */
+func FindBackupTimestamps(backupDir string) []string {
+	pattern := path.Join(backupDir, "*-1", "backups", "*", "*")
+	if backupDir == "" {
+		pattern = path.Join(operating.System.Getenv("MASTER_DATA_DIRECTORY"), "backups", "*", "*")
+	}
+	backupDirs, err := operating.System.Glob(pattern)
+	gplog.FatalOnError(err)
+	timestamps := make([]string, 0)
+	for _, dir := range backupDirs {
+		timestamp := path.Base(dir)
+		if backup_filepath.IsValidTimestamp(timestamp) && path.Base(path.Dir(dir)) == timestamp[0:8] {
+			timestamps = append(timestamps, timestamp)
+		}
+	}
+	return timestamps
+}
+
+/*
+ * A backup is recorded from its config file alone, which gpbackup writes for
+ * failed backups as well as successful ones.  The report file is written
+ * after the config file, so a backup without one did not finish and is
+ * recorded as failed.  With a plugin, the config and report files are fetched
+ * from the plugin destination if they are not on disk.
+ */
+func ReadBackupConfigForHistory(fpInfo backup_filepath.FilePathInfo, pluginConfig *utils.PluginConfig) (*backup_history.BackupConfig, error) {
+	configFilename := fpInfo.GetConfigFilePath()
+	if err := fetchBackupFile(configFilename, pluginConfig); err != nil {
+		return nil, err
+	}
+	backupConfig, err := backup_history.LoadConfigFile(configFilename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot read config file %s", configFilename)
+	}
+	if backupConfig.Timestamp == "" {
+		backupConfig.Timestamp = fpInfo.Timestamp
+	}
+	reportFilename := fpInfo.GetBackupReportFilePath()
+	if err := fetchBackupFile(reportFilename, pluginConfig); err != nil {
+		gplog.Verbose("Recording backup %s as failed: %v", fpInfo.Timestamp, err)
+		backupConfig.Status = backup_history.BACKUP_STATUS_FAILURE
+		if backupConfig.ErrorMessage == "" {
+			backupConfig.ErrorMessage = "The backup did not finish writing its report file."
+		}
+	}
+	return backupConfig, nil
+}
+
+func fetchBackupFile(filename string, pluginConfig *utils.PluginConfig) error {
+	if iohelper.FileExistsAndIsReadable(filename) {
+		return nil
+	}
+	if pluginConfig != nil {
+		return pluginConfig.RestoreFile(filename)
+	}
+	return errors.Errorf("Cannot access %s", filename)
+}
+
+func DoRebuildHistory() {
+	backupDirs := MustGetFlagStringSlice(utils.BACKUP_DIR)
+	for _, backupDir := range backupDirs {
+		gplog.FatalOnError(utils.ValidateFullPath(backupDir))
+	}
+	pluginTimestamps := MustGetFlagStringSlice(utils.TIMESTAMP)
+	var pluginConfig *utils.PluginConfig
+	if pluginConfigFile := MustGetFlagString(utils.PLUGIN_CONFIG); pluginConfigFile != "" {
+		pluginConfig = readLocalPluginConfig(pluginConfigFile)
+	} else if len(pluginTimestamps) > 0 {
+		gplog.Fatal(errors.Errorf("--%s must be specified with --%s", utils.PLUGIN_CONFIG, utils.TIMESTAMP), "")
+	}
+	for _, timestamp := range pluginTimestamps {
+		if !backup_filepath.IsValidTimestamp(timestamp) {
+			gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", timestamp), "")
+		}
+	}
+	historyFilename := GetHistoryFilePath()
+
+	history := &backup_history.History{BackupConfigs: make([]backup_history.BackupConfig, 0)}
+	addBackup := func(backupDir string, timestamp string) {
+		if wasTerminated || history.FindBackupConfig(timestamp) != nil {
+			return
+		}
+		backupConfig, err := ReadBackupConfigForHistory(GetMasterFilePathInfo(backupDir, timestamp), pluginConfig)
+		if err != nil {
+			gplog.Warn("Skipping backup %s: %v", timestamp, err)
+			return
+		}
+		gplog.Verbose("Found backup %s of database %s", timestamp, backupConfig.DatabaseName)
+		history.AddBackupConfig(backupConfig)
+	}
+	for _, backupDir := range append([]string{""}, backupDirs...) {
+		for _, timestamp := range FindBackupTimestamps(backupDir) {
+			addBackup(backupDir, timestamp)
+		}
+	}
+	for _, timestamp := range pluginTimestamps {
+		addBackup("", timestamp)
+	}
+	if wasTerminated {
+		return
+	}
+
+	err := history.RewriteHistoryFile(historyFilename)
+	gplog.FatalOnError(err)
+	gplog.Info("Rebuilt history file %s with %d backup(s)", historyFilename, len(history.BackupConfigs))
+}
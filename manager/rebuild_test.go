@@ -0,0 +1,82 @@
+package manager_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/backup_filepath"
+	"github.com/greenplum-db/gpbackup/manager"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("manager/rebuild tests", func() {
+	var (
+		masterDataDir string
+		fpInfo        backup_filepath.FilePathInfo
+	)
+	BeforeEach(func() {
+		masterDataDir, _ = ioutil.TempDir("", "rebuild")
+		operating.System.Getenv = func(key string) string { return masterDataDir }
+		fpInfo = backup_filepath.FilePathInfo{SegDirMap: map[int]string{-1: masterDataDir}, Timestamp: "20170101010101"}
+		_ = os.MkdirAll(fpInfo.GetDirForContent(-1), 0755)
+		_ = ioutil.WriteFile(fpInfo.GetConfigFilePath(), []byte("databasename: testdb\ntimestamp: \"20170101010101\"\n"), 0644)
+		_ = ioutil.WriteFile(fpInfo.GetTOCFilePath(), []byte("dataentries: []\n"), 0644)
+		_ = ioutil.WriteFile(fpInfo.GetBackupReportFilePath(), []byte("report"), 0644)
+	})
+	AfterEach(func() {
+		operating.System = operating.InitializeSystemFunctions()
+		_ = os.RemoveAll(masterDataDir)
+	})
+	Describe("FindBackupTimestamps", func() {
+		It("finds the backups in the master data directory", func() {
+			_ = os.MkdirAll(path.Join(masterDataDir, "backups", "20170102", "20170102010101"), 0755)
+			_ = os.MkdirAll(path.Join(masterDataDir, "backups", "20170102", "not_a_backup"), 0755)
+
+			Expect(manager.FindBackupTimestamps("")).To(Equal([]string{"20170101010101", "20170102010101"}))
+		})
+		It("finds the backups in a backup directory", func() {
+			backupDir := path.Join(masterDataDir, "backup_dir")
+			_ = os.MkdirAll(path.Join(backupDir, "gpseg-1", "backups", "20170103", "20170103010101"), 0755)
+
+			Expect(manager.FindBackupTimestamps(backupDir)).To(Equal([]string{"20170103010101"}))
+		})
+	})
+	Describe("ReadBackupConfigForHistory", func() {
+		It("reads the config of a complete backup", func() {
+			backupConfig, err := manager.ReadBackupConfigForHistory(fpInfo, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(backupConfig.DatabaseName).To(Equal("testdb"))
+			Expect(backupConfig.Timestamp).To(Equal("20170101010101"))
+		})
+		It("reads the config of a backup without a TOC file", func() {
+			_ = os.Remove(fpInfo.GetTOCFilePath())
+
+			backupConfig, err := manager.ReadBackupConfigForHistory(fpInfo, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(backupConfig.Failed()).To(BeFalse())
+		})
+		It("records a backup without a report file as failed", func() {
+			_ = os.Remove(fpInfo.GetBackupReportFilePath())
+
+			backupConfig, err := manager.ReadBackupConfigForHistory(fpInfo, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(backupConfig.Failed()).To(BeTrue())
+			Expect(backupConfig.ErrorMessage).To(Equal("The backup did not finish writing its report file."))
+		})
+		It("skips a backup without a config file", func() {
+			_ = os.Remove(fpInfo.GetConfigFilePath())
+
+			_, err := manager.ReadBackupConfigForHistory(fpInfo, nil)
+			Expect(err).To(MatchError("Cannot access " + fpInfo.GetConfigFilePath()))
+		})
+		It("skips a backup with a corrupted config file", func() {
+			_ = ioutil.WriteFile(fpInfo.GetConfigFilePath(), []byte("{{{"), 0644)
+
+			_, err := manager.ReadBackupConfigForHistory(fpInfo, nil)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
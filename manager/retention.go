@@ -0,0 +1,181 @@
+package manager
+
+/*
+ * This file contains functions for deleting the backups that fall outside a
+ * retention policy.
+ */
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/backup_history"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * A backup is kept if any policy keeps it: it is one of the KeepFull most
+ * recent successful full backups of its database on its cluster, it is an incremental backup
+ * based on one of those, or it was taken within the last KeepDays days.  A
+ * policy set to 0 keeps nothing.
+ */
+type RetentionPolicy struct {
+	DatabaseName string
+	KeepFull     int
+	KeepDays     int
+}
+
+func ValidateRetentionPolicy(policy RetentionPolicy) error {
+	if policy.KeepFull < 0 || policy.KeepDays < 0 {
+		return errors.Errorf("--%s and --%s must not be negative", utils.KEEP_FULL, utils.KEEP_DAYS)
+	}
+	if policy.KeepFull == 0 && policy.KeepDays == 0 {
+		return errors.Errorf("At least one of --%s and --%s must be specified", utils.KEEP_FULL, utils.KEEP_DAYS)
+	}
+	return nil
+}
+
+/*
+ * Every backup in the restore plan of a kept backup is kept as well, so that
+ * no kept backup is left impossible to restore.
+ */
+func GetBackupsToDelete(history *backup_history.History, policy RetentionPolicy, now time.Time) []backup_history.BackupConfig {
+	backupConfigs := make([]backup_history.BackupConfig, 0)
+	for _, backupConfig := range history.BackupConfigs {
+		if backupConfig.Deleted {
+			continue
+		}
+		if policy.DatabaseName != "" && backupConfig.DatabaseName != policy.DatabaseName && unquoteDatabaseName(backupConfig.DatabaseName) != policy.DatabaseName {
+			continue
+		}
+		backupConfigs = append(backupConfigs, backupConfig)
+	}
+	sort.Slice(backupConfigs, func(i int, j int) bool {
+		return backupConfigs[i].Timestamp > backupConfigs[j].Timestamp
+	})
+
+	kept := make(map[string]bool, 0)
+	cutoff := now.AddDate(0, 0, -policy.KeepDays).Format("20060102150405")
+	numFullsKept := make(map[string]int, 0)
+	for _, backupConfig := range backupConfigs {
+		if policy.KeepDays > 0 && backupConfig.Timestamp >= cutoff {
+			kept[backupConfig.Timestamp] = true
+		}
+		// Several clusters sharing a --history-file may have databases of the same name
+		databaseKey := fmt.Sprintf("%s %s", backupConfig.ClusterID, backupConfig.DatabaseName)
+		if !backupConfig.Incremental && !backupConfig.Failed() && numFullsKept[databaseKey] < policy.KeepFull {
+			numFullsKept[databaseKey]++
+			kept[backupConfig.Timestamp] = true
+		}
+	}
+	for _, backupConfig := range backupConfigs {
+		if backupConfig.Incremental && !backupConfig.Failed() && len(backupConfig.RestorePlan) > 0 && kept[backupConfig.RestorePlan[0].Timestamp] {
+			kept[backupConfig.Timestamp] = true
+		}
+	}
+	for _, backupConfig := range backupConfigs {
+		if kept[backupConfig.Timestamp] {
+			for _, entry := range backupConfig.RestorePlan {
+				kept[entry.Timestamp] = true
+			}
+		}
+	}
+
+	toDelete := make([]backup_history.BackupConfig, 0)
+	for _, backupConfig := range backupConfigs {
+		if !kept[backupConfig.Timestamp] {
+			toDelete = append(toDelete, backupConfig)
+		}
+	}
+	return toDelete
+}
+
+/*
+ * Backups are deleted newest first, so that an incremental backup is always
+ * deleted before the backups it is based on.  A backup that cannot be
+ * deleted, such as a plugin backup when --plugin-config is not given, is
+ * skipped and reported, along with the backups that it still needs, and the
+ * remaining backups are still deleted.
+ */
+func DoApplyRetention(writer io.Writer) {
+	policy := RetentionPolicy{
+		DatabaseName: MustGetFlagString(utils.DBNAME),
+		KeepFull:     MustGetFlagInt(utils.KEEP_FULL),
+		KeepDays:     MustGetFlagInt(utils.KEEP_DAYS),
+	}
+	gplog.FatalOnError(ValidateRetentionPolicy(policy))
+	err := utils.ValidateFullPath(MustGetFlagString(utils.ENCRYPTION_KEY_FILE))
+	gplog.FatalOnError(err)
+	err = utils.InitializeEncryption(MustGetFlagString(utils.ENCRYPTION_KEY_FILE))
+	gplog.FatalOnError(err)
+
+	toDelete := GetBackupsToDelete(readHistory(), policy, operating.System.Now())
+	if len(toDelete) == 0 {
+		gplog.Info("No backups fall outside the retention policy")
+		return
+	}
+	if MustGetFlagBool(utils.DRY_RUN) {
+		gplog.Info("The following %d backup(s) fall outside the retention policy and would be deleted", len(toDelete))
+		PrintBackupTable(writer, toDelete)
+		return
+	}
+
+	var pluginConfig *utils.PluginConfig
+	skipped := make([]backup_history.BackupConfig, 0)
+	neededBySkipped := make(map[string]string, 0)
+	for i := range toDelete {
+		backupConfig := &toDelete[i]
+		if wasTerminated {
+			return
+		}
+		err = deleteBackupForRetention(backupConfig, &pluginConfig, neededBySkipped)
+		if err != nil {
+			gplog.Warn("Skipping backup %s: %v", backupConfig.Timestamp, err)
+			skipped = append(skipped, *backupConfig)
+			for _, entry := range backupConfig.RestorePlan {
+				if entry.Timestamp != backupConfig.Timestamp {
+					neededBySkipped[entry.Timestamp] = backupConfig.Timestamp
+				}
+			}
+		}
+	}
+	if len(skipped) > 0 {
+		gplog.Warn("Deleted %d of the %d backup(s) that fall outside the retention policy.  The following %d backup(s) could not be deleted and were skipped",
+			len(toDelete)-len(skipped), len(toDelete), len(skipped))
+		PrintBackupTable(writer, skipped)
+		return
+	}
+	gplog.Info("Deleted %d backup(s) that fall outside the retention policy", len(toDelete))
+}
+
+/*
+ * The plugin config is read once, from --plugin-config, for the first plugin
+ * backup to be deleted.  A backup that a skipped backup still needs is not
+ * deleted, so that the skipped backup can still be restored.
+ */
+func deleteBackupForRetention(backupConfig *backup_history.BackupConfig, pluginConfig **utils.PluginConfig, neededBySkipped map[string]string) error {
+	if dependent, ok := neededBySkipped[backupConfig.Timestamp]; ok {
+		return errors.Errorf("It is needed to restore backup %s, which could not be deleted", dependent)
+	}
+	gplog.Info("Deleting backup %s, which falls outside the retention policy", backupConfig.Timestamp)
+	var backupPluginConfig *utils.PluginConfig
+	if backupConfig.Plugin != "" {
+		if *pluginConfig == nil {
+			if MustGetFlagString(utils.PLUGIN_CONFIG) == "" {
+				return errors.Errorf("It was taken with plugin %s, and the --%s flag is required to delete it", backupConfig.Plugin, utils.PLUGIN_CONFIG)
+			}
+			*pluginConfig = readPluginConfigForDelete(backupConfig)
+		}
+		backupPluginConfig = *pluginConfig
+	}
+	err := DeleteBackup(backupConfig, backupPluginConfig)
+	if err != nil {
+		return err
+	}
+	return backup_history.MarkBackupDeleted(GetHistoryFilePath(), backupConfig.Timestamp)
+}
@@ -0,0 +1,74 @@
+package manager_test
+
+import (
+	"time"
+
+	"github.com/greenplum-db/gpbackup/backup_history"
+	"github.com/greenplum-db/gpbackup/manager"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("manager/retention tests", func() {
+	now := time.Date(2017, 1, 10, 12, 0, 0, 0, time.Local)
+	history := &backup_history.History{BackupConfigs: []backup_history.BackupConfig{
+		{DatabaseName: "testdb", Timestamp: "20170109010101", Incremental: true,
+			RestorePlan: []backup_history.RestorePlanEntry{{Timestamp: "20170107010101"}, {Timestamp: "20170108010101"}, {Timestamp: "20170109010101"}}},
+		{DatabaseName: "testdb", Timestamp: "20170108010101", Incremental: true,
+			RestorePlan: []backup_history.RestorePlanEntry{{Timestamp: "20170107010101"}, {Timestamp: "20170108010101"}}},
+		{DatabaseName: "testdb", Timestamp: "20170107010101"},
+		{DatabaseName: "otherdb", Timestamp: "20170106010101"},
+		{DatabaseName: "testdb", Timestamp: "20170105010101", Status: backup_history.BACKUP_STATUS_FAILURE},
+		{DatabaseName: "testdb", Timestamp: "20170104010101", Incremental: true,
+			RestorePlan: []backup_history.RestorePlanEntry{{Timestamp: "20170103010101"}, {Timestamp: "20170104010101"}}},
+		{DatabaseName: "testdb", Timestamp: "20170103010101"},
+		{DatabaseName: "testdb", Timestamp: "20170102010101", Deleted: true},
+		{DatabaseName: "otherdb", Timestamp: "20170101010101"},
+	}}
+	timestampsOf := func(backupConfigs []backup_history.BackupConfig) []string {
+		timestamps := make([]string, 0)
+		for _, backupConfig := range backupConfigs {
+			timestamps = append(timestamps, backupConfig.Timestamp)
+		}
+		return timestamps
+	}
+	Describe("GetBackupsToDelete", func() {
+		It("keeps the most recent full backups of each database with their incremental chains", func() {
+			toDelete := manager.GetBackupsToDelete(history, manager.RetentionPolicy{KeepFull: 1}, now)
+			Expect(timestampsOf(toDelete)).To(Equal([]string{"20170105010101", "20170104010101", "20170103010101", "20170101010101"}))
+		})
+		It("only considers backups of the given database", func() {
+			toDelete := manager.GetBackupsToDelete(history, manager.RetentionPolicy{DatabaseName: "testdb", KeepFull: 2}, now)
+			Expect(timestampsOf(toDelete)).To(Equal([]string{"20170105010101"}))
+		})
+		It("keeps the backups taken within the given number of days", func() {
+			toDelete := manager.GetBackupsToDelete(history, manager.RetentionPolicy{KeepDays: 6}, now)
+			Expect(timestampsOf(toDelete)).To(Equal([]string{"20170104010101", "20170103010101", "20170101010101"}))
+		})
+		It("keeps the backups that recent incremental backups need to be restored", func() {
+			toDelete := manager.GetBackupsToDelete(history, manager.RetentionPolicy{DatabaseName: "testdb", KeepDays: 2}, now)
+			Expect(timestampsOf(toDelete)).To(Equal([]string{"20170105010101", "20170104010101", "20170103010101"}))
+		})
+		It("counts the full backups of each cluster separately", func() {
+			sharedHistory := &backup_history.History{BackupConfigs: []backup_history.BackupConfig{
+				{DatabaseName: "testdb", Timestamp: "20170103010101", ClusterID: "otherhost:5432"},
+				{DatabaseName: "testdb", Timestamp: "20170102010101", ClusterID: "mdw:5432"},
+				{DatabaseName: "testdb", Timestamp: "20170101010101", ClusterID: "mdw:5432"},
+			}}
+			toDelete := manager.GetBackupsToDelete(sharedHistory, manager.RetentionPolicy{KeepFull: 1}, now)
+			Expect(timestampsOf(toDelete)).To(Equal([]string{"20170101010101"}))
+		})
+		It("keeps a backup if any policy keeps it", func() {
+			toDelete := manager.GetBackupsToDelete(history, manager.RetentionPolicy{KeepFull: 1, KeepDays: 7}, now)
+			Expect(timestampsOf(toDelete)).To(Equal([]string{"20170101010101"}))
+		})
+	})
+	Describe("ValidateRetentionPolicy", func() {
+		It("requires a policy", func() {
+			Expect(manager.ValidateRetentionPolicy(manager.RetentionPolicy{})).To(MatchError("At least one of --keep-full and --keep-days must be specified"))
+		})
+		It("rejects negative values", func() {
+			Expect(manager.ValidateRetentionPolicy(manager.RetentionPolicy{KeepFull: -1})).ToNot(Succeed())
+		})
+	})
+})
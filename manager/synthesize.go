@@ -0,0 +1,278 @@
+package manager
+
+/*
+ * This file contains functions for consolidating an incremental backup and the
+ * backups in its restore plan into a new, self-contained full backup, without
+ * connecting to a database.
+ */
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/backup_filepath"
+	"github.com/greenplum-db/gpbackup/backup_history"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * The data files of a backup stored with a plugin are not on disk, and those
+ * of a single-data-file backup hold every table in one file per segment, so
+ * neither can be consolidated by linking files.
+ */
+func CheckBackupCanBeSynthesized(history *backup_history.History, timestamp string) (*backup_history.BackupConfig, error) {
+	backupConfig := history.FindBackupConfig(timestamp)
+	if backupConfig == nil {
+		return nil, errors.Errorf("Backup %s was not found in the backup history", timestamp)
+	}
+	if backupConfig.Deleted || backupConfig.Failed() {
+		return nil, errors.Errorf("Backup %s was deleted or did not complete successfully", timestamp)
+	}
+	if !backupConfig.Incremental {
+		return nil, errors.Errorf("Backup %s is already a full backup", timestamp)
+	}
+	if backupConfig.Plugin != "" {
+		return nil, errors.Errorf("Backup %s was taken with plugin %s.  Backups stored with a plugin cannot be consolidated.", timestamp, backupConfig.Plugin)
+	}
+	if backupConfig.SingleDataFile {
+		return nil, errors.Errorf("Backup %s was taken with --single-data-file.  Single-data-file backups cannot be consolidated.", timestamp)
+	}
+	for _, entry := range backupConfig.RestorePlan {
+		planConfig := history.FindBackupConfig(entry.Timestamp)
+		if planConfig == nil || planConfig.Deleted {
+			return nil, errors.Errorf("Backup %s in the restore plan of backup %s no longer exists", entry.Timestamp, timestamp)
+		}
+		if planConfig.Failed() {
+			return nil, errors.Errorf("Backup %s in the restore plan of backup %s did not complete successfully", entry.Timestamp, timestamp)
+		}
+	}
+	return backupConfig, nil
+}
+
+/*
+ * The synthetic backup keeps the settings of the incremental backup it was
+ * made from, but restores every table from its own files.
+ */
+func GetSyntheticBackupConfig(backupConfig *backup_history.BackupConfig, timestamp string) *backup_history.BackupConfig {
+	syntheticConfig := *backupConfig
+	tableFQNs := make([]string, 0)
+	for _, entry := range backupConfig.RestorePlan {
+		tableFQNs = append(tableFQNs, entry.TableFQNs...)
+	}
+	syntheticConfig.Timestamp = timestamp
+	syntheticConfig.Incremental = false
+	syntheticConfig.Differential = false
+	syntheticConfig.RestorePlan = []backup_history.RestorePlanEntry{{Timestamp: timestamp, TableFQNs: tableFQNs}}
+	syntheticConfig.Status = backup_history.BACKUP_STATUS_SUCCESS
+	syntheticConfig.ErrorMessage = ""
+	syntheticConfig.Metrics = backup_history.BackupMetrics{}
+	syntheticConfig.TOCChecksum = ""
+	return &syntheticConfig
+}
+
+/*
+ * Returns the data entry of each table in the restore plan, taken from the
+ * TOC of the backup that holds its data, along with the oids of the data
+ * files to be linked from each of those backups.  The TOCs are in the same
+ * order as the restore plan.
+ */
+func GetSyntheticDataEntries(restorePlan []backup_history.RestorePlanEntry, tocs []*utils.TOC) ([]utils.MasterDataEntry, map[string][]string, error) {
+	dataEntries := make([]utils.MasterDataEntry, 0)
+	oidsByTimestamp := make(map[string][]string, len(restorePlan))
+	for i, planEntry := range restorePlan {
+		tocEntries := make(map[string]utils.MasterDataEntry, len(tocs[i].DataEntries))
+		for _, dataEntry := range tocs[i].DataEntries {
+			tocEntries[utils.MakeFQN(dataEntry.Schema, dataEntry.Name)] = dataEntry
+		}
+		oids := make([]string, 0, len(planEntry.TableFQNs))
+		for _, tableFQN := range planEntry.TableFQNs {
+			dataEntry, ok := tocEntries[tableFQN]
+			if !ok {
+				return nil, nil, errors.Errorf("Table %s has no data in backup %s", tableFQN, planEntry.Timestamp)
+			}
+			dataEntries = append(dataEntries, dataEntry)
+			oids = append(oids, fmt.Sprintf("%d", dataEntry.Oid))
+		}
+		oidsByTimestamp[planEntry.Timestamp] = oids
+	}
+	return dataEntries, oidsByTimestamp, nil
+}
+
+/*
+ * Data files are hard-linked where the backup directories share a
+ * filesystem, and copied otherwise.  The oids of the files are read from
+ * oidFile, as a backup can have more tables than fit in a remote command.
+ */
+func GetLinkDataFilesCommand(sourceFPInfo backup_filepath.FilePathInfo, targetFPInfo backup_filepath.FilePathInfo, contentID int, oidFile string, extension string) string {
+	sourceFile := fmt.Sprintf("%s/gpbackup_%d_%s_${OID}%s", sourceFPInfo.GetDirForContent(contentID), contentID, sourceFPInfo.Timestamp, extension)
+	targetFile := fmt.Sprintf("%s/gpbackup_%d_%s_${OID}%s", targetFPInfo.GetDirForContent(contentID), contentID, targetFPInfo.Timestamp, extension)
+	return fmt.Sprintf("while read OID; do ln %s %s 2>/dev/null || cp %s %s || exit 1; done < %s",
+		sourceFile, targetFile, sourceFile, targetFile, oidFile)
+}
+
+func getOidListSuffix(timestamp string) string {
+	return fmt.Sprintf("oids_%s", timestamp)
+}
+
+func linkDataFilesOnSegments(planFPInfos []backup_filepath.FilePathInfo, targetFPInfo backup_filepath.FilePathInfo, oidsByTimestamp map[string][]string) error {
+	extension := utils.GetPipeThroughProgram().Extension
+	for _, fpInfo := range planFPInfos {
+		if oids := oidsByTimestamp[fpInfo.Timestamp]; len(oids) > 0 {
+			oidLists := make(map[int][]string, len(globalCluster.ContentIDs))
+			for _, contentID := range globalCluster.ContentIDs {
+				oidLists[contentID] = oids
+			}
+			utils.CopyFileListsToSegments(oidLists, getOidListSuffix(fpInfo.Timestamp), globalCluster, targetFPInfo)
+		}
+	}
+	remoteOutput := globalCluster.GenerateAndExecuteCommand("Linking data files into synthetic backup", func(contentID int) string {
+		commands := []string{fmt.Sprintf("mkdir -p %s", targetFPInfo.GetDirForContent(contentID))}
+		oidFiles := make([]string, 0, len(planFPInfos))
+		for _, fpInfo := range planFPInfos {
+			if oids := oidsByTimestamp[fpInfo.Timestamp]; len(oids) > 0 {
+				oidFile := targetFPInfo.GetSegmentHelperFilePath(contentID, getOidListSuffix(fpInfo.Timestamp))
+				oidFiles = append(oidFiles, oidFile)
+				commands = append(commands, GetLinkDataFilesCommand(fpInfo, targetFPInfo, contentID, oidFile, extension))
+			}
+		}
+		// The oid files are removed whether or not the files could be linked
+		return fmt.Sprintf("(%s); STATUS=$?; rm -f %s; exit $STATUS", strings.Join(commands, " && "), strings.Join(oidFiles, " "))
+	}, cluster.ON_SEGMENTS)
+	globalCluster.CheckClusterError(remoteOutput, "Unable to link data files", func(contentID int) string {
+		return fmt.Sprintf("Unable to link data files for segment %d on host %s", contentID, globalCluster.GetHostForContent(contentID))
+	}, true)
+	if remoteOutput.NumErrors > 0 {
+		return errors.Errorf("Unable to link data files on %d segment(s).  See %s for details.", remoteOutput.NumErrors, gplog.GetLogFilePath())
+	}
+	return nil
+}
+
+func linkOrCopyFile(sourceFilename string, targetFilename string) error {
+	if err := os.Link(sourceFilename, targetFilename); err == nil {
+		return nil
+	}
+	sourceFile, err := os.Open(sourceFilename)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+	targetFile, err := os.OpenFile(targetFilename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0444)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(targetFile, sourceFile)
+	closeErr := targetFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func writeSyntheticMasterFiles(sourceFPInfo backup_filepath.FilePathInfo, targetFPInfo backup_filepath.FilePathInfo, syntheticConfig *backup_history.BackupConfig, toc *utils.TOC) error {
+	err := linkOrCopyFile(sourceFPInfo.GetMetadataFilePath(), targetFPInfo.GetMetadataFilePath())
+	if err != nil {
+		return err
+	}
+	if syntheticConfig.WithStatistics {
+		err = linkOrCopyFile(sourceFPInfo.GetStatisticsFilePath(), targetFPInfo.GetStatisticsFilePath())
+		if err != nil {
+			return err
+		}
+	}
+	toc.WriteToFileAndMakeReadOnly(targetFPInfo.GetTOCFilePath())
+	syntheticConfig.TOCChecksum, err = utils.ComputeFileChecksum(targetFPInfo.GetTOCFilePath())
+	if err != nil {
+		return err
+	}
+	backup_history.WriteConfigFile(syntheticConfig, targetFPInfo.GetConfigFilePath())
+
+	objectCounts := make(map[string]int, 0)
+	if contents, err := operating.System.ReadFile(sourceFPInfo.GetBackupReportFilePath()); err == nil {
+		objectCounts = ParseObjectCounts(string(contents))
+	}
+	report := utils.Report{BackupConfig: *syntheticConfig}
+	report.ConstructBackupParamsString()
+	report.WriteBackupReportFile(targetFPInfo.GetBackupReportFilePath(), syntheticConfig.Timestamp, objectCounts, "")
+	return nil
+}
+
+func DoSynthesizeFull() {
+	timestamp := MustGetFlagString(utils.TIMESTAMP)
+	if !backup_filepath.IsValidTimestamp(timestamp) {
+		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", timestamp), "")
+	}
+	err := utils.ValidateFullPath(MustGetFlagString(utils.ENCRYPTION_KEY_FILE))
+	gplog.FatalOnError(err)
+
+	history := readHistory()
+	backupConfig, err := CheckBackupCanBeSynthesized(history, timestamp)
+	gplog.FatalOnError(err)
+	err = utils.InitializeEncryption(MustGetFlagString(utils.ENCRYPTION_KEY_FILE))
+	gplog.FatalOnError(err)
+	err = utils.ValidateEncryptionKey(backupConfig.EncryptionKeyFingerprint)
+	gplog.FatalOnError(err)
+	utils.InitializePipeThroughParameters(backupConfig.Compressed, backupConfig.GetCompressionType(), 0, false)
+
+	startTime := operating.System.Now()
+	syntheticTimestamp := startTime.Format("20060102150405")
+	if history.FindBackupConfig(syntheticTimestamp) != nil {
+		gplog.Fatal(errors.Errorf("A backup with timestamp %s already exists", syntheticTimestamp), "")
+	}
+	gplog.Info("Consolidating incremental backup %s into full backup %s", timestamp, syntheticTimestamp)
+
+	masterFPInfo := GetMasterFilePathInfo(backupConfig.BackupDir, timestamp)
+	toc := utils.NewTOC(masterFPInfo.GetTOCFilePath())
+	if len(toc.SegmentConfig) == 0 {
+		gplog.Fatal(errors.Errorf("Backup %s does not record the segment configuration of its cluster, so its segment files cannot be located.", timestamp), "")
+	}
+	globalCluster = cluster.NewCluster(toc.SegmentConfig)
+
+	planFPInfos := make([]backup_filepath.FilePathInfo, 0, len(backupConfig.RestorePlan))
+	planTOCs := make([]*utils.TOC, 0, len(backupConfig.RestorePlan))
+	for _, entry := range backupConfig.RestorePlan {
+		planMasterFPInfo := GetMasterFilePathInfo(backupConfig.BackupDir, entry.Timestamp)
+		planTOCs = append(planTOCs, utils.NewTOC(planMasterFPInfo.GetTOCFilePath()))
+		planFPInfos = append(planFPInfos, backup_filepath.NewFilePathInfo(globalCluster, backupConfig.BackupDir, entry.Timestamp, planMasterFPInfo.UserSpecifiedSegPrefix))
+	}
+	dataEntries, oidsByTimestamp, err := GetSyntheticDataEntries(backupConfig.RestorePlan, planTOCs)
+	gplog.FatalOnError(err)
+	toc.DataEntries = dataEntries
+
+	syntheticMasterFPInfo := masterFPInfo
+	syntheticMasterFPInfo.Timestamp = syntheticTimestamp
+	syntheticFPInfo := backup_filepath.NewFilePathInfo(globalCluster, backupConfig.BackupDir, syntheticTimestamp, masterFPInfo.UserSpecifiedSegPrefix)
+	if _, err := os.Stat(syntheticMasterFPInfo.GetDirForContent(-1)); err == nil {
+		gplog.Fatal(errors.Errorf("Backup directory %s already exists", syntheticMasterFPInfo.GetDirForContent(-1)), "")
+	}
+	syntheticConfig := GetSyntheticBackupConfig(backupConfig, syntheticTimestamp)
+	for _, dataEntry := range dataEntries {
+		syntheticConfig.Metrics.TotalRows += dataEntry.RowsCopied
+		syntheticConfig.Metrics.TotalBytes += dataEntry.Size
+	}
+	syntheticConfig.Metrics.TableCount = len(dataEntries)
+
+	err = linkDataFilesOnSegments(planFPInfos, syntheticFPInfo, oidsByTimestamp)
+	if err == nil {
+		err = os.MkdirAll(syntheticMasterFPInfo.GetDirForContent(-1), 0755)
+	}
+	if err == nil {
+		err = writeSyntheticMasterFiles(masterFPInfo, syntheticMasterFPInfo, syntheticConfig, toc)
+	}
+	if err != nil {
+		gplog.Error("Unable to create synthetic backup %s: %v", syntheticTimestamp, err)
+		_ = DeleteBackupFilesOnAllHosts(syntheticFPInfo)
+		_ = os.RemoveAll(syntheticMasterFPInfo.GetDirForContent(-1))
+		gplog.Fatal(errors.Errorf("Unable to consolidate backup %s", timestamp), "")
+	}
+
+	syntheticConfig.Metrics.Finish(startTime, operating.System.Now())
+	err = backup_history.WriteBackupHistory(GetHistoryFilePath(), syntheticConfig)
+	gplog.FatalOnError(err)
+	gplog.Info("Full backup %s created from the %d backup(s) in the restore plan of backup %s", syntheticTimestamp, len(backupConfig.RestorePlan), timestamp)
+}
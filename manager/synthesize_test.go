@@ -0,0 +1,108 @@
+package manager_test
+
+import (
+	"github.com/greenplum-db/gpbackup/backup_filepath"
+	"github.com/greenplum-db/gpbackup/backup_history"
+	"github.com/greenplum-db/gpbackup/manager"
+	"github.com/greenplum-db/gpbackup/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("manager/synthesize tests", func() {
+	restorePlan := []backup_history.RestorePlanEntry{
+		{Timestamp: "20170101010101", TableFQNs: []string{"public.foo", "public.bar"}},
+		{Timestamp: "20170102010101", TableFQNs: []string{"public.baz"}},
+	}
+	history := &backup_history.History{BackupConfigs: []backup_history.BackupConfig{
+		{Timestamp: "20170104010101", Incremental: true, SingleDataFile: true, RestorePlan: restorePlan},
+		{Timestamp: "20170103010101", Incremental: true, Plugin: "/usr/local/bin/gpbackup_s3_plugin", RestorePlan: restorePlan},
+		{Timestamp: "20170102010101", Incremental: true, Status: backup_history.BACKUP_STATUS_SUCCESS, RestorePlan: restorePlan,
+			Metrics: backup_history.BackupMetrics{TableCount: 1}},
+		{Timestamp: "20170101010101", RestorePlan: restorePlan[:1]},
+	}}
+	Describe("CheckBackupCanBeSynthesized", func() {
+		It("accepts an incremental backup whose restore plan is intact", func() {
+			backupConfig, err := manager.CheckBackupCanBeSynthesized(history, "20170102010101")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(backupConfig.Timestamp).To(Equal("20170102010101"))
+		})
+		It("rejects a full backup", func() {
+			_, err := manager.CheckBackupCanBeSynthesized(history, "20170101010101")
+			Expect(err).To(MatchError("Backup 20170101010101 is already a full backup"))
+		})
+		It("rejects plugin and single-data-file backups", func() {
+			_, err := manager.CheckBackupCanBeSynthesized(history, "20170103010101")
+			Expect(err).To(MatchError("Backup 20170103010101 was taken with plugin /usr/local/bin/gpbackup_s3_plugin.  Backups stored with a plugin cannot be consolidated."))
+			_, err = manager.CheckBackupCanBeSynthesized(history, "20170104010101")
+			Expect(err).To(MatchError("Backup 20170104010101 was taken with --single-data-file.  Single-data-file backups cannot be consolidated."))
+		})
+		It("rejects a backup whose restore plan includes a deleted backup", func() {
+			deletedHistory := &backup_history.History{BackupConfigs: []backup_history.BackupConfig{
+				{Timestamp: "20170102010101", Incremental: true, RestorePlan: restorePlan},
+				{Timestamp: "20170101010101", Deleted: true},
+			}}
+			_, err := manager.CheckBackupCanBeSynthesized(deletedHistory, "20170102010101")
+			Expect(err).To(MatchError("Backup 20170101010101 in the restore plan of backup 20170102010101 no longer exists"))
+		})
+		It("rejects a backup whose restore plan includes a failed backup", func() {
+			failedHistory := &backup_history.History{BackupConfigs: []backup_history.BackupConfig{
+				{Timestamp: "20170102010101", Incremental: true, RestorePlan: restorePlan},
+				{Timestamp: "20170101010101", Status: backup_history.BACKUP_STATUS_FAILURE},
+			}}
+			_, err := manager.CheckBackupCanBeSynthesized(failedHistory, "20170102010101")
+			Expect(err).To(MatchError("Backup 20170101010101 in the restore plan of backup 20170102010101 did not complete successfully"))
+		})
+	})
+	Describe("GetSyntheticBackupConfig", func() {
+		It("makes a full backup that restores every table from its own timestamp", func() {
+			syntheticConfig := manager.GetSyntheticBackupConfig(&history.BackupConfigs[2], "20170105010101")
+
+			Expect(syntheticConfig.Timestamp).To(Equal("20170105010101"))
+			Expect(syntheticConfig.Incremental).To(BeFalse())
+			Expect(syntheticConfig.Metrics).To(Equal(backup_history.BackupMetrics{}))
+			Expect(syntheticConfig.RestorePlan).To(Equal([]backup_history.RestorePlanEntry{
+				{Timestamp: "20170105010101", TableFQNs: []string{"public.foo", "public.bar", "public.baz"}},
+			}))
+			Expect(history.BackupConfigs[2].Timestamp).To(Equal("20170102010101"))
+		})
+	})
+	Describe("GetSyntheticDataEntries", func() {
+		tocs := []*utils.TOC{
+			{DataEntries: []utils.MasterDataEntry{
+				{Schema: "public", Name: "foo", Oid: 1},
+				{Schema: "public", Name: "bar", Oid: 2},
+				{Schema: "public", Name: "baz", Oid: 3},
+			}},
+			{DataEntries: []utils.MasterDataEntry{
+				{Schema: "public", Name: "baz", Oid: 3, RowsCopied: 10},
+			}},
+		}
+		It("takes each table's data entry from the backup in the restore plan that holds its data", func() {
+			dataEntries, oidsByTimestamp, err := manager.GetSyntheticDataEntries(restorePlan, tocs)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dataEntries).To(Equal([]utils.MasterDataEntry{
+				{Schema: "public", Name: "foo", Oid: 1},
+				{Schema: "public", Name: "bar", Oid: 2},
+				{Schema: "public", Name: "baz", Oid: 3, RowsCopied: 10},
+			}))
+			Expect(oidsByTimestamp).To(Equal(map[string][]string{"20170101010101": {"1", "2"}, "20170102010101": {"3"}}))
+		})
+		It("returns an error for a table with no data entry", func() {
+			_, _, err := manager.GetSyntheticDataEntries(restorePlan, []*utils.TOC{tocs[0], {}})
+			Expect(err).To(MatchError("Table public.baz has no data in backup 20170102010101"))
+		})
+	})
+	Describe("GetLinkDataFilesCommand", func() {
+		It("links each data file listed in the oid file into the synthetic backup, copying it if it cannot be linked", func() {
+			sourceFPInfo := backup_filepath.FilePathInfo{SegDirMap: map[int]string{0: "/data/gpseg0"}, Timestamp: "20170101010101"}
+			targetFPInfo := backup_filepath.FilePathInfo{SegDirMap: map[int]string{0: "/data/gpseg0"}, Timestamp: "20170105010101"}
+
+			command := manager.GetLinkDataFilesCommand(sourceFPInfo, targetFPInfo, 0, "/data/gpseg0/gpbackup_0_20170105010101_oids_20170101010101_1", ".gz")
+
+			sourceFile := "/data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_${OID}.gz"
+			targetFile := "/data/gpseg0/backups/20170105/20170105010101/gpbackup_0_20170105010101_${OID}.gz"
+			Expect(command).To(Equal("while read OID; do ln " + sourceFile + " " + targetFile + " 2>/dev/null || cp " + sourceFile + " " + targetFile + " || exit 1; done < /data/gpseg0/gpbackup_0_20170105010101_oids_20170101010101_1"))
+		})
+	})
+})
@@ -0,0 +1,230 @@
+package manager
+
+/*
+ * This file contains functions for verifying that a backup set can be
+ * restored, using only the backup files themselves.
+ */
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/backup_filepath"
+	"github.com/greenplum-db/gpbackup/backup_history"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+func DoVerify() {
+	timestamp := MustGetFlagString(utils.TIMESTAMP)
+	backupDir := MustGetFlagString(utils.BACKUP_DIR)
+	if !backup_filepath.IsValidTimestamp(timestamp) {
+		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", timestamp), "")
+	}
+	err := utils.ValidateFullPath(backupDir)
+	gplog.FatalOnError(err)
+	err = utils.ValidateFullPath(MustGetFlagString(utils.ENCRYPTION_KEY_FILE))
+	gplog.FatalOnError(err)
+	gplog.Info("Verifying backup with timestamp %s", timestamp)
+
+	masterFPInfo := GetMasterFilePathInfo(backupDir, timestamp)
+	backupConfig := readBackupConfig(masterFPInfo)
+	if backupConfig.Plugin != "" {
+		gplog.Fatal(errors.Errorf("Backup %s was taken with plugin %s.  Backups stored with a plugin cannot be verified.", timestamp, backupConfig.Plugin), "")
+	}
+	err = utils.InitializeEncryption(MustGetFlagString(utils.ENCRYPTION_KEY_FILE))
+	gplog.FatalOnError(err)
+	err = utils.ValidateEncryptionKey(backupConfig.EncryptionKeyFingerprint)
+	gplog.FatalOnError(err)
+	toc := utils.NewTOC(masterFPInfo.GetTOCFilePath())
+	if len(toc.SegmentConfig) == 0 {
+		gplog.Fatal(errors.Errorf("Backup %s does not record the segment configuration of its cluster.  Backups taken with older versions of gpbackup cannot be verified.", timestamp), "")
+	}
+	globalCluster = cluster.NewCluster(toc.SegmentConfig)
+	if (backupConfig.SingleDataFile || utils.IsEncryptionEnabled()) && !backupConfig.MetadataOnly {
+		utils.VerifyHelperVersionOnSegments(version, globalCluster)
+	}
+	if utils.IsEncryptionEnabled() && !backupConfig.MetadataOnly {
+		utils.VerifyEncryptionKeyFileOnAllHosts(globalCluster)
+	}
+
+	restorePlan := backupConfig.RestorePlan
+	// Legacy backups prior to the incremental feature would have no restoreplan yaml element
+	if restorePlan == nil {
+		restorePlan = []backup_history.RestorePlanEntry{{Timestamp: timestamp}}
+	}
+	numProblems := 0
+	for _, entry := range restorePlan {
+		if wasTerminated {
+			return
+		}
+		segPrefix := backup_filepath.ParseSegPrefix(backupDir, entry.Timestamp)
+		fpInfo := backup_filepath.NewFilePathInfo(globalCluster, backupDir, entry.Timestamp, segPrefix)
+		numProblems += VerifyBackupSet(fpInfo)
+	}
+	if numProblems > 0 {
+		gplog.Fatal(errors.Errorf("Found %d problem(s) with backup %s.  See %s for a complete list.", numProblems, timestamp, gplog.GetLogFilePath()), "Backup verification failed")
+	}
+	gplog.Info("Backup %s verified successfully", timestamp)
+}
+
+/*
+ * Without a database connection, the master data directory is only needed
+ * to locate the master backup files; the TOC records everything else.
+ */
+func GetMasterFilePathInfo(backupDir string, timestamp string) backup_filepath.FilePathInfo {
+	masterDataDir := operating.System.Getenv("MASTER_DATA_DIRECTORY")
+	if backupDir == "" && masterDataDir == "" {
+		gplog.Fatal(errors.New("MASTER_DATA_DIRECTORY must be set if --backup-dir is not specified"), "")
+	}
+	return backup_filepath.FilePathInfo{
+		SegDirMap:              map[int]string{-1: masterDataDir},
+		Timestamp:              timestamp,
+		UserSpecifiedBackupDir: backupDir,
+		UserSpecifiedSegPrefix: backup_filepath.ParseSegPrefix(backupDir, timestamp),
+	}
+}
+
+func readBackupConfig(fpInfo backup_filepath.FilePathInfo) *backup_history.BackupConfig {
+	configFilename := fpInfo.GetConfigFilePath()
+	if !iohelper.FileExistsAndIsReadable(configFilename) {
+		gplog.Fatal(errors.Errorf("Cannot access config file %s", configFilename), "")
+	}
+	return backup_history.ReadConfigFile(configFilename)
+}
+
+func VerifyBackupSet(fpInfo backup_filepath.FilePathInfo) int {
+	gplog.Verbose("Verifying backup files for timestamp %s", fpInfo.Timestamp)
+	configFilename := fpInfo.GetConfigFilePath()
+	if !iohelper.FileExistsAndIsReadable(configFilename) {
+		gplog.Error("Cannot access config file %s", configFilename)
+		return 1
+	}
+	backupConfig := backup_history.ReadConfigFile(configFilename)
+	tocFilename := fpInfo.GetTOCFilePath()
+	if !iohelper.FileExistsAndIsReadable(tocFilename) {
+		gplog.Error("Cannot access table of contents file %s", tocFilename)
+		return 1
+	}
+	err := utils.VerifyFileChecksum(tocFilename, backupConfig.TOCChecksum)
+	if err != nil {
+		gplog.Error(err.Error())
+		return 1
+	}
+	toc := utils.NewTOC(tocFilename)
+	numProblems := VerifyMetadataFiles(fpInfo, backupConfig, toc)
+	if backupConfig.MetadataOnly || len(toc.DataEntries) == 0 {
+		return numProblems
+	}
+
+	utils.InitializePipeThroughParameters(backupConfig.Compressed, backupConfig.GetCompressionType(), 0, false)
+	var remoteOutput *cluster.RemoteOutput
+	if backupConfig.SingleDataFile {
+		remoteOutput = verifySingleDataFilesOnSegments(fpInfo, backupConfig, toc)
+	} else {
+		utils.VerifyCompressionProgramOnAllHosts(globalCluster)
+		remoteOutput = verifyDataFilesOnSegments(fpInfo, toc)
+	}
+	globalCluster.CheckClusterError(remoteOutput, "Could not verify data files on all segments", func(contentID int) string {
+		return fmt.Sprintf("Could not verify data files for segment %d on host %s", contentID, globalCluster.GetHostForContent(contentID))
+	}, true)
+	numProblems += remoteOutput.NumErrors
+	for contentID := range remoteOutput.Stdouts {
+		for _, problem := range strings.Split(strings.TrimSpace(remoteOutput.Stdouts[contentID]), "\n") {
+			if problem != "" {
+				gplog.Error("Segment %d on host %s: %s", contentID, globalCluster.GetHostForContent(contentID), problem)
+				numProblems++
+			}
+		}
+	}
+	return numProblems
+}
+
+func VerifyMetadataFiles(fpInfo backup_filepath.FilePathInfo, backupConfig *backup_history.BackupConfig, toc *utils.TOC) int {
+	checksumMap := map[string]string{
+		fpInfo.GetMetadataFilePath():     toc.MetadataChecksum,
+		fpInfo.GetBackupReportFilePath(): "",
+	}
+	if backupConfig.WithStatistics {
+		checksumMap[fpInfo.GetStatisticsFilePath()] = toc.StatisticsChecksum
+	}
+	numProblems := 0
+	for filename, checksum := range checksumMap {
+		if !iohelper.FileExistsAndIsReadable(filename) {
+			gplog.Error("Cannot access %s", filename)
+			numProblems++
+			continue
+		}
+		err := utils.VerifyFileChecksum(filename, checksum)
+		if err != nil {
+			gplog.Error(err.Error())
+			numProblems++
+		}
+	}
+	return numProblems
+}
+
+func verifyDataFilesOnSegments(fpInfo backup_filepath.FilePathInfo, toc *utils.TOC) *cluster.RemoteOutput {
+	extension := utils.GetPipeThroughProgram().Extension
+	fileLists := make(map[int][]string, len(globalCluster.ContentIDs))
+	manifests := make(map[int][]string, len(globalCluster.ContentIDs))
+	for _, contentID := range globalCluster.ContentIDs {
+		filenames := make([]string, 0, len(toc.DataEntries))
+		checksumMap := make(map[string]string, len(toc.DataEntries))
+		for _, entry := range toc.DataEntries {
+			filename := fpInfo.GetTableBackupFilePath(contentID, entry.Oid, extension, false)
+			filenames = append(filenames, filename)
+			if checksum, ok := entry.Checksums[contentID]; ok {
+				checksumMap[filename] = checksum
+			}
+		}
+		fileLists[contentID] = filenames
+		manifests[contentID] = utils.GetChecksumManifest(checksumMap)
+	}
+	utils.CopyFileListsToSegments(fileLists, "files", globalCluster, fpInfo)
+	utils.CopyFileListsToSegments(manifests, "checksums", globalCluster, fpInfo)
+	return globalCluster.GenerateAndExecuteCommand(fmt.Sprintf("Verifying data files for timestamp %s", fpInfo.Timestamp), func(contentID int) string {
+		return GetVerifyDataFilesCommand(fpInfo.GetSegmentHelperFilePath(contentID, "files"), fpInfo.GetSegmentHelperFilePath(contentID, "checksums"), utils.GetPipeThroughProgram().InputCommand)
+	}, cluster.ON_SEGMENTS)
+}
+
+/*
+ * Returns a shell command that prints one line for each file in the file list
+ * that is missing, unreadable, or cannot be fully decompressed, and for each
+ * file that does not match its checksum in the manifest file.  Both files are
+ * removed afterwards.
+ */
+func GetVerifyDataFilesCommand(fileList string, manifestFile string, decompressCommand string) string {
+	return fmt.Sprintf(`while read FILE; do if [[ ! -r $FILE ]]; then echo "$FILE: missing or unreadable"; elif ! %s < $FILE > /dev/null 2>&1; then echo "$FILE: could not be decompressed"; fi; done < %s; rm -f %s
+%s`, decompressCommand, fileList, fileList, utils.GetVerifyChecksumsCommand(manifestFile))
+}
+
+func verifySingleDataFilesOnSegments(fpInfo backup_filepath.FilePathInfo, backupConfig *backup_history.BackupConfig, toc *utils.TOC) *cluster.RemoteOutput {
+	oidList := make([]string, len(toc.DataEntries))
+	for i, entry := range toc.DataEntries {
+		oidList[i] = fmt.Sprintf("%d", entry.Oid)
+	}
+	helperFPInfoList = append(helperFPInfoList, fpInfo)
+	utils.WriteOidListToSegments(oidList, globalCluster, fpInfo)
+
+	gphomePath := operating.System.Getenv("GPHOME")
+	return globalCluster.GenerateAndExecuteCommand(fmt.Sprintf("Verifying data files for timestamp %s", fpInfo.Timestamp), func(contentID int) string {
+		compressStr := ""
+		if backupConfig.Compressed {
+			compressStr = fmt.Sprintf(" --compression-type %s", backupConfig.GetCompressionType())
+		}
+		if utils.IsEncryptionEnabled() {
+			compressStr += fmt.Sprintf(" --encryption-key-file %s", utils.GetEncryptionKeyFile())
+		}
+		if checksum, ok := toc.SegmentTOCChecksums[contentID]; ok {
+			compressStr += fmt.Sprintf(" --toc-checksum %s", checksum)
+		}
+		return fmt.Sprintf("source %s/greenplum_path.sh && %s/bin/gpbackup_helper --verify-agent --toc-file %s --oid-file %s --data-file %s --content %d%s",
+			gphomePath, gphomePath, fpInfo.GetSegmentTOCFilePath(contentID), fpInfo.GetSegmentHelperFilePath(contentID, "oid"),
+			fpInfo.GetTableBackupFilePath(contentID, 0, utils.GetPipeThroughProgram().Extension, true), contentID, compressStr)
+	}, cluster.ON_SEGMENTS)
+}
@@ -0,0 +1,68 @@
+package manager_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/backup_filepath"
+	"github.com/greenplum-db/gpbackup/backup_history"
+	"github.com/greenplum-db/gpbackup/manager"
+	"github.com/greenplum-db/gpbackup/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("manager/verify tests", func() {
+	Describe("GetVerifyDataFilesCommand", func() {
+		It("checks that each listed file is readable, can be decompressed, and matches its checksum", func() {
+			command := manager.GetVerifyDataFilesCommand("/data/files", "/data/checksums", "gzip -d -c")
+			Expect(command).To(Equal(`while read FILE; do if [[ ! -r $FILE ]]; then echo "$FILE: missing or unreadable"; elif ! gzip -d -c < $FILE > /dev/null 2>&1; then echo "$FILE: could not be decompressed"; fi; done < /data/files; rm -f /data/files
+sha256sum --check --quiet /data/checksums 2>/dev/null; rm -f /data/checksums`))
+		})
+	})
+	Describe("GetMasterFilePathInfo", func() {
+		AfterEach(func() {
+			operating.System = operating.InitializeSystemFunctions()
+		})
+		It("locates the master backup directory using MASTER_DATA_DIRECTORY", func() {
+			operating.System.Getenv = func(key string) string { return "/data/master/gpseg-1" }
+			fpInfo := manager.GetMasterFilePathInfo("", "20170101010101")
+			Expect(fpInfo.GetDirForContent(-1)).To(Equal("/data/master/gpseg-1/backups/20170101/20170101010101"))
+		})
+	})
+	Describe("VerifyMetadataFiles", func() {
+		var (
+			backupDir string
+			fpInfo    backup_filepath.FilePathInfo
+			toc       *utils.TOC
+		)
+		BeforeEach(func() {
+			backupDir, _ = ioutil.TempDir("", "verify")
+			fpInfo = backup_filepath.FilePathInfo{SegDirMap: map[int]string{-1: backupDir}, Timestamp: "20170101010101"}
+			_ = os.MkdirAll(fpInfo.GetDirForContent(-1), 0755)
+			_ = ioutil.WriteFile(fpInfo.GetMetadataFilePath(), []byte("abc"), 0644)
+			_ = ioutil.WriteFile(fpInfo.GetBackupReportFilePath(), []byte("report"), 0644)
+			toc = &utils.TOC{MetadataChecksum: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"}
+		})
+		AfterEach(func() {
+			_ = os.RemoveAll(backupDir)
+		})
+		It("finds no problems with intact metadata files", func() {
+			numProblems := manager.VerifyMetadataFiles(fpInfo, &backup_history.BackupConfig{}, toc)
+			Expect(numProblems).To(Equal(0))
+		})
+		It("reports a metadata file that does not match its checksum", func() {
+			_ = ioutil.WriteFile(fpInfo.GetMetadataFilePath(), []byte("abd"), 0644)
+			numProblems := manager.VerifyMetadataFiles(fpInfo, &backup_history.BackupConfig{}, toc)
+			Expect(numProblems).To(Equal(1))
+			Expect(testLogfile).To(gbytes.Say("Checksum mismatch for file"))
+		})
+		It("reports a missing statistics file", func() {
+			numProblems := manager.VerifyMetadataFiles(fpInfo, &backup_history.BackupConfig{WithStatistics: true}, toc)
+			Expect(numProblems).To(Equal(1))
+			Expect(testLogfile).To(gbytes.Say("Cannot access .*statistics.sql"))
+		})
+	})
+})
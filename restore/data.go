@@ -6,6 +6,8 @@ package restore
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 
@@ -23,30 +25,87 @@ var (
 
 func CopyTableIn(connectionPool *dbconn.DBConn, tableName string, tableAttributes string, destinationToRead string, singleDataFile bool, whichConn int) (int64, error) {
 	whichConn = connectionPool.ValidateConnNum(whichConn)
+	checksumManifest := ""
+	if MustGetFlagString(utils.PLUGIN_CONFIG) != "" && !singleDataFile {
+		checksumManifest = globalFPInfo.GetSegmentHelperFilePathForCopyCommand("checksums")
+	}
+	query := GetCopyTableInStatement(tableName, tableAttributes, destinationToRead, singleDataFile, checksumManifest)
+	result, err := connectionPool.Exec(query, whichConn)
+	if err != nil {
+		return 0, errors.Wrap(err, fmt.Sprintf("Error loading data into table %s", tableName))
+	}
+	numRows, _ := result.RowsAffected()
+	return numRows, err
+}
+
+/*
+ * Data read through a plugin is checked against the checksum manifest, if
+ * any, by gpbackup_helper as it passes through, so that a table whose data
+ * file fails verification fails its COPY and is not loaded.
+ */
+func GetCopyTableInStatement(tableName string, tableAttributes string, destinationToRead string, singleDataFile bool, checksumManifest string) string {
 	copyCommand := ""
 	readFromDestinationCommand := "cat"
 	customPipeThroughCommand := utils.GetPipeThroughProgram().InputCommand
+	checkErrorCommand := ""
 
 	if singleDataFile {
 		//helper.go handles compression, so we don't want to set it here
 		customPipeThroughCommand = "cat -"
+		/*
+		 * Each table is read from the helper's pipe file with the table oid
+		 * appended.  The helper creates the error file of its pipe file before it
+		 * closes the pipe of a table that fails checksum verification, so checking
+		 * for that file fails the COPY rather than loading the table.
+		 */
+		helperPipeFile := destinationToRead[:strings.LastIndex(destinationToRead, "_")]
+		checkErrorCommand = fmt.Sprintf(" && test ! -e %s_error", helperPipeFile)
 	} else if MustGetFlagString(utils.PLUGIN_CONFIG) != "" {
 		readFromDestinationCommand = fmt.Sprintf("%s restore_data %s", pluginConfig.ExecutablePath, pluginConfig.ConfigPath)
+		if checksumManifest != "" {
+			customPipeThroughCommand += fmt.Sprintf(" --data-file %s --checksum-manifest %s", destinationToRead, checksumManifest)
+		}
 	}
 
-	copyCommand = fmt.Sprintf("PROGRAM '%s %s | %s'", readFromDestinationCommand, destinationToRead, customPipeThroughCommand)
+	copyCommand = fmt.Sprintf("PROGRAM '%s %s | %s%s'", readFromDestinationCommand, destinationToRead, customPipeThroughCommand, checkErrorCommand)
 
-	query := fmt.Sprintf("COPY %s%s FROM %s WITH CSV DELIMITER '%s' ON SEGMENT;", tableName, tableAttributes, copyCommand, tableDelim)
-	result, err := connectionPool.Exec(query, whichConn)
+	return fmt.Sprintf("COPY %s%s FROM %s WITH CSV DELIMITER '%s' ON SEGMENT;", tableName, tableAttributes, copyCommand, tableDelim)
+}
+
+/*
+ * With --truncate-table, each table is truncated in a transaction that also
+ * loads its data, so that the table keeps its old contents if the load fails.
+ */
+func BeginTruncateTable(connectionPool *dbconn.DBConn, tableName string, whichConn int) error {
+	whichConn = connectionPool.ValidateConnNum(whichConn)
+	err := connectionPool.Begin(whichConn)
 	if err != nil {
-		return 0, errors.Wrap(err, fmt.Sprintf("Error loading data into table %s", tableName))
+		return errors.Wrap(err, fmt.Sprintf("Error starting transaction to load table %s", tableName))
 	}
-	numRows, _ := result.RowsAffected()
-	return numRows, err
+	_, err = connectionPool.Exec(fmt.Sprintf("TRUNCATE %s;", tableName), whichConn)
+	if err != nil {
+		_ = connectionPool.Rollback(whichConn)
+		return errors.Wrap(err, fmt.Sprintf("Error truncating table %s", tableName))
+	}
+	return nil
+}
+
+// Commits the truncate and load of a table if the load succeeded, and rolls them back otherwise
+func EndTruncateTable(connectionPool *dbconn.DBConn, tableName string, loadErr error, whichConn int) error {
+	whichConn = connectionPool.ValidateConnNum(whichConn)
+	if loadErr != nil {
+		_ = connectionPool.Rollback(whichConn)
+		return loadErr
+	}
+	err := connectionPool.Commit(whichConn)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Error committing data loaded into table %s", tableName))
+	}
+	return nil
 }
 
 func restoreSingleTableData(fpInfo *backup_filepath.FilePathInfo, entry utils.MasterDataEntry, tableNum uint32, totalTables int, whichConn int) error {
-	name := utils.MakeFQN(entry.Schema, entry.Name)
+	name := GetRestoredTableFQN(utils.MakeFQN(entry.Schema, entry.Name))
 	if gplog.GetVerbosity() > gplog.LOGINFO {
 		// No progress bar at this log level, so we note table count here
 		gplog.Verbose("Reading data for table %s from file (table %d of %d)", name, tableNum, totalTables)
@@ -59,15 +118,39 @@ func restoreSingleTableData(fpInfo *backup_filepath.FilePathInfo, entry utils.Ma
 	} else {
 		destinationToRead = fpInfo.GetTableBackupFilePathForCopyCommand(entry.Oid, utils.GetPipeThroughProgram().Extension, backupConfig.SingleDataFile)
 	}
+	utils.EmitTableStart(name, entry.Oid, entry.Size)
+	/*
+	 * A load that committed just before a restore was interrupted is not yet
+	 * recorded in the restore state, so a resumed restore truncates the tables it
+	 * created as it reloads them.  A data-only restore loads into tables that
+	 * existed before it, so it only truncates them with --truncate-table.
+	 */
+	truncateTable := MustGetFlagBool(utils.TRUNCATE_TABLE) ||
+		(MustGetFlagBool(utils.RESUME) && !backupConfig.DataOnly && !MustGetFlagBool(utils.DATA_ONLY))
+	if truncateTable {
+		err := BeginTruncateTable(connectionPool, name, whichConn)
+		if err != nil {
+			return err
+		}
+	}
 	numRowsRestored, err := CopyTableIn(connectionPool, name, entry.AttributeString, destinationToRead, backupConfig.SingleDataFile, whichConn)
-	if err != nil {
-		return err
+	if err == nil {
+		numRowsBackedUp := entry.RowsCopied
+		err = CheckRowsRestored(numRowsRestored, numRowsBackedUp, name)
+	}
+	if truncateTable {
+		err = EndTruncateTable(connectionPool, name, err, whichConn)
 	}
-	numRowsBackedUp := entry.RowsCopied
-	err = CheckRowsRestored(numRowsRestored, numRowsBackedUp, name)
 	if err != nil {
 		return err
 	}
+	utils.EmitTableFinish(name, entry.Oid, numRowsRestored, entry.Size)
+	if restoreState != nil {
+		err = restoreState.RecordTable(fpInfo.Timestamp, entry.Oid)
+		if err != nil {
+			return errors.Wrap(err, "Unable to write to restore state file")
+		}
+	}
 	return nil
 }
 
@@ -79,16 +162,40 @@ func CheckRowsRestored(rowsRestored int64, rowsBackedUp int64, tableName string)
 	return nil
 }
 
-func restoreDataFromTimestamp(fpInfo backup_filepath.FilePathInfo, dataEntries []utils.MasterDataEntry,
+/*
+ * Tables are restored largest first, using the sizes recorded in the TOC at
+ * backup time, so that the smaller tables fill in around the larger ones.
+ * Backups taken before sizes were recorded keep their original order.
+ */
+func SortDataEntriesBySize(dataEntries []utils.MasterDataEntry) []utils.MasterDataEntry {
+	sortedEntries := make([]utils.MasterDataEntry, len(dataEntries))
+	copy(sortedEntries, dataEntries)
+	sort.SliceStable(sortedEntries, func(i int, j int) bool {
+		return sortedEntries[i].Size > sortedEntries[j].Size
+	})
+	for i, entry := range sortedEntries {
+		gplog.Verbose("Data restore order %d of %d: table %s (%d bytes)", i+1, len(sortedEntries), utils.MakeFQN(entry.Schema, entry.Name), entry.Size)
+	}
+	return sortedEntries
+}
+
+func restoreDataFromTimestamp(fpInfo backup_filepath.FilePathInfo, dataEntries []utils.MasterDataEntry, segmentTOCChecksums map[int]string,
 	gucStatements []utils.StatementWithType, dataProgressBar utils.ProgressBar) {
+	if restoreState != nil {
+		dataEntries = GetDataEntriesToResume(fpInfo.Timestamp, dataEntries, dataProgressBar)
+	}
 	if len(dataEntries) == 0 {
 		gplog.Verbose("No data to restore for timestamp = %s", fpInfo.Timestamp)
 		return
 	}
+	VerifyDataFileChecksumsOnSegments(fpInfo, dataEntries, segmentTOCChecksums)
+	// A single data file has to be read in the order it was written
+	if !backupConfig.SingleDataFile {
+		dataEntries = SortDataEntriesBySize(dataEntries)
+	}
 
 	if backupConfig.SingleDataFile {
 		gplog.Verbose("Initializing pipes and gpbackup_helper on segments for single data file restore")
-		utils.VerifyHelperVersionOnSegments(version, globalCluster)
 		filteredOids := make([]string, len(dataEntries))
 		for i, entry := range dataEntries {
 			filteredOids[i] = fmt.Sprintf("%d", entry.Oid)
@@ -99,7 +206,13 @@ func restoreDataFromTimestamp(fpInfo backup_filepath.FilePathInfo, dataEntries [
 		if wasTerminated {
 			return
 		}
-		utils.StartAgent(globalCluster, fpInfo, "--restore-agent", MustGetFlagString(utils.PLUGIN_CONFIG), "")
+		compressStr := ""
+		if backupConfig.Compressed {
+			compressStr = fmt.Sprintf(" --compression-type %s", backupConfig.GetCompressionType())
+		}
+		utils.StartAgent(globalCluster, fpInfo, "--restore-agent", MustGetFlagString(utils.PLUGIN_CONFIG), compressStr)
+		stopSegmentProgressPolling := utils.StartSegmentProgressPolling(globalCluster, fpInfo)
+		defer stopSegmentProgressPolling()
 	}
 	/*
 	 * We break when an interrupt is received and rely on
@@ -123,6 +236,7 @@ func restoreDataFromTimestamp(fpInfo backup_filepath.FilePathInfo, dataEntries [
 				}
 				err := restoreSingleTableData(&fpInfo, entry, tableNum, len(dataEntries), whichConn)
 				if err != nil {
+					utils.EmitError(utils.MakeFQN(entry.Schema, entry.Name), err.Error())
 					if MustGetFlagBool(utils.ON_ERROR_CONTINUE) {
 						gplog.Verbose(err.Error())
 						atomic.AddInt32(&numErrors, 1)
@@ -4,11 +4,13 @@ import (
 	"regexp"
 
 	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/backup_filepath"
 	"github.com/greenplum-db/gpbackup/restore"
 	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
 	"gopkg.in/DATA-DOG/go-sqlmock.v1"
 )
 
@@ -18,6 +20,8 @@ var _ = Describe("restore/data tests", func() {
 			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "cat", OutputCommand: "cat -", InputCommand: "cat -", Extension: ""})
 			backup.SetPluginConfig(nil)
 			cmdFlags.Set(utils.PLUGIN_CONFIG, "")
+			fpInfo := backup_filepath.FilePathInfo{PID: 1234, Timestamp: "20170101010101"}
+			restore.SetFPInfo(fpInfo)
 		})
 		It("will restore a table from its own file with compression", func() {
 			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "gzip", OutputCommand: "gzip -c -1", InputCommand: "gzip -d -c", Extension: ".gz"})
@@ -37,7 +41,7 @@ var _ = Describe("restore/data tests", func() {
 			Expect(err).ShouldNot(HaveOccurred())
 		})
 		It("will restore a table from a single data file", func() {
-			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456 | cat -' WITH CSV DELIMITER ',' ON SEGMENT;")
+			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456 | cat - && test ! -e <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_error' WITH CSV DELIMITER ',' ON SEGMENT;")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456"
 			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, true, 0)
@@ -45,11 +49,11 @@ var _ = Describe("restore/data tests", func() {
 			Expect(err).ShouldNot(HaveOccurred())
 		})
 		It("will restore a table from its own file with compression using a plugin", func() {
-			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "gzip", OutputCommand: "gzip -c -1", InputCommand: "gzip -d -c", Extension: ".gz"})
+			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "gzip", OutputCommand: "/usr/local/gpdb/bin/gpbackup_helper --compress --compression-type gzip --compression-level 1", InputCommand: "/usr/local/gpdb/bin/gpbackup_helper --decompress --compression-type gzip", Extension: ".gz"})
 			cmdFlags.Set(utils.PLUGIN_CONFIG, "/tmp/plugin_config")
 			pluginConfig := utils.PluginConfig{ExecutablePath: "/tmp/fake-plugin.sh", ConfigPath: "/tmp/plugin_config"}
 			restore.SetPluginConfig(&pluginConfig)
-			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM '/tmp/fake-plugin.sh restore_data /tmp/plugin_config <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456.gz | gzip -d -c' WITH CSV DELIMITER ',' ON SEGMENT;")
+			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM '/tmp/fake-plugin.sh restore_data /tmp/plugin_config <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456.gz | /usr/local/gpdb/bin/gpbackup_helper --decompress --compression-type gzip --data-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456.gz --checksum-manifest <SEG_DATA_DIR>/gpbackup_<SEGID>_20170101010101_checksums_1234' WITH CSV DELIMITER ',' ON SEGMENT;")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456.gz"
@@ -58,10 +62,11 @@ var _ = Describe("restore/data tests", func() {
 			Expect(err).ShouldNot(HaveOccurred())
 		})
 		It("will restore a table from its own file without compression using a plugin", func() {
+			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "cat", OutputCommand: "/usr/local/gpdb/bin/gpbackup_helper --compress", InputCommand: "/usr/local/gpdb/bin/gpbackup_helper --decompress", Extension: ""})
 			cmdFlags.Set(utils.PLUGIN_CONFIG, "/tmp/plugin_config")
 			pluginConfig := utils.PluginConfig{ExecutablePath: "/tmp/fake-plugin.sh", ConfigPath: "/tmp/plugin_config"}
 			restore.SetPluginConfig(&pluginConfig)
-			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM '/tmp/fake-plugin.sh restore_data /tmp/plugin_config <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456.gz | cat -' WITH CSV DELIMITER ',' ON SEGMENT;")
+			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM '/tmp/fake-plugin.sh restore_data /tmp/plugin_config <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456.gz | /usr/local/gpdb/bin/gpbackup_helper --decompress --data-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456.gz --checksum-manifest <SEG_DATA_DIR>/gpbackup_<SEGID>_20170101010101_checksums_1234' WITH CSV DELIMITER ',' ON SEGMENT;")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456.gz"
@@ -70,6 +75,49 @@ var _ = Describe("restore/data tests", func() {
 			Expect(err).ShouldNot(HaveOccurred())
 		})
 	})
+	Describe("BeginTruncateTable", func() {
+		It("truncates the table in a new transaction", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("TRUNCATE public.foo;")).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+
+			err := restore.BeginTruncateTable(connectionPool, "public.foo", 0)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = restore.EndTruncateTable(connectionPool, "public.foo", nil, 0)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+		It("rolls back the transaction if the table cannot be truncated", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("TRUNCATE public.foo;")).WillReturnError(errors.New("permission denied for relation foo"))
+			mock.ExpectRollback()
+
+			err := restore.BeginTruncateTable(connectionPool, "public.foo", 0)
+			Expect(err).To(MatchError("Error truncating table public.foo: permission denied for relation foo"))
+		})
+	})
+	Describe("EndTruncateTable", func() {
+		It("rolls back the truncate if the table's data failed to load", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("TRUNCATE public.foo;")).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectRollback()
+			loadErr := errors.New("Expected to restore 10 rows to table public.foo, but restored 5 instead")
+
+			err := restore.BeginTruncateTable(connectionPool, "public.foo", 0)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = restore.EndTruncateTable(connectionPool, "public.foo", loadErr, 0)
+			Expect(err).To(Equal(loadErr))
+		})
+	})
+	Describe("SortDataEntriesBySize", func() {
+		It("orders entries largest first, keeping TOC order for entries of equal size", func() {
+			small := utils.MasterDataEntry{Schema: "public", Name: "small", Oid: 1, Size: 100}
+			large := utils.MasterDataEntry{Schema: "public", Name: "large", Oid: 2, Size: 1000}
+			unknown1 := utils.MasterDataEntry{Schema: "public", Name: "unknown1", Oid: 3}
+			unknown2 := utils.MasterDataEntry{Schema: "public", Name: "unknown2", Oid: 4}
+			sortedEntries := restore.SortDataEntriesBySize([]utils.MasterDataEntry{unknown1, small, unknown2, large})
+			Expect(sortedEntries).To(Equal([]utils.MasterDataEntry{large, small, unknown1, unknown2}))
+		})
+	})
 	Describe("CheckRowsRestored", func() {
 		var (
 			expectedRows int64 = 10
@@ -0,0 +1,142 @@
+package restore
+
+/*
+ * This file contains functions for --dry-run, which reports what a restore
+ * would do without changing any database.
+ */
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gpbackup/backup_filepath"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+/*
+ * A dry run, like --output-sql, validates the restore database as a restore
+ * would, but it does not create a restore state file or the database, and the
+ * relations that would keep the restore from succeeding are not treated as
+ * errors; a dry run reports them instead.
+ */
+func setupDryRun(unquotedRestoreDatabase string) {
+	ValidateDatabaseExistence(unquotedRestoreDatabase, MustGetFlagBool(utils.CREATE_DB), backupConfig.IncludeTableFiltered || backupConfig.DataOnly)
+	// A database that --create-db would create does not exist yet, so there is nothing in it to inspect
+	if !MustGetFlagBool(utils.CREATE_DB) {
+		connectionPool.Close()
+		InitializeConnectionPool(unquotedRestoreDatabase)
+	}
+	InitializeRedirectSchemas()
+	InitializeRedirectTables()
+}
+
+func DoDryRun(writer io.Writer) {
+	metadataFilename := globalFPInfo.GetMetadataFilePath()
+	isDataOnly := backupConfig.DataOnly || MustGetFlagBool(utils.DATA_ONLY)
+	isMetadataOnly := backupConfig.MetadataOnly || MustGetFlagBool(utils.METADATA_ONLY)
+	if !isDataOnly {
+		schemaStatements := GetRestoreMetadataStatements("predata", metadataFilename, []string{"SCHEMA"}, []string{}, true, false)
+		statements := GetRestoreMetadataStatements("predata", metadataFilename, []string{}, []string{"SCHEMA"}, true, true)
+		PrintDryRunStatements(writer, "Pre-data", append(schemaStatements, statements...))
+	}
+
+	if !isMetadataOnly {
+		fpInfoList := GetBackupFPInfoListFromRestorePlan()
+		for i, fpInfo := range fpInfoList {
+			toc := utils.NewTOC(fpInfo.GetTOCFilePath())
+			dataEntries := getFilteredDataEntries(toc, backupConfig.RestorePlan[i].TableFQNs)
+			PrintDryRunDataEntries(writer, fpInfo, dataEntries, utils.GetPipeThroughProgram().Extension, backupConfig.SingleDataFile)
+		}
+		PrintDryRunSegmentDirectories(writer, globalCluster, fpInfoList)
+	}
+
+	if !isDataOnly {
+		statements := GetRestoreMetadataStatements("postdata", metadataFilename, []string{}, []string{}, true, true)
+		PrintDryRunStatements(writer, "Post-data", statements)
+	}
+
+	if MustGetFlagBool(utils.WITH_STATS) && backupConfig.WithStatistics {
+		statements := GetRestoreMetadataStatements("statistics", globalFPInfo.GetStatisticsFilePath(), []string{}, []string{}, true, false)
+		PrintDryRunStatements(writer, "Statistics", statements)
+	}
+
+	if !MustGetFlagBool(utils.CREATE_DB) {
+		relationList := GenerateRestoreRelationList()
+		for i, relation := range relationList {
+			relationList[i] = GetRestoredTableFQN(relation)
+		}
+		relationsInDB := make([]string, 0)
+		if len(relationList) > 0 {
+			relationsInDB = GetRelationsInRestoreDatabase(connectionPool, relationList)
+		}
+		PrintDryRunRelations(writer, connectionPool.DBName, relationList, relationsInDB, isDataOnly)
+	}
+}
+
+// Statements are printed in the order in which the restore would execute them
+func PrintDryRunStatements(writer io.Writer, section string, statements []utils.StatementWithType) {
+	fmt.Fprintf(writer, "%s statements (%d):\n", section, len(statements))
+	for _, statement := range statements {
+		fmt.Fprintf(writer, "\n%s\n", strings.TrimSpace(statement.Statement))
+	}
+	fmt.Fprintln(writer)
+}
+
+/*
+ * The data file paths are those passed to COPY, in which <SEGID> and
+ * <SEG_DATA_DIR> stand for the content ID and data directory of each segment.
+ */
+func PrintDryRunDataEntries(writer io.Writer, fpInfo backup_filepath.FilePathInfo, dataEntries []utils.MasterDataEntry, extension string, singleDataFile bool) {
+	fmt.Fprintf(writer, "Table data from backup %s (%d tables):\n", fpInfo.Timestamp, len(dataEntries))
+	tabWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	var totalRows int64
+	for _, entry := range dataEntries {
+		tableName := GetRestoredTableFQN(utils.MakeFQN(entry.Schema, entry.Name))
+		dataFile := fpInfo.GetTableBackupFilePathForCopyCommand(entry.Oid, extension, singleDataFile)
+		fmt.Fprintf(tabWriter, "  %s\t%d rows\t%s\n", tableName, entry.RowsCopied, dataFile)
+		totalRows += entry.RowsCopied
+	}
+	_ = tabWriter.Flush()
+	fmt.Fprintf(writer, "Expected rows: %d\n\n", totalRows)
+}
+
+func PrintDryRunSegmentDirectories(writer io.Writer, c *cluster.Cluster, fpInfoList []backup_filepath.FilePathInfo) {
+	fmt.Fprintln(writer, "Segment backup directories:")
+	tabWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	for _, fpInfo := range fpInfoList {
+		for _, contentID := range c.ContentIDs {
+			if contentID == -1 {
+				continue
+			}
+			fmt.Fprintf(tabWriter, "  %d\t%s\t%s\n", contentID, c.GetHostForContent(contentID), fpInfo.GetDirForContent(contentID))
+		}
+	}
+	_ = tabWriter.Flush()
+	fmt.Fprintln(writer)
+}
+
+/*
+ * These are the relations that ValidateRelationsInRestoreDatabase would reject:
+ * those that already exist, or for a data-only restore those that do not.
+ */
+func PrintDryRunRelations(writer io.Writer, dbName string, relationList []string, relationsInDB []string, isDataOnly bool) {
+	conflicts := relationsInDB
+	message := "Relations that already exist in database %s (%d):\n"
+	if isDataOnly {
+		conflicts = make([]string, 0)
+		dbRelationsSet := utils.NewSet(relationsInDB)
+		for _, relation := range relationList {
+			if !dbRelationsSet.MatchesFilter(relation) {
+				conflicts = append(conflicts, relation)
+			}
+		}
+		message = "Relations that do not exist in database %s (%d):\n"
+	}
+	fmt.Fprintf(writer, message, dbName, len(conflicts))
+	for _, relation := range conflicts {
+		fmt.Fprintf(writer, "  %s\n", relation)
+	}
+}
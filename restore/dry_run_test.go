@@ -0,0 +1,79 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gpbackup/backup_filepath"
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/dry_run tests", func() {
+	testCluster := cluster.NewCluster([]cluster.SegConfig{
+		{ContentID: -1, Hostname: "localhost", DataDir: "/data/gpseg-1"},
+		{ContentID: 0, Hostname: "localhost", DataDir: "/data/gpseg0"},
+		{ContentID: 1, Hostname: "remotehost1", DataDir: "/data/gpseg1"},
+	})
+	testFPInfo := backup_filepath.NewFilePathInfo(testCluster, "", "20170101010101", "gpseg")
+	Describe("PrintDryRunStatements", func() {
+		It("prints the statements in order under the section name", func() {
+			statements := []utils.StatementWithType{
+				{ObjectType: "SCHEMA", Statement: "\n\nCREATE SCHEMA foo;\n"},
+				{ObjectType: "TABLE", Statement: "\n\nCREATE TABLE foo.bar (i int);\n"},
+			}
+
+			restore.PrintDryRunStatements(buffer, "Pre-data", statements)
+
+			Expect(string(buffer.Contents())).To(Equal(`Pre-data statements (2):
+
+CREATE SCHEMA foo;
+
+CREATE TABLE foo.bar (i int);
+
+`))
+		})
+	})
+	Describe("PrintDryRunDataEntries", func() {
+		It("prints each table with its expected row count and data file", func() {
+			dataEntries := []utils.MasterDataEntry{
+				{Schema: "public", Name: "foo", Oid: 1, RowsCopied: 10},
+				{Schema: "public", Name: "barbaz", Oid: 2, RowsCopied: 5},
+			}
+
+			restore.PrintDryRunDataEntries(buffer, testFPInfo, dataEntries, ".gz", false)
+
+			Expect(string(buffer.Contents())).To(Equal(`Table data from backup 20170101010101 (2 tables):
+  public.foo     10 rows  <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_1.gz
+  public.barbaz  5 rows   <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_2.gz
+Expected rows: 15
+
+`))
+		})
+	})
+	Describe("PrintDryRunSegmentDirectories", func() {
+		It("prints the backup directory of each segment", func() {
+			restore.PrintDryRunSegmentDirectories(buffer, testCluster, []backup_filepath.FilePathInfo{testFPInfo})
+
+			Expect(string(buffer.Contents())).To(Equal(`Segment backup directories:
+  0  localhost    /data/gpseg0/backups/20170101/20170101010101
+  1  remotehost1  /data/gpseg1/backups/20170101/20170101010101
+
+`))
+		})
+	})
+	Describe("PrintDryRunRelations", func() {
+		relationList := []string{"public.foo", "public.bar"}
+		It("prints the relations that already exist", func() {
+			restore.PrintDryRunRelations(buffer, "testdb", relationList, []string{"public.bar"}, false)
+
+			Expect(string(buffer.Contents())).To(Equal("Relations that already exist in database testdb (1):\n  public.bar\n"))
+		})
+		It("prints the relations that do not exist for a data-only restore", func() {
+			restore.PrintDryRunRelations(buffer, "testdb", relationList, []string{"public.bar"}, true)
+
+			Expect(string(buffer.Contents())).To(Equal("Relations that do not exist in database testdb (1):\n  public.foo\n"))
+		})
+	})
+})
@@ -28,9 +28,20 @@ var (
 	globalTOC        *utils.TOC
 	pluginConfig     *utils.PluginConfig
 	restoreStartTime string
+	restoreState     *RestoreState
 	version          string
 	wasTerminated    bool
 
+	// Maps quoted source schema names to the quoted schemas they are restored to
+	redirectSchemas map[string]string
+	// The FQNs of the objects in the redirected schemas, whose references are rewritten
+	redirectedObjectNames map[string]bool
+	// Maps the FQNs of tables in the backup to the FQNs they are restored to
+	redirectTables map[string]string
+
+	// Only set when restoring the data of an incremental backup
+	restoreDataSources *utils.RestoreDataSources
+
 	/*
 	 * Used for synchronizing DoCleanup.  In DoInit() we increment the group
 	 * and then wait for at least one DoCleanup to finish, either in DoTeardown
@@ -76,6 +87,10 @@ func SetTOC(toc *utils.TOC) {
 	globalTOC = toc
 }
 
+func SetRestoreState(state *RestoreState) {
+	restoreState = state
+}
+
 // Util functions to enable ease of access to global flag values
 
 func MustGetFlagString(flagName string) string {
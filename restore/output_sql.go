@@ -0,0 +1,101 @@
+package restore
+
+/*
+ * This file contains functions for --output-sql, which writes the statements
+ * that a restore would execute to a SQL script instead of executing them.
+ */
+
+import (
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/backup_filepath"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+/*
+ * The script is meant to be run with psql.  Global statements are executed
+ * in whatever database psql is connected to, so the script connects to the
+ * restore database after them, as gprestore does.
+ */
+func DoOutputSQL(filename string) {
+	metadataFilename := globalFPInfo.GetMetadataFilePath()
+	isDataOnly := backupConfig.DataOnly || MustGetFlagBool(utils.DATA_ONLY)
+	isMetadataOnly := backupConfig.MetadataOnly || MustGetFlagBool(utils.METADATA_ONLY)
+	gplog.Info("Writing restore statements to %s", filename)
+	scriptFile := iohelper.MustOpenFileForWriting(filename)
+	script := utils.NewFileWithByteCount(scriptFile)
+	script.MustPrintf("--\n-- SQL script written by gprestore %s for backup %s\n--\n", version, globalFPInfo.Timestamp)
+
+	if MustGetFlagBool(utils.WITH_GLOBALS) {
+		WriteSQLStatements(script, "Global metadata", getGlobalStatements(metadataFilename))
+		WriteSQLConnect(script, getRestoreDatabaseName())
+	} else if MustGetFlagBool(utils.CREATE_DB) {
+		WriteSQLStatements(script, "Database", getCreateDatabaseStatements(metadataFilename))
+		WriteSQLConnect(script, getRestoreDatabaseName())
+	}
+	gucStatements := GetRestoreMetadataStatements("global", metadataFilename, []string{"SESSION GUCS"}, []string{}, false, false)
+	WriteSQLStatements(script, "Session GUCs", gucStatements)
+
+	if !isDataOnly {
+		schemaStatements := GetRestoreMetadataStatements("predata", metadataFilename, []string{"SCHEMA"}, []string{}, true, false)
+		statements := GetRestoreMetadataStatements("predata", metadataFilename, []string{}, []string{"SCHEMA"}, true, true)
+		WriteSQLStatements(script, "Pre-data", append(schemaStatements, statements...))
+	}
+
+	if !isMetadataOnly {
+		for i, fpInfo := range GetBackupFPInfoListFromRestorePlan() {
+			toc := utils.NewTOC(fpInfo.GetTOCFilePath())
+			dataEntries := getFilteredDataEntries(toc, backupConfig.RestorePlan[i].TableFQNs)
+			WriteSQLCopyStatements(script, fpInfo, dataEntries, utils.GetPipeThroughProgram().Extension, backupConfig.SingleDataFile)
+		}
+	}
+
+	if !isDataOnly {
+		statements := GetRestoreMetadataStatements("postdata", metadataFilename, []string{}, []string{}, true, true)
+		WriteSQLStatements(script, "Post-data", statements)
+	}
+
+	if MustGetFlagBool(utils.WITH_STATS) && backupConfig.WithStatistics {
+		statements := GetRestoreMetadataStatements("statistics", globalFPInfo.GetStatisticsFilePath(), []string{}, []string{}, true, false)
+		WriteSQLStatements(script, "Statistics", statements)
+	}
+
+	err := scriptFile.Close()
+	gplog.FatalOnError(err, "Unable to close file %s", filename)
+}
+
+func WriteSQLStatements(script *utils.FileWithByteCount, section string, statements []utils.StatementWithType) {
+	script.MustPrintf("\n--\n-- %s\n--\n", section)
+	for _, statement := range statements {
+		script.MustPrintf("\n%s\n", strings.TrimSpace(statement.Statement))
+	}
+}
+
+func WriteSQLConnect(script *utils.FileWithByteCount, quotedDBName string) {
+	script.MustPrintf("\n\\connect %s\n", quotedDBName)
+}
+
+/*
+ * Table data is not loaded by the script, so the COPY statements that would
+ * load it are commented out.  COPY ... ON SEGMENT replaces <SEGID> and
+ * <SEG_DATA_DIR> in the data file paths on each segment, so uncommenting a
+ * statement loads that table.  The data files of a single-data-file backup
+ * can only be read through gpbackup_helper, so only the tables are listed.
+ */
+func WriteSQLCopyStatements(script *utils.FileWithByteCount, fpInfo backup_filepath.FilePathInfo, dataEntries []utils.MasterDataEntry, extension string, singleDataFile bool) {
+	script.MustPrintf("\n--\n-- Table data from backup %s\n--\n", fpInfo.Timestamp)
+	if singleDataFile {
+		script.MustPrintf("-- This backup has a single data file per segment, so its table data must be restored with gprestore\n")
+	}
+	for _, entry := range dataEntries {
+		tableName := GetRestoredTableFQN(utils.MakeFQN(entry.Schema, entry.Name))
+		script.MustPrintf("\n-- Table %s (%d rows)\n", tableName, entry.RowsCopied)
+		if singleDataFile {
+			continue
+		}
+		dataFile := fpInfo.GetTableBackupFilePathForCopyCommand(entry.Oid, extension, false)
+		script.MustPrintf("-- %s\n", GetCopyTableInStatement(tableName, entry.AttributeString, dataFile, false, ""))
+	}
+}
@@ -0,0 +1,73 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gpbackup/backup_filepath"
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/output_sql tests", func() {
+	var script *utils.FileWithByteCount
+	BeforeEach(func() {
+		script = utils.NewFileWithByteCount(buffer)
+	})
+	Describe("WriteSQLStatements", func() {
+		It("writes the statements in order after a section comment", func() {
+			statements := []utils.StatementWithType{
+				{ObjectType: "SCHEMA", Statement: "\n\nCREATE SCHEMA foo;\n"},
+				{ObjectType: "TABLE", Statement: "\n\nCREATE TABLE foo.bar (i int);\n"},
+			}
+
+			restore.WriteSQLStatements(script, "Pre-data", statements)
+			restore.WriteSQLConnect(script, `"Test DB"`)
+
+			Expect(string(buffer.Contents())).To(Equal(`
+--
+-- Pre-data
+--
+
+CREATE SCHEMA foo;
+
+CREATE TABLE foo.bar (i int);
+
+\connect "Test DB"
+`))
+		})
+	})
+	Describe("WriteSQLCopyStatements", func() {
+		testCluster := cluster.NewCluster([]cluster.SegConfig{{ContentID: -1, Hostname: "localhost", DataDir: "/data/gpseg-1"}})
+		testFPInfo := backup_filepath.NewFilePathInfo(testCluster, "", "20170101010101", "gpseg")
+		dataEntries := []utils.MasterDataEntry{{Schema: "public", Name: "foo", Oid: 1, AttributeString: "(i,j)", RowsCopied: 10}}
+		BeforeEach(func() {
+			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "gzip", OutputCommand: "gzip -c -1", InputCommand: "gzip -d -c", Extension: ".gz"})
+		})
+		It("writes a commented COPY statement for each table", func() {
+			restore.WriteSQLCopyStatements(script, testFPInfo, dataEntries, ".gz", false)
+
+			Expect(string(buffer.Contents())).To(Equal(`
+--
+-- Table data from backup 20170101010101
+--
+
+-- Table public.foo (10 rows)
+-- COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_1.gz | gzip -d -c' WITH CSV DELIMITER ',' ON SEGMENT;
+`))
+		})
+		It("only lists the tables of a single-data-file backup", func() {
+			restore.WriteSQLCopyStatements(script, testFPInfo, dataEntries, ".gz", true)
+
+			Expect(string(buffer.Contents())).To(Equal(`
+--
+-- Table data from backup 20170101010101
+--
+-- This backup has a single data file per segment, so its table data must be restored with gprestore
+
+-- Table public.foo (10 rows)
+`))
+		})
+	})
+})
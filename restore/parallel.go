@@ -12,6 +12,7 @@ import (
 
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
 )
 
 func executeStatementsForConn(statements chan utils.StatementWithType, fatalErr *error, numErrors *int32, progressBar utils.ProgressBar, whichConn int) {
@@ -22,11 +23,17 @@ func executeStatementsForConn(statements chan utils.StatementWithType, fatalErr
 		_, err := connectionPool.Exec(statement.Statement, whichConn)
 		if err != nil {
 			gplog.Verbose("Error encountered when executing statement: %s Error was: %s", strings.TrimSpace(statement.Statement), err.Error())
+			utils.EmitError("", fmt.Sprintf("Error encountered when restoring %s %s: %s", statement.ObjectType, statement.Name, err.Error()))
 			if MustGetFlagBool(utils.ON_ERROR_CONTINUE) {
 				atomic.AddInt32(numErrors, 1)
 			} else {
 				*fatalErr = err
 			}
+		} else if restoreState != nil {
+			err = restoreState.RecordStatement(statement)
+			if err != nil {
+				*fatalErr = errors.Wrap(err, "Unable to write to restore state file")
+			}
 		}
 		progressBar.Increment()
 	}
@@ -8,6 +8,7 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/backup_filepath"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/pkg/errors"
 )
@@ -72,3 +73,138 @@ func VerifyMetadataFilePaths(withStats bool) {
 		gplog.Fatal(errors.Errorf("One or more metadata files do not exist or are not readable."), "Cannot proceed with restore")
 	}
 }
+
+// The TOC is verified before it is parsed, as the other checksums are recorded in it
+func VerifyTOCChecksum() {
+	err := utils.VerifyFileChecksum(globalFPInfo.GetTOCFilePath(), backupConfig.TOCChecksum)
+	if err != nil {
+		gplog.Fatal(err, "Cannot proceed with restore")
+	}
+}
+
+func VerifyMetadataFileChecksums(withStats bool) {
+	checksumMap := map[string]string{
+		globalFPInfo.GetMetadataFilePath(): globalTOC.MetadataChecksum,
+	}
+	if withStats {
+		checksumMap[globalFPInfo.GetStatisticsFilePath()] = globalTOC.StatisticsChecksum
+	}
+	numCorrupted := 0
+	for filename, checksum := range checksumMap {
+		err := utils.VerifyFileChecksum(filename, checksum)
+		if err != nil {
+			gplog.Error(err.Error())
+			numCorrupted++
+		}
+	}
+	if numCorrupted > 0 {
+		gplog.Fatal(errors.Errorf("%d metadata file(s) failed checksum verification.", numCorrupted), "Cannot proceed with restore")
+	}
+}
+
+/*
+ * Checksums are verified on the segments before any data is loaded.  Data
+ * stored with a plugin cannot be read without restoring it, so the data files
+ * of plugin backups are not verified here.  Instead, gpbackup_helper checks
+ * each table in a single data file, and each data file of a plugin backup
+ * against the manifests copied here, as the data is read, failing the COPY of
+ * any table that does not match.
+ */
+func VerifyDataFileChecksumsOnSegments(fpInfo backup_filepath.FilePathInfo, dataEntries []utils.MasterDataEntry, segmentTOCChecksums map[int]string) {
+	if backupConfig.SingleDataFile {
+		VerifySegmentTOCChecksumsOnSegments(fpInfo, segmentTOCChecksums)
+	}
+	if MustGetFlagString(utils.PLUGIN_CONFIG) != "" {
+		if !backupConfig.SingleDataFile {
+			// The manifests are copied even if empty, as every COPY reads them, and are removed in cleanup
+			manifests := GetDataFileChecksumManifests(fpInfo, dataEntries, utils.GetPipeThroughProgram().Extension)
+			utils.CopyFileListsToSegments(manifests, "checksums", globalCluster, globalFPInfo)
+		}
+		gplog.Verbose("Data file checksums for plugin backup with timestamp %s are verified as the data is restored", fpInfo.Timestamp)
+		return
+	}
+	if !backupConfig.SingleDataFile {
+		manifests := GetDataFileChecksumManifests(fpInfo, dataEntries, utils.GetPipeThroughProgram().Extension)
+		if len(manifests) == 0 {
+			gplog.Verbose("No data file checksums are recorded for backup with timestamp %s", fpInfo.Timestamp)
+			return
+		}
+		utils.CopyFileListsToSegments(manifests, "checksums", globalCluster, fpInfo)
+	}
+	remoteOutput := globalCluster.GenerateAndExecuteCommand("Verifying data file checksums", func(contentID int) string {
+		if backupConfig.SingleDataFile {
+			tocFile := fpInfo.GetSegmentTOCFilePath(contentID)
+			dataFile := fpInfo.GetTableBackupFilePath(contentID, 0, utils.GetPipeThroughProgram().Extension, true)
+			return fmt.Sprintf("CHECKSUM=`awk '/^checksum:/ {gsub(/\"/, \"\", $2); print $2}' %s`; if [[ -n \"$CHECKSUM\" ]]; then echo \"$CHECKSUM  %s\" | %s --check --quiet 2>/dev/null || true; fi",
+				tocFile, dataFile, utils.ChecksumProgram)
+		}
+		return utils.GetVerifyChecksumsCommand(fpInfo.GetSegmentHelperFilePath(contentID, "checksums"))
+	}, cluster.ON_SEGMENTS)
+	globalCluster.CheckClusterError(remoteOutput, "Could not verify data file checksums", func(contentID int) string {
+		return fmt.Sprintf("Could not verify data file checksums for segment %d on host %s", contentID, globalCluster.GetHostForContent(contentID))
+	})
+
+	numCorrupted := 0
+	for contentID := range remoteOutput.Stdouts {
+		for _, filename := range utils.ParseFailedChecksumOutput(remoteOutput.Stdouts[contentID]) {
+			gplog.Error("Data file %s on segment %d on host %s is missing or failed checksum verification", filename, contentID, globalCluster.GetHostForContent(contentID))
+			numCorrupted++
+		}
+	}
+	if numCorrupted > 0 {
+		gplog.Fatal(errors.Errorf("%d data file(s) failed checksum verification.", numCorrupted), "Cannot proceed with restore")
+	}
+}
+
+/*
+ * The segment TOCs locate and checksum each table in a single data file, so
+ * they are checked against the checksums recorded in the master TOC before
+ * anything reads them.  Backups taken before these checksums were recorded
+ * have none to check.
+ */
+func VerifySegmentTOCChecksumsOnSegments(fpInfo backup_filepath.FilePathInfo, segmentTOCChecksums map[int]string) {
+	if len(segmentTOCChecksums) == 0 {
+		gplog.Verbose("No segment TOC checksums are recorded for backup with timestamp %s", fpInfo.Timestamp)
+		return
+	}
+	remoteOutput := globalCluster.GenerateAndExecuteCommand("Verifying segment TOC checksums", func(contentID int) string {
+		tocFile := fpInfo.GetSegmentTOCFilePath(contentID)
+		checksum, ok := segmentTOCChecksums[contentID]
+		if !ok {
+			return fmt.Sprintf("echo \"%s: FAILED\"", tocFile)
+		}
+		return fmt.Sprintf("echo \"%s  %s\" | %s --check --quiet 2>/dev/null || true", checksum, tocFile, utils.ChecksumProgram)
+	}, cluster.ON_SEGMENTS)
+	globalCluster.CheckClusterError(remoteOutput, "Could not verify segment TOC checksums", func(contentID int) string {
+		return fmt.Sprintf("Could not verify segment TOC checksum for segment %d on host %s", contentID, globalCluster.GetHostForContent(contentID))
+	})
+
+	numCorrupted := 0
+	for contentID := range remoteOutput.Stdouts {
+		for _, filename := range utils.ParseFailedChecksumOutput(remoteOutput.Stdouts[contentID]) {
+			gplog.Error("Segment TOC file %s on segment %d on host %s is missing or failed checksum verification", filename, contentID, globalCluster.GetHostForContent(contentID))
+			numCorrupted++
+		}
+	}
+	if numCorrupted > 0 {
+		gplog.Fatal(errors.Errorf("%d segment TOC file(s) failed checksum verification.", numCorrupted), "Cannot proceed with restore")
+	}
+}
+
+// Returns the checksum manifest of each segment's data files, leaving out segments with no recorded checksums
+func GetDataFileChecksumManifests(fpInfo backup_filepath.FilePathInfo, dataEntries []utils.MasterDataEntry, extension string) map[int][]string {
+	checksumMaps := make(map[int]map[string]string)
+	for _, entry := range dataEntries {
+		for contentID, checksum := range entry.Checksums {
+			if checksumMaps[contentID] == nil {
+				checksumMaps[contentID] = make(map[string]string)
+			}
+			checksumMaps[contentID][fpInfo.GetTableBackupFilePath(contentID, entry.Oid, extension, false)] = checksum
+		}
+	}
+	manifests := make(map[int][]string, len(checksumMaps))
+	for contentID, checksumMap := range checksumMaps {
+		manifests[contentID] = utils.GetChecksumManifest(checksumMap)
+	}
+	return manifests
+}
@@ -79,4 +79,33 @@ var _ = Describe("restore/remote tests", func() {
 			restore.VerifyBackupFileCountOnSegments(2)
 		})
 	})
+	Describe("VerifySegmentTOCChecksumsOnSegments", func() {
+		It("skips verification if no segment TOC checksums are recorded", func() {
+			restore.SetCluster(testCluster)
+			restore.VerifySegmentTOCChecksumsOnSegments(testFPInfo, nil)
+			Expect((*testExecutor).NumExecutions).To(Equal(0))
+		})
+		It("successfully verifies all segment TOC checksums", func() {
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{
+				Stdouts: map[int]string{
+					0: "",
+					1: "",
+				},
+			}
+			restore.SetCluster(testCluster)
+			restore.VerifySegmentTOCChecksumsOnSegments(testFPInfo, map[int]string{0: "abc", 1: "def"})
+			Expect((*testExecutor).NumExecutions).To(Equal(1))
+		})
+		It("panics if a segment TOC fails checksum verification", func() {
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{
+				Stdouts: map[int]string{
+					0: "",
+					1: "/data/gpseg1/backups/20170101/20170101010101/gpbackup_1_20170101010101_toc.yaml: FAILED\n",
+				},
+			}
+			restore.SetCluster(testCluster)
+			defer testhelper.ShouldPanicWithMessage("1 segment TOC file(s) failed checksum verification.")
+			restore.VerifySegmentTOCChecksumsOnSegments(testFPInfo, map[int]string{0: "abc", 1: "def"})
+		})
+	})
 })
@@ -9,6 +9,7 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gpbackup/backup_filepath"
+	"github.com/greenplum-db/gpbackup/backup_history"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/spf13/cobra"
 
@@ -23,31 +24,43 @@ import (
 func initializeFlags(cmd *cobra.Command) {
 	SetFlagDefaults(cmd.Flags())
 
-	_ = cmd.MarkFlagRequired(utils.TIMESTAMP)
-
 	cmdFlags = cmd.Flags()
 }
 func SetFlagDefaults(flagSet *pflag.FlagSet) {
+	flagSet.String(utils.AS_OF, "", "Restore the latest successful backup of the --dbname database taken at or before this time, in the format \"YYYY-MM-DD HH:MM[:SS]\"")
 	flagSet.String(utils.BACKUP_DIR, "", "The absolute path of the directory in which the backup files to be restored are located")
 	flagSet.Bool(utils.CREATE_DB, false, "Create the database before metadata restore")
 	flagSet.Bool(utils.DATA_ONLY, false, "Only restore data, do not restore metadata")
+	flagSet.String(utils.DBNAME, "", "The database that was backed up, whose backups --timestamp latest and --as-of choose from. Required with either flag, even with --redirect-db")
 	flagSet.Bool(utils.DEBUG, false, "Print verbose and debug log messages")
+	flagSet.Bool(utils.DRY_RUN, false, "Print the statements and table data that would be restored, without changing any database")
+	flagSet.String(utils.ENCRYPTION_KEY_FILE, "", "The absolute path of a file, present on all hosts, containing the key with which the backup was encrypted")
 	flagSet.StringSlice(utils.EXCLUDE_SCHEMA, []string{}, "Restore all metadata except objects in the specified schema(s). --exclude-schema can be specified multiple times.")
 	flagSet.StringSlice(utils.EXCLUDE_RELATION, []string{}, "Restore all metadata except the specified relation(s). --exclude-table can be specified multiple times.")
 	flagSet.String(utils.EXCLUDE_RELATION_FILE, "", "A file containing a list of fully-qualified relation(s) that will not be restored")
 	flagSet.Bool("help", false, "Help for gprestore")
+	flagSet.String(utils.HISTORY_FILE, "", "The absolute path of the backup history file from which --timestamp latest and --as-of choose a backup. Defaults to gpbackup_history.yaml in the master data directory.")
 	flagSet.StringSlice(utils.INCLUDE_SCHEMA, []string{}, "Restore only the specified schema(s). --include-schema can be specified multiple times.")
 	flagSet.StringSlice(utils.INCLUDE_RELATION, []string{}, "Restore only the specified relation(s). --include-table can be specified multiple times.")
 	flagSet.String(utils.INCLUDE_RELATION_FILE, "", "A file containing a list of fully-qualified relation(s) that will be restored")
+	flagSet.String(utils.MAX_BANDWIDTH, "", "The maximum bandwidth, in bytes per second with an optional K, M, or G suffix, with which each segment reads and writes backup files")
+	flagSet.String(utils.MAX_HOST_BANDWIDTH, "", "The maximum bandwidth, in bytes per second with an optional K, M, or G suffix, with which each host reads and writes backup files, shared evenly among its segments")
 	flagSet.Bool(utils.METADATA_ONLY, false, "Only restore metadata, do not restore data")
 	flagSet.Int(utils.JOBS, 1, "Number of parallel connections to use when restoring table data and post-data")
 	flagSet.Bool(utils.ON_ERROR_CONTINUE, false, "Log errors and continue restore, instead of exiting on first error")
+	flagSet.String(utils.OUTPUT_SQL, "", "The absolute path of a file to which the metadata statements are written as a SQL script, instead of being executed")
 	flagSet.String(utils.PLUGIN_CONFIG, "", "The configuration file to use for a plugin")
+	flagSet.String(utils.PROGRESS_FILE, "", "The absolute path of a file, or /dev/fd/N for an open file descriptor, to which progress events are appended as JSON lines")
 	flagSet.Bool("version", false, "Print version number and exit")
 	flagSet.Bool(utils.QUIET, false, "Suppress non-warning, non-error log messages")
 	flagSet.String(utils.REDIRECT_DB, "", "Restore to the specified database instead of the database that was backed up")
+	flagSet.String(utils.REDIRECT_SCHEMA, "", "Restore every restored object to the specified schema instead of the schema that was backed up")
+	flagSet.String(utils.REDIRECT_SCHEMA_FILE, "", "A file of source=target schema pairs, one per line, mapping the schemas that are backed up to the schemas they are restored to")
+	flagSet.String(utils.REDIRECT_TABLE_FILE, "", "A file of source=target pairs of fully-qualified table names, one per line, mapping the tables that are backed up to the names they are restored to")
+	flagSet.Bool(utils.RESUME, false, "Resume an interrupted restore of the same backup, skipping the objects and table data already restored.  Tables created by the restore are truncated before their data is loaded again.")
 	flagSet.Bool(utils.WITH_GLOBALS, false, "Restore global metadata")
-	flagSet.String(utils.TIMESTAMP, "", "The timestamp to be restored, in the format YYYYMMDDHHMMSS")
+	flagSet.String(utils.TIMESTAMP, "", "The timestamp to be restored, in the format YYYYMMDDHHMMSS, or 'latest' for the latest successful backup of the --dbname database")
+	flagSet.Bool(utils.TRUNCATE_TABLE, false, "Truncate each table before loading its data, in the same transaction as the load.  Only valid when restoring data only.")
 	flagSet.Bool(utils.VERBOSE, false, "Print verbose log messages")
 	flagSet.Bool(utils.WITH_STATS, false, "Restore query plan statistics")
 }
@@ -71,8 +84,32 @@ func DoValidation(cmd *cobra.Command) {
 	gplog.FatalOnError(err)
 	err = utils.ValidateFullPath(MustGetFlagString(utils.PLUGIN_CONFIG))
 	gplog.FatalOnError(err)
-	if !backup_filepath.IsValidTimestamp(MustGetFlagString(utils.TIMESTAMP)) {
-		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", MustGetFlagString(utils.TIMESTAMP)), "")
+	err = utils.ValidateFullPath(MustGetFlagString(utils.ENCRYPTION_KEY_FILE))
+	gplog.FatalOnError(err)
+	err = utils.ValidateFullPath(MustGetFlagString(utils.PROGRESS_FILE))
+	gplog.FatalOnError(err)
+	err = utils.ValidateFullPath(MustGetFlagString(utils.OUTPUT_SQL))
+	gplog.FatalOnError(err)
+	_, err = utils.ParseBandwidth(MustGetFlagString(utils.MAX_BANDWIDTH))
+	gplog.FatalOnError(err)
+	_, err = utils.ParseBandwidth(MustGetFlagString(utils.MAX_HOST_BANDWIDTH))
+	gplog.FatalOnError(err)
+	err = utils.ValidateFullPath(MustGetFlagString(utils.HISTORY_FILE))
+	gplog.FatalOnError(err)
+	timestamp := MustGetFlagString(utils.TIMESTAMP)
+	asOf := MustGetFlagString(utils.AS_OF)
+	if timestamp == "" && asOf == "" {
+		gplog.Fatal(errors.Errorf("Either --%s or --%s must be specified.", utils.TIMESTAMP, utils.AS_OF), "")
+	}
+	if timestamp != "" && timestamp != LATEST_TIMESTAMP && !backup_filepath.IsValidTimestamp(timestamp) {
+		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS, or be '%s'.", timestamp, LATEST_TIMESTAMP), "")
+	}
+	if asOf != "" {
+		_, err = ParseAsOfTime(asOf)
+		gplog.FatalOnError(err)
+	}
+	if (timestamp == LATEST_TIMESTAMP || asOf != "") && MustGetFlagString(utils.DBNAME) == "" {
+		gplog.Fatal(errors.Errorf("--%s must be specified to choose a backup with --%s %s or --%s.", utils.DBNAME, utils.TIMESTAMP, LATEST_TIMESTAMP, utils.AS_OF), "")
 	}
 }
 
@@ -80,11 +117,15 @@ func DoValidation(cmd *cobra.Command) {
 func DoSetup() {
 	SetLoggerVerbosity()
 	restoreStartTime = utils.CurrentTimestamp()
-	gplog.Info("Restore Key = %s", MustGetFlagString(utils.TIMESTAMP))
-
 	InitializeConnectionPool("postgres")
 	segConfig := cluster.MustGetSegmentConfiguration(connectionPool)
 	globalCluster = cluster.NewCluster(segConfig)
+	// The backup is chosen from the history only once the cluster it must have been taken of is known
+	ResolveRestoreTimestamp(backup_history.GetClusterID(globalCluster.GetHostForContent(-1), connectionPool.Port))
+	gplog.Info("Restore Key = %s", MustGetFlagString(utils.TIMESTAMP))
+	err := utils.InitializeProgressFile(MustGetFlagString(utils.PROGRESS_FILE), "gprestore", MustGetFlagString(utils.TIMESTAMP))
+	gplog.FatalOnError(err)
+
 	segPrefix := backup_filepath.ParseSegPrefix(MustGetFlagString(utils.BACKUP_DIR), MustGetFlagString(utils.TIMESTAMP))
 	globalFPInfo = backup_filepath.NewFilePathInfo(globalCluster, MustGetFlagString(utils.BACKUP_DIR), MustGetFlagString(utils.TIMESTAMP), segPrefix)
 
@@ -104,39 +145,65 @@ func DoSetup() {
 	if MustGetFlagString(utils.REDIRECT_DB) != "" {
 		unquotedRestoreDatabase = MustGetFlagString(utils.REDIRECT_DB)
 	}
-	ValidateDatabaseExistence(unquotedRestoreDatabase, MustGetFlagBool(utils.CREATE_DB), backupConfig.IncludeTableFiltered || backupConfig.DataOnly)
-	if MustGetFlagBool(utils.WITH_GLOBALS) {
+	if isRestoreWithoutChanges() {
+		setupDryRun(unquotedRestoreDatabase)
+		return
+	}
+	InitializeRestoreState(unquotedRestoreDatabase)
+	// A database created by the interrupted restore already exists, so it is validated as if --create-db was not passed
+	databaseCreated := restoreState != nil && restoreState.IsSectionFinished("database")
+	ValidateDatabaseExistence(unquotedRestoreDatabase, MustGetFlagBool(utils.CREATE_DB) && !databaseCreated, backupConfig.IncludeTableFiltered || backupConfig.DataOnly)
+	if MustGetFlagBool(utils.WITH_GLOBALS) && !isRestoreSectionFinished("global") {
 		restoreGlobal(metadataFilename)
-	} else if MustGetFlagBool(utils.CREATE_DB) {
+		finishRestoreSection("global")
+		if MustGetFlagBool(utils.CREATE_DB) {
+			finishRestoreSection("database")
+		}
+	} else if MustGetFlagBool(utils.CREATE_DB) && !isRestoreSectionFinished("database") {
 		createDatabase(metadataFilename)
+		finishRestoreSection("database")
 	}
 	if connectionPool != nil {
 		connectionPool.Close()
 	}
 	InitializeConnectionPool(unquotedRestoreDatabase)
+	InitializeRedirectSchemas()
+	InitializeRedirectTables()
 
 	/*
 	 * We don't need to validate anything if we're creating the database; we
 	 * should not error out for validation reasons once the restore database exists.
 	 * For on-error-continue, we will see the same errors later when we try to run SQL,
 	 * but since they will not stop the restore, it is not necessary to log them twice.
+	 * A resumed restore expects to find the relations it already restored.
 	 */
-	if !MustGetFlagBool(utils.CREATE_DB) && !MustGetFlagBool(utils.ON_ERROR_CONTINUE) {
+	if !MustGetFlagBool(utils.CREATE_DB) && !MustGetFlagBool(utils.ON_ERROR_CONTINUE) && !MustGetFlagBool(utils.RESUME) {
 		relationsToRestore := GenerateRestoreRelationList()
+		for i, relation := range relationsToRestore {
+			relationsToRestore[i] = GetRestoredTableFQN(relation)
+		}
 		ValidateRelationsInRestoreDatabase(connectionPool, relationsToRestore)
 	}
 }
 
 func DoRestore() {
+	if MustGetFlagBool(utils.DRY_RUN) {
+		DoDryRun(os.Stdout)
+		return
+	} else if MustGetFlagString(utils.OUTPUT_SQL) != "" {
+		DoOutputSQL(MustGetFlagString(utils.OUTPUT_SQL))
+		return
+	}
 	gucStatements := setGUCsForConnection(nil, 0)
 	metadataFilename := globalFPInfo.GetMetadataFilePath()
 	isDataOnly := backupConfig.DataOnly || MustGetFlagBool(utils.DATA_ONLY)
 	isMetadataOnly := backupConfig.MetadataOnly || MustGetFlagBool(utils.METADATA_ONLY)
-	if !isDataOnly {
+	if !isDataOnly && !isRestoreSectionFinished("predata") {
 		restorePredata(metadataFilename)
+		finishRestoreSection("predata")
 	}
 
-	if !isMetadataOnly {
+	if !isMetadataOnly && !isRestoreSectionFinished("data") {
 		if MustGetFlagString(utils.PLUGIN_CONFIG) == "" {
 			backupFileCount := 2 // 1 for the actual data file, 1 for the segment TOC file
 			if !backupConfig.SingleDataFile {
@@ -145,44 +212,74 @@ func DoRestore() {
 			VerifyBackupFileCountOnSegments(backupFileCount)
 		}
 		restoreData(GetBackupFPInfoListFromRestorePlan(), gucStatements)
+		finishRestoreSection("data")
 	}
 
-	if !isDataOnly {
+	if !isDataOnly && !isRestoreSectionFinished("postdata") {
 		restorePostdata(metadataFilename)
+		finishRestoreSection("postdata")
 	}
 
-	if MustGetFlagBool(utils.WITH_STATS) && backupConfig.WithStatistics {
+	if MustGetFlagBool(utils.WITH_STATS) && backupConfig.WithStatistics && !isRestoreSectionFinished("statistics") {
 		restoreStatistics()
+		finishRestoreSection("statistics")
+	}
+
+	if restoreState != nil && !wasTerminated && gplog.GetErrorCode() == 0 {
+		restoreState.Remove()
 	}
 }
 
-func createDatabase(metadataFilename string) {
+/*
+ * A dry run and --output-sql both read the backup without executing any of
+ * its statements, so neither changes a database.
+ */
+func isRestoreWithoutChanges() bool {
+	return MustGetFlagBool(utils.DRY_RUN) || MustGetFlagString(utils.OUTPUT_SQL) != ""
+}
+
+// Returns the quoted name of the database being restored to
+func getRestoreDatabaseName() string {
+	if MustGetFlagString(utils.REDIRECT_DB) != "" {
+		return utils.QuoteIdent(connectionPool, MustGetFlagString(utils.REDIRECT_DB))
+	}
+	return backupConfig.DatabaseName
+}
+
+func getCreateDatabaseStatements(metadataFilename string) []utils.StatementWithType {
 	objectTypes := []string{"SESSION GUCS", "DATABASE GUC", "DATABASE", "DATABASE METADATA"}
-	dbName := backupConfig.DatabaseName
-	gplog.Info("Creating database")
 	statements := GetRestoreMetadataStatements("global", metadataFilename, objectTypes, []string{}, false, false)
 	if MustGetFlagString(utils.REDIRECT_DB) != "" {
-		quotedDBName := utils.QuoteIdent(connectionPool, MustGetFlagString(utils.REDIRECT_DB))
-		dbName = quotedDBName
-		statements = utils.SubstituteRedirectDatabaseInStatements(statements, backupConfig.DatabaseName, quotedDBName)
+		statements = utils.SubstituteRedirectDatabaseInStatements(statements, backupConfig.DatabaseName, getRestoreDatabaseName())
 	}
+	return statements
+}
+
+func createDatabase(metadataFilename string) {
+	gplog.Info("Creating database")
+	statements := getCreateDatabaseStatements(metadataFilename)
 	ExecuteRestoreMetadataStatements(statements, "", nil, utils.PB_NONE, false)
-	gplog.Info("Database creation complete for: %s", dbName)
+	gplog.Info("Database creation complete for: %s", getRestoreDatabaseName())
 }
 
-func restoreGlobal(metadataFilename string) {
+func getGlobalStatements(metadataFilename string) []utils.StatementWithType {
 	objectTypes := []string{"SESSION GUCS", "DATABASE GUC", "DATABASE METADATA", "RESOURCE QUEUE", "RESOURCE GROUP", "ROLE", "ROLE GUCS", "ROLE GRANT", "TABLESPACE"}
 	if MustGetFlagBool(utils.CREATE_DB) {
 		objectTypes = append(objectTypes, "DATABASE")
 	}
-	gplog.Info("Restoring global metadata")
 	statements := GetRestoreMetadataStatements("global", metadataFilename, objectTypes, []string{}, false, false)
 	if MustGetFlagString(utils.REDIRECT_DB) != "" {
-		quotedDBName := utils.QuoteIdent(connectionPool, MustGetFlagString(utils.REDIRECT_DB))
-		statements = utils.SubstituteRedirectDatabaseInStatements(statements, backupConfig.DatabaseName, quotedDBName)
+		statements = utils.SubstituteRedirectDatabaseInStatements(statements, backupConfig.DatabaseName, getRestoreDatabaseName())
 	}
-	statements = utils.RemoveActiveRole(connectionPool.User, statements)
+	return utils.RemoveActiveRole(connectionPool.User, statements)
+}
+
+func restoreGlobal(metadataFilename string) {
+	utils.EmitPhaseStart("global")
+	gplog.Info("Restoring global metadata")
+	statements := getGlobalStatements(metadataFilename)
 	ExecuteRestoreMetadataStatements(statements, "Global objects", nil, utils.PB_VERBOSE, false)
+	utils.EmitPhaseEnd("global")
 	gplog.Info("Global database metadata restore complete")
 }
 
@@ -190,17 +287,27 @@ func restorePredata(metadataFilename string) {
 	if wasTerminated {
 		return
 	}
+	utils.EmitPhaseStart("predata")
 	gplog.Info("Restoring pre-data metadata")
 
 	schemaStatements := GetRestoreMetadataStatements("predata", metadataFilename, []string{"SCHEMA"}, []string{}, true, false)
 	statements := GetRestoreMetadataStatements("predata", metadataFilename, []string{}, []string{"SCHEMA"}, true, true)
+	if restoreState != nil {
+		schemaStatements = restoreState.RemoveFinishedStatements("predata", schemaStatements)
+		statements = restoreState.RemoveFinishedStatements("predata", statements)
+		restoreState.TrackStatements("predata")
+	}
 
 	progressBar := utils.NewProgressBar(len(schemaStatements)+len(statements), "Pre-data objects restored: ", utils.PB_VERBOSE)
 	progressBar.Start()
 
 	RestoreSchemas(schemaStatements, progressBar)
 	ExecuteRestoreMetadataStatements(statements, "Pre-data objects", progressBar, utils.PB_VERBOSE, false)
+	if restoreState != nil {
+		restoreState.StopTrackingStatements()
+	}
 
+	utils.EmitPhaseEnd("predata")
 	progressBar.Finish()
 	if wasTerminated {
 		gplog.Info("Pre-data metadata restore incomplete")
@@ -217,25 +324,29 @@ func restoreData(fpInfoList []backup_filepath.FilePathInfo, gucStatements []util
 
 	totalTables := 0
 	filteredDataEntries := make([][]utils.MasterDataEntry, 0)
+	segmentTOCChecksums := make([]map[int]string, 0)
 	for i, fpInfo := range fpInfoList {
 		tocFilename := fpInfo.GetTOCFilePath()
 		toc := utils.NewTOC(tocFilename)
-		restorePlanTableFQNs := latestRestorePlan[i].TableFQNs
-		filteredDataEntriesForTimestamp := toc.GetDataEntriesMatching(MustGetFlagStringSlice(utils.INCLUDE_SCHEMA),
-			MustGetFlagStringSlice(utils.EXCLUDE_SCHEMA), MustGetFlagStringSlice(utils.INCLUDE_RELATION),
-			MustGetFlagStringSlice(utils.EXCLUDE_RELATION), restorePlanTableFQNs)
+		filteredDataEntriesForTimestamp := getFilteredDataEntries(toc, latestRestorePlan[i].TableFQNs)
 		filteredDataEntries = append(filteredDataEntries, filteredDataEntriesForTimestamp)
+		segmentTOCChecksums = append(segmentTOCChecksums, toc.SegmentTOCChecksums)
+		if backupConfig.Incremental {
+			recordRestoreDataSources(fpInfo.Timestamp, toc, filteredDataEntriesForTimestamp)
+		}
 
 		totalTables += len(filteredDataEntriesForTimestamp)
 	}
+	utils.EmitPhaseStart("data")
 	dataProgressBar := utils.NewProgressBar(totalTables, "Tables restored: ", utils.PB_INFO)
 	dataProgressBar.Start()
 
 	for i, fpInfo := range fpInfoList {
 		gplog.Verbose("Restoring data from backup with timestamp: %s", fpInfo.Timestamp)
-		restoreDataFromTimestamp(fpInfo, filteredDataEntries[i], gucStatements, dataProgressBar)
+		restoreDataFromTimestamp(fpInfo, filteredDataEntries[i], segmentTOCChecksums[i], gucStatements, dataProgressBar)
 	}
 
+	utils.EmitPhaseEnd("data")
 	dataProgressBar.Finish()
 	if wasTerminated {
 		gplog.Info("Data restore incomplete")
@@ -244,17 +355,46 @@ func restoreData(fpInfoList []backup_filepath.FilePathInfo, gucStatements []util
 	}
 }
 
+func getFilteredDataEntries(toc *utils.TOC, restorePlanTableFQNs []string) []utils.MasterDataEntry {
+	return toc.GetDataEntriesMatching(MustGetFlagStringSlice(utils.INCLUDE_SCHEMA),
+		MustGetFlagStringSlice(utils.EXCLUDE_SCHEMA), MustGetFlagStringSlice(utils.INCLUDE_RELATION),
+		MustGetFlagStringSlice(utils.EXCLUDE_RELATION), restorePlanTableFQNs)
+}
+
+func recordRestoreDataSources(timestamp string, toc *utils.TOC, dataEntries []utils.MasterDataEntry) {
+	if restoreDataSources == nil {
+		restoreDataSources = &utils.RestoreDataSources{Changes: make(map[string][]utils.TableChange)}
+	}
+	for _, entry := range dataEntries {
+		restoreDataSources.Tables = append(restoreDataSources.Tables,
+			utils.TableDataSource{Table: utils.MakeFQN(entry.Schema, entry.Name), Timestamp: timestamp})
+	}
+	restoreDataSources.Changes[timestamp] = toc.IncrementalMetadata.Changes
+}
+
 func restorePostdata(metadataFilename string) {
 	if wasTerminated {
 		return
 	}
+	utils.EmitPhaseStart("postdata")
 	gplog.Info("Restoring post-data metadata")
 	statements := GetRestoreMetadataStatements("postdata", metadataFilename, []string{}, []string{}, true, true)
 	firstBatch, secondBatch := BatchPostdataStatements(statements)
 	progressBar := utils.NewProgressBar(len(statements), "Post-data objects restored: ", utils.PB_VERBOSE)
 	progressBar.Start()
-	ExecuteRestoreMetadataStatements(firstBatch, "", progressBar, utils.PB_VERBOSE, connectionPool.NumConns > 1)
-	ExecuteRestoreMetadataStatements(secondBatch, "", progressBar, utils.PB_VERBOSE, connectionPool.NumConns > 1)
+	for i, batch := range [][]utils.StatementWithType{firstBatch, secondBatch} {
+		batchName := fmt.Sprintf("postdata batch %d", i+1)
+		if restoreState != nil && restoreState.IsSectionFinished(batchName) {
+			gplog.Verbose("Skipping %s because it was already restored", batchName)
+			for range batch {
+				progressBar.Increment()
+			}
+			continue
+		}
+		ExecuteRestoreMetadataStatements(batch, "", progressBar, utils.PB_VERBOSE, connectionPool.NumConns > 1)
+		finishRestoreSection(batchName)
+	}
+	utils.EmitPhaseEnd("postdata")
 	progressBar.Finish()
 	if wasTerminated {
 		gplog.Info("Post-data metadata restore incomplete")
@@ -268,9 +408,11 @@ func restoreStatistics() {
 		return
 	}
 	statisticsFilename := globalFPInfo.GetStatisticsFilePath()
+	utils.EmitPhaseStart("statistics")
 	gplog.Info("Restoring query planner statistics from %s", statisticsFilename)
 	statements := GetRestoreMetadataStatements("statistics", statisticsFilename, []string{}, []string{}, true, false)
 	ExecuteRestoreMetadataStatements(statements, "Table statistics", nil, utils.PB_VERBOSE, false)
+	utils.EmitPhaseEnd("statistics")
 	gplog.Info("Query planner statistics restore complete")
 }
 
@@ -279,9 +421,15 @@ func DoTeardown() {
 		DoCleanup()
 
 		errorCode := gplog.GetErrorCode()
-		if errorCode == 0 {
+		if errorCode == 0 && MustGetFlagBool(utils.DRY_RUN) {
+			gplog.Info("Dry run completed successfully")
+		} else if errorCode == 0 && MustGetFlagString(utils.OUTPUT_SQL) != "" {
+			gplog.Info("Restore script %s written successfully", MustGetFlagString(utils.OUTPUT_SQL))
+		} else if errorCode == 0 {
 			gplog.Info("Restore completed successfully")
 		}
+		utils.EmitEnd(errorCode)
+		utils.CloseProgressFile()
 		os.Exit(errorCode)
 
 	}()
@@ -310,6 +458,9 @@ func DoTeardown() {
 		fmt.Println(errStr)
 	}
 	errMsg := utils.ParseErrorMessage(errStr)
+	if errMsg != "" {
+		utils.EmitError("", errMsg)
+	}
 
 	if globalFPInfo.Timestamp != "" {
 		_, statErr := os.Stat(globalFPInfo.GetDirForContent(-1))
@@ -317,9 +468,12 @@ func DoTeardown() {
 			return
 		}
 
-		reportFilename := globalFPInfo.GetRestoreReportFilePath(restoreStartTime)
-		utils.WriteRestoreReportFile(reportFilename, globalFPInfo.Timestamp, restoreStartTime, connectionPool, version, errMsg)
-		utils.EmailReport(globalCluster, globalFPInfo.Timestamp, reportFilename, "gprestore")
+		// Nothing is restored if no database is changed, so there is nothing to report
+		if !isRestoreWithoutChanges() {
+			reportFilename := globalFPInfo.GetRestoreReportFilePath(restoreStartTime)
+			utils.WriteRestoreReportFile(reportFilename, globalFPInfo.Timestamp, restoreStartTime, connectionPool, version, errMsg, restoreDataSources)
+			utils.EmailReport(globalCluster, globalFPInfo.Timestamp, reportFilename, "gprestore")
+		}
 		if pluginConfig != nil {
 			pluginConfig.CleanupPluginForRestore(globalCluster, globalFPInfo)
 		}
@@ -346,7 +500,14 @@ func DoCleanup() {
 			}
 		}
 	}
+	if backupConfig != nil && !backupConfig.SingleDataFile && MustGetFlagString(utils.PLUGIN_CONFIG) != "" {
+		// Removes the data file checksum manifests read by gpbackup_helper
+		utils.CleanUpHelperFilesOnAllHosts(globalCluster, globalFPInfo)
+	}
 
+	if restoreState != nil {
+		restoreState.Close()
+	}
 	if connectionPool != nil {
 		connectionPool.Close()
 	}
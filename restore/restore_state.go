@@ -0,0 +1,279 @@
+package restore
+
+/*
+ * This file contains structs and functions for the restore state that allows an
+ * interrupted restore to be resumed with --resume.
+ */
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+type RestoreStateConfig struct {
+	Timestamp string
+	Database  string
+}
+
+/*
+ * The restore state file holds the configuration of the restore on its first
+ * line, followed by one line for each finished section, predata statement, and
+ * table data load.  As with the backup checkpoint, lines are appended as work
+ * finishes and a partially written last line is ignored when the file is read.
+ */
+type RestoreState struct {
+	Filename         string
+	Config           RestoreStateConfig
+	Finished         map[string]bool
+	statementSection string
+	file             io.WriteCloser
+	mutex            sync.Mutex
+}
+
+func NewRestoreState(filename string, config RestoreStateConfig) (*RestoreState, error) {
+	state := &RestoreState{Filename: filename, Config: config, Finished: make(map[string]bool, 0)}
+	err := state.rewrite()
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func ReadRestoreState(filename string) (*RestoreState, error) {
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimRight(string(contents), "\n"), "\n")
+	state := &RestoreState{Filename: filename, Finished: make(map[string]bool, 0)}
+	err = json.Unmarshal([]byte(lines[0]), &state.Config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read restore configuration from restore state file %s", filename)
+	}
+	for i, line := range lines[1:] {
+		var key string
+		err = json.Unmarshal([]byte(line), &key)
+		if err != nil {
+			if i == len(lines)-2 {
+				gplog.Verbose("Ignoring partially written last line of restore state file %s", filename)
+				break
+			}
+			return nil, errors.Wrapf(err, "Unable to read line %d of restore state file %s", i+2, filename)
+		}
+		state.Finished[key] = true
+	}
+	return state, nil
+}
+
+/*
+ * Writes the configuration and everything finished so far to a fresh file,
+ * which drops any partially written line, and leaves it open for appending.
+ */
+func (state *RestoreState) rewrite() error {
+	file, err := operating.System.OpenFileWrite(state.Filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	lines := []interface{}{state.Config}
+	for key := range state.Finished {
+		lines = append(lines, key)
+	}
+	for _, line := range lines {
+		err = writeRestoreStateLine(writer, line)
+		if err != nil {
+			return err
+		}
+	}
+	err = writer.Flush()
+	if err != nil {
+		return err
+	}
+	state.file = file
+	return nil
+}
+
+func writeRestoreStateLine(writer io.Writer, value interface{}) error {
+	line, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(append(line, '\n'))
+	return err
+}
+
+// This function is called by concurrent COPY and statement workers
+func (state *RestoreState) record(key string) error {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.Finished[key] = true
+	return writeRestoreStateLine(state.file, key)
+}
+
+func (state *RestoreState) isFinished(key string) bool {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	return state.Finished[key]
+}
+
+func sectionKey(section string) string {
+	return fmt.Sprintf("section:%s", section)
+}
+
+func tableKey(timestamp string, oid uint32) string {
+	return fmt.Sprintf("data:%s:%d", timestamp, oid)
+}
+
+/*
+ * Statements are identified by the object they belong to and their text
+ * rather than by position, so they are still recognized if the restore is
+ * resumed with different filters, and the same statement text restored for
+ * two objects (such as an identical COMMENT or GRANT) is recorded for each.
+ * The fields are hashed together, as names may contain any character.
+ */
+func statementKey(section string, statement utils.StatementWithType) string {
+	identity := strings.Join([]string{statement.Schema, statement.Name, statement.ObjectType, statement.ReferenceObject, statement.Statement}, "\x00")
+	return fmt.Sprintf("%s:%x", section, sha256.Sum256([]byte(identity)))
+}
+
+func (state *RestoreState) FinishSection(section string) error {
+	return state.record(sectionKey(section))
+}
+
+func (state *RestoreState) IsSectionFinished(section string) bool {
+	return state.isFinished(sectionKey(section))
+}
+
+func (state *RestoreState) RecordTable(timestamp string, oid uint32) error {
+	return state.record(tableKey(timestamp, oid))
+}
+
+func (state *RestoreState) IsTableFinished(timestamp string, oid uint32) bool {
+	return state.isFinished(tableKey(timestamp, oid))
+}
+
+/*
+ * While a section is being tracked, each statement executed successfully is
+ * recorded so that it is skipped if the restore is resumed.
+ */
+func (state *RestoreState) TrackStatements(section string) {
+	state.statementSection = section
+}
+
+func (state *RestoreState) StopTrackingStatements() {
+	state.statementSection = ""
+}
+
+func (state *RestoreState) RecordStatement(statement utils.StatementWithType) error {
+	if state.statementSection == "" {
+		return nil
+	}
+	return state.record(statementKey(state.statementSection, statement))
+}
+
+func (state *RestoreState) RemoveFinishedStatements(section string, statements []utils.StatementWithType) []utils.StatementWithType {
+	remainingStatements := make([]utils.StatementWithType, 0, len(statements))
+	for _, statement := range statements {
+		if !state.isFinished(statementKey(section, statement)) {
+			remainingStatements = append(remainingStatements, statement)
+		}
+	}
+	if numSkipped := len(statements) - len(remainingStatements); numSkipped > 0 {
+		gplog.Verbose("Skipping %d %s statement(s) that were already restored", numSkipped, section)
+	}
+	return remainingStatements
+}
+
+func (state *RestoreState) Close() {
+	if state.file != nil {
+		_ = state.file.Close()
+		state.file = nil
+	}
+}
+
+// The restore state is only removed once the restore has completed without errors
+func (state *RestoreState) Remove() {
+	state.Close()
+	err := os.Remove(state.Filename)
+	if err != nil {
+		gplog.Warn("Unable to remove restore state file %s: %v", state.Filename, err)
+	}
+}
+
+/*
+ * Restore flow functions for recording and resuming restore state
+ */
+
+func InitializeRestoreState(unquotedRestoreDatabase string) {
+	stateFilename := globalFPInfo.GetRestoreStateFilePath()
+	config := RestoreStateConfig{Timestamp: globalFPInfo.Timestamp, Database: unquotedRestoreDatabase}
+	var err error
+	if !MustGetFlagBool(utils.RESUME) {
+		// A backup directory that cannot be written to only keeps the restore from being resumed
+		restoreState, err = NewRestoreState(stateFilename, config)
+		if err != nil {
+			gplog.Warn("Unable to create restore state file %s: %v.  This restore cannot be resumed with --resume if it is interrupted.", stateFilename, err)
+		}
+		return
+	}
+	if _, err = operating.System.Stat(stateFilename); err != nil {
+		gplog.Fatal(errors.Errorf("No restore state found for backup with timestamp %s.  The restore either completed or was not started.", globalFPInfo.Timestamp), "")
+	}
+	restoreState, err = ReadRestoreState(stateFilename)
+	gplog.FatalOnError(err)
+	if restoreState.Config.Database != unquotedRestoreDatabase {
+		gplog.Fatal(errors.Errorf("The interrupted restore of backup with timestamp %s was to database %s, not %s.  Run gprestore with the same flags as the interrupted restore to resume it.",
+			globalFPInfo.Timestamp, restoreState.Config.Database, unquotedRestoreDatabase), "")
+	}
+	err = restoreState.rewrite()
+	if err != nil {
+		gplog.Fatal(err, "Unable to open restore state file")
+	}
+	gplog.Info("Resuming restore of backup with timestamp %s into database %s", globalFPInfo.Timestamp, unquotedRestoreDatabase)
+}
+
+/*
+ * Returns the data entries that still need to be restored, incrementing the
+ * progress bar for those that were already restored by the interrupted run.
+ */
+func GetDataEntriesToResume(timestamp string, dataEntries []utils.MasterDataEntry, dataProgressBar utils.ProgressBar) []utils.MasterDataEntry {
+	remainingEntries := make([]utils.MasterDataEntry, 0, len(dataEntries))
+	for _, entry := range dataEntries {
+		if restoreState.IsTableFinished(timestamp, entry.Oid) {
+			gplog.Verbose("Skipping data restore of table %s because it was already restored", utils.MakeFQN(entry.Schema, entry.Name))
+			dataProgressBar.Increment()
+		} else {
+			remainingEntries = append(remainingEntries, entry)
+		}
+	}
+	return remainingEntries
+}
+
+func finishRestoreSection(section string) {
+	if wasTerminated || restoreState == nil {
+		return
+	}
+	err := restoreState.FinishSection(section)
+	if err != nil {
+		gplog.Fatal(err, "Unable to write to restore state file")
+	}
+}
+
+func isRestoreSectionFinished(section string) bool {
+	if restoreState != nil && restoreState.IsSectionFinished(section) {
+		gplog.Info("Skipping %s restore because it was already completed", section)
+		return true
+	}
+	return false
+}
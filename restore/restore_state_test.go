@@ -0,0 +1,102 @@
+package restore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/restore_state tests", func() {
+	var (
+		stateDir      string
+		stateFilename string
+		config        restore.RestoreStateConfig
+	)
+	fooEntry := utils.MasterDataEntry{Schema: "public", Name: "foo", Oid: 1}
+	barEntry := utils.MasterDataEntry{Schema: "public", Name: "bar", Oid: 2}
+	tableStatement := utils.StatementWithType{ObjectType: "TABLE", Statement: "CREATE TABLE public.foo (i int);"}
+	viewStatement := utils.StatementWithType{ObjectType: "VIEW", Statement: "CREATE VIEW public.fooview AS SELECT 1;"}
+	BeforeEach(func() {
+		stateDir, _ = ioutil.TempDir("", "restore_state")
+		stateFilename = filepath.Join(stateDir, "gprestore_20170101010101_state")
+		config = restore.RestoreStateConfig{Timestamp: "20170101010101", Database: "testdb"}
+	})
+	AfterEach(func() {
+		_ = os.RemoveAll(stateDir)
+		restore.SetRestoreState(nil)
+	})
+	Describe("NewRestoreState and ReadRestoreState", func() {
+		It("reads back the configuration and everything finished", func() {
+			state, err := restore.NewRestoreState(stateFilename, config)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.FinishSection("predata")).To(Succeed())
+			Expect(state.RecordTable("20170101010101", 1)).To(Succeed())
+			state.TrackStatements("predata")
+			Expect(state.RecordStatement(tableStatement)).To(Succeed())
+			state.Close()
+
+			resultState, err := restore.ReadRestoreState(stateFilename)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resultState.Config).To(Equal(config))
+			Expect(resultState.IsSectionFinished("predata")).To(BeTrue())
+			Expect(resultState.IsSectionFinished("postdata")).To(BeFalse())
+			Expect(resultState.IsTableFinished("20170101010101", 1)).To(BeTrue())
+			Expect(resultState.IsTableFinished("20170101010101", 2)).To(BeFalse())
+			Expect(resultState.RemoveFinishedStatements("predata", []utils.StatementWithType{tableStatement, viewStatement})).To(Equal([]utils.StatementWithType{viewStatement}))
+		})
+		It("ignores a partially written last line", func() {
+			state, _ := restore.NewRestoreState(stateFilename, config)
+			_ = state.RecordTable("20170101010101", 1)
+			state.Close()
+			file, _ := os.OpenFile(stateFilename, os.O_APPEND|os.O_WRONLY, 0644)
+			_, _ = file.WriteString(`"data:2017`)
+			_ = file.Close()
+
+			resultState, err := restore.ReadRestoreState(stateFilename)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resultState.Finished).To(HaveLen(1))
+		})
+		It("returns an error if the configuration cannot be read", func() {
+			_ = ioutil.WriteFile(stateFilename, []byte("not a restore state\n"), 0644)
+			_, err := restore.ReadRestoreState(stateFilename)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Describe("RecordStatement", func() {
+		It("does not record statements when no section is being tracked", func() {
+			state, _ := restore.NewRestoreState(stateFilename, config)
+			Expect(state.RecordStatement(tableStatement)).To(Succeed())
+			state.TrackStatements("predata")
+			state.StopTrackingStatements()
+			Expect(state.RecordStatement(viewStatement)).To(Succeed())
+			Expect(state.Finished).To(BeEmpty())
+		})
+		It("records the same statement separately for each object", func() {
+			state, _ := restore.NewRestoreState(stateFilename, config)
+			fooComment := utils.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "COMMENT ON TABLE public.foo IS 'x';"}
+			barComment := utils.StatementWithType{Schema: "public", Name: "bar", ObjectType: "TABLE", Statement: "COMMENT ON TABLE public.foo IS 'x';"}
+			state.TrackStatements("predata")
+			Expect(state.RecordStatement(fooComment)).To(Succeed())
+
+			Expect(state.RemoveFinishedStatements("predata", []utils.StatementWithType{fooComment, barComment})).To(Equal([]utils.StatementWithType{barComment}))
+		})
+	})
+	Describe("GetDataEntriesToResume", func() {
+		It("skips tables already restored from the same timestamp", func() {
+			state, _ := restore.NewRestoreState(stateFilename, config)
+			_ = state.RecordTable("20170101010101", 1)
+			_ = state.RecordTable("20170202020202", 2)
+			restore.SetRestoreState(state)
+			progressBar := utils.NewProgressBar(2, "", utils.PB_NONE)
+
+			remainingEntries := restore.GetDataEntriesToResume("20170101010101", []utils.MasterDataEntry{fooEntry, barEntry}, progressBar)
+			Expect(remainingEntries).To(Equal([]utils.MasterDataEntry{barEntry}))
+		})
+	})
+})
@@ -0,0 +1,125 @@
+package restore
+
+/*
+ * This file contains functions for choosing the backup to restore from the
+ * backup history file, for --timestamp latest and --as-of.
+ */
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/backup_history"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+const LATEST_TIMESTAMP = "latest"
+
+// Backup timestamps are in local time, so --as-of times are too
+var asOfTimeFormats = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02", "20060102150405", "20060102"}
+
+/*
+ * Returns the backup timestamp, YYYYMMDDHHMMSS, of the latest time that an
+ * --as-of time includes, so that a backup taken at any second within the
+ * given minute or day matches it.
+ */
+func ParseAsOfTime(asOf string) (string, error) {
+	for _, format := range asOfTimeFormats {
+		asOfTime, err := time.ParseInLocation(format, asOf, time.Local)
+		if err != nil {
+			continue
+		}
+		switch format {
+		case "2006-01-02 15:04":
+			asOfTime = asOfTime.Add(time.Minute - time.Second)
+		case "2006-01-02", "20060102":
+			asOfTime = asOfTime.AddDate(0, 0, 1).Add(-time.Second)
+		}
+		return asOfTime.Format("20060102150405"), nil
+	}
+	return "", errors.Errorf(`Time %s is invalid.  Times must be in the format "YYYY-MM-DD HH:MM:SS", "YYYY-MM-DD HH:MM", YYYY-MM-DD, YYYYMMDDHHMMSS, or YYYYMMDD.`, asOf)
+}
+
+/*
+ * Backups are recorded in the history file newest first, so the first match
+ * is the newest backup of the database that can be restored, taken at or
+ * before asOfTimestamp, or at any time if asOfTimestamp is empty.  Only
+ * backups of the cluster being restored to, in backupDir, or stored with the
+ * plugin executable, are chosen, as a history file may be shared by several
+ * clusters and the restore reads the backup from there.
+ */
+func GetLatestBackupTimestamp(history *backup_history.History, dbName string, clusterID string, backupDir string, plugin string, asOfTimestamp string) (string, error) {
+	for _, backupConfig := range history.GetRestorableBackups() {
+		if backupConfig.DatabaseName != dbName && utils.UnquoteIdent(backupConfig.DatabaseName) != dbName {
+			continue
+		}
+		if !backupConfig.MatchesCluster(clusterID) {
+			continue
+		}
+		if backupConfig.BackupDir != backupDir || backupConfig.Plugin != plugin {
+			continue
+		}
+		if asOfTimestamp != "" && backupConfig.Timestamp > asOfTimestamp {
+			continue
+		}
+		return backupConfig.Timestamp, nil
+	}
+	backupDescription := fmt.Sprintf("database %s on cluster %s", dbName, clusterID)
+	if backupDir != "" {
+		backupDescription += fmt.Sprintf(" in backup directory %s", backupDir)
+	}
+	if plugin != "" {
+		backupDescription += fmt.Sprintf(" stored with plugin %s", plugin)
+	}
+	if asOfTimestamp != "" {
+		return "", errors.Errorf("No restorable backup of %s was taken at or before %s", backupDescription, asOfTimestamp)
+	}
+	return "", errors.Errorf("No restorable backup of %s was found", backupDescription)
+}
+
+func GetHistoryFilePath() string {
+	historyFilePath, err := backup_history.GetHistoryFilePath(MustGetFlagString(utils.HISTORY_FILE), "")
+	gplog.FatalOnError(err)
+	return historyFilePath
+}
+
+/*
+ * Replaces --timestamp latest, or the --as-of time, with the timestamp of the
+ * backup it chooses, so that the rest of the restore uses that timestamp.
+ */
+func ResolveRestoreTimestamp(clusterID string) {
+	timestamp := MustGetFlagString(utils.TIMESTAMP)
+	asOf := MustGetFlagString(utils.AS_OF)
+	if timestamp != LATEST_TIMESTAMP && asOf == "" {
+		return
+	}
+	asOfTimestamp := ""
+	if asOf != "" {
+		var err error
+		asOfTimestamp, err = ParseAsOfTime(asOf)
+		gplog.FatalOnError(err)
+	}
+	historyFilename := GetHistoryFilePath()
+	if !iohelper.FileExistsAndIsReadable(historyFilename) {
+		gplog.Fatal(errors.Errorf("Cannot access history file %s", historyFilename), "")
+	}
+	history, err := backup_history.NewHistory(historyFilename)
+	gplog.FatalOnError(err)
+	plugin := ""
+	if pluginConfigFile := MustGetFlagString(utils.PLUGIN_CONFIG); pluginConfigFile != "" {
+		pluginConfig, err := utils.ReadPluginConfig(pluginConfigFile)
+		gplog.FatalOnError(err)
+		plugin = pluginConfig.ExecutablePath
+	}
+	dbName := MustGetFlagString(utils.DBNAME)
+	timestamp, err = GetLatestBackupTimestamp(history, dbName, clusterID, MustGetFlagString(utils.BACKUP_DIR), plugin, asOfTimestamp)
+	if err != nil {
+		gplog.Fatal(errors.Wrapf(err, "Cannot choose a backup to restore from history file %s", historyFilename), "")
+	}
+	gplog.Info("Chose backup %s of database %s from history file %s", timestamp, dbName, historyFilename)
+	err = cmdFlags.Set(utils.TIMESTAMP, timestamp)
+	gplog.FatalOnError(err)
+}
@@ -0,0 +1,70 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gpbackup/backup_history"
+	"github.com/greenplum-db/gpbackup/restore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/timestamp tests", func() {
+	Describe("ParseAsOfTime", func() {
+		It("includes every second of the given minute or day", func() {
+			Expect(restore.ParseAsOfTime("2017-01-02 03:04:05")).To(Equal("20170102030405"))
+			Expect(restore.ParseAsOfTime("2017-01-02 03:04")).To(Equal("20170102030459"))
+			Expect(restore.ParseAsOfTime("2017-01-02")).To(Equal("20170102235959"))
+			Expect(restore.ParseAsOfTime("20170102030405")).To(Equal("20170102030405"))
+			Expect(restore.ParseAsOfTime("20170102")).To(Equal("20170102235959"))
+		})
+		It("returns an error for a time in any other format", func() {
+			_, err := restore.ParseAsOfTime("yesterday")
+			Expect(err).To(MatchError(`Time yesterday is invalid.  Times must be in the format "YYYY-MM-DD HH:MM:SS", "YYYY-MM-DD HH:MM", YYYY-MM-DD, YYYYMMDDHHMMSS, or YYYYMMDD.`))
+		})
+	})
+	Describe("GetLatestBackupTimestamp", func() {
+		history := &backup_history.History{BackupConfigs: []backup_history.BackupConfig{
+			{Timestamp: "20170108010101", DatabaseName: "testdb", ClusterID: "sdw:5432"},
+			{Timestamp: "20170107010101", DatabaseName: "testdb", ClusterID: "mdw:5432", RestorePlan: []backup_history.RestorePlanEntry{{Timestamp: "20170104010101"}, {Timestamp: "20170107010101"}}},
+			{Timestamp: "20170106010101", DatabaseName: "testdb", BackupDir: "/backups"},
+			{Timestamp: "20170105010101", DatabaseName: "testdb", Status: backup_history.BACKUP_STATUS_FAILURE},
+			{Timestamp: "20170104010101", DatabaseName: "testdb", Deleted: true},
+			{Timestamp: "20170103010101", DatabaseName: "otherdb"},
+			{Timestamp: "20170102010101", DatabaseName: "testdb", Status: backup_history.BACKUP_STATUS_SUCCESS},
+			{Timestamp: "20170101010101", DatabaseName: `"Test DB"`, Plugin: "/usr/local/bin/plugin"},
+		}}
+		It("chooses the latest restorable backup of the database in the default backup directory", func() {
+			timestamp, err := restore.GetLatestBackupTimestamp(history, "testdb", "mdw:5432", "", "", "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(timestamp).To(Equal("20170102010101"))
+		})
+		It("chooses only backups of the given cluster", func() {
+			timestamp, err := restore.GetLatestBackupTimestamp(history, "testdb", "sdw:5432", "", "", "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(timestamp).To(Equal("20170108010101"))
+		})
+		It("chooses only backups in the given backup directory", func() {
+			timestamp, err := restore.GetLatestBackupTimestamp(history, "testdb", "mdw:5432", "/backups", "", "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(timestamp).To(Equal("20170106010101"))
+		})
+		It("chooses only backups stored with the given plugin", func() {
+			timestamp, err := restore.GetLatestBackupTimestamp(history, "Test DB", "mdw:5432", "", "/usr/local/bin/plugin", "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(timestamp).To(Equal("20170101010101"))
+		})
+		It("chooses the latest backup taken at or before the given time", func() {
+			timestamp, err := restore.GetLatestBackupTimestamp(history, "otherdb", "mdw:5432", "", "", "20170103010101")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(timestamp).To(Equal("20170103010101"))
+		})
+		It("returns an error if no backup matches", func() {
+			_, err := restore.GetLatestBackupTimestamp(history, "testdb", "mdw:5432", "", "", "20170101235959")
+			Expect(err).To(MatchError("No restorable backup of database testdb on cluster mdw:5432 was taken at or before 20170101235959"))
+			_, err = restore.GetLatestBackupTimestamp(history, "Test DB", "mdw:5432", "", "", "")
+			Expect(err).To(MatchError("No restorable backup of database Test DB on cluster mdw:5432 was found"))
+			_, err = restore.GetLatestBackupTimestamp(history, "otherdb", "mdw:5432", "/backups", "/usr/local/bin/plugin", "")
+			Expect(err).To(MatchError("No restorable backup of database otherdb on cluster mdw:5432 in backup directory /backups stored with plugin /usr/local/bin/plugin was found"))
+		})
+	})
+})
@@ -101,10 +101,8 @@ func GenerateRestoreRelationList() []string {
 	}
 	return relationList
 }
-func ValidateRelationsInRestoreDatabase(connectionPool *dbconn.DBConn, relationList []string) {
-	if len(relationList) == 0 {
-		return
-	}
+
+func GetRelationsInRestoreDatabase(connectionPool *dbconn.DBConn, relationList []string) []string {
 	utils.ValidateFQNs(relationList)
 	quotedTablesStr := utils.SliceToQuotedString(relationList)
 	query := fmt.Sprintf(`
@@ -113,7 +111,14 @@ SELECT
 FROM pg_namespace n
 JOIN pg_class c ON n.oid = c.relnamespace
 WHERE quote_ident(n.nspname) || '.' || quote_ident(c.relname) IN (%s)`, quotedTablesStr)
-	relationsInDB := dbconn.MustSelectStringSlice(connectionPool, query)
+	return dbconn.MustSelectStringSlice(connectionPool, query)
+}
+
+func ValidateRelationsInRestoreDatabase(connectionPool *dbconn.DBConn, relationList []string) {
+	if len(relationList) == 0 {
+		return
+	}
+	relationsInDB := GetRelationsInRestoreDatabase(connectionPool, relationList)
 
 	/*
 	 * For data-only we check that the relations we are planning to restore
@@ -228,6 +233,9 @@ func ValidateBackupFlagCombinations() {
 	if backupConfig.DataOnly && MustGetFlagBool(utils.METADATA_ONLY) {
 		gplog.Fatal(errors.Errorf("Cannot use metadata-only flag when restoring data-only backup"), "")
 	}
+	if MustGetFlagBool(utils.TRUNCATE_TABLE) && !backupConfig.DataOnly && !MustGetFlagBool(utils.DATA_ONLY) {
+		gplog.Fatal(errors.Errorf("Cannot use truncate-table flag unless restoring data only.  Use the data-only flag or restore a data-only backup."), "")
+	}
 	validateBackupFlagPluginCombinations()
 }
 
@@ -247,5 +255,9 @@ func ValidateFlagCombinations(flags *pflag.FlagSet) {
 	utils.CheckExclusiveFlags(flags, utils.EXCLUDE_SCHEMA, utils.INCLUDE_SCHEMA)
 	utils.CheckExclusiveFlags(flags, utils.EXCLUDE_SCHEMA, utils.EXCLUDE_RELATION, utils.INCLUDE_RELATION, utils.EXCLUDE_RELATION_FILE, utils.INCLUDE_RELATION_FILE)
 	utils.CheckExclusiveFlags(flags, utils.METADATA_ONLY, utils.DATA_ONLY)
+	utils.CheckExclusiveFlags(flags, utils.METADATA_ONLY, utils.TRUNCATE_TABLE)
 	utils.CheckExclusiveFlags(flags, utils.PLUGIN_CONFIG, utils.BACKUP_DIR)
+	utils.CheckExclusiveFlags(flags, utils.DRY_RUN, utils.OUTPUT_SQL, utils.RESUME)
+	utils.CheckExclusiveFlags(flags, utils.REDIRECT_SCHEMA, utils.REDIRECT_SCHEMA_FILE, utils.REDIRECT_TABLE_FILE)
+	utils.CheckExclusiveFlags(flags, utils.TIMESTAMP, utils.AS_OF)
 }
@@ -10,6 +10,7 @@ import (
 	"github.com/greenplum-db/gpbackup/backup_filepath"
 	"github.com/greenplum-db/gpbackup/backup_history"
 	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
 )
 
 /*
@@ -87,7 +88,15 @@ func SetMaxCsvLineLengthQuery(connectionPool *dbconn.DBConn) string {
 
 func InitializeBackupConfig() {
 	backupConfig = backup_history.ReadConfigFile(globalFPInfo.GetConfigFilePath())
-	utils.InitializePipeThroughParameters(backupConfig.Compressed, 0)
+	// The key is checked before any encrypted file is read so that a wrong key fails the restore immediately
+	err := utils.InitializeEncryption(MustGetFlagString(utils.ENCRYPTION_KEY_FILE))
+	gplog.FatalOnError(err)
+	err = utils.ValidateEncryptionKey(backupConfig.EncryptionKeyFingerprint)
+	gplog.FatalOnError(err)
+	err = utils.InitializeBandwidthLimits(globalCluster, MustGetFlagString(utils.MAX_BANDWIDTH), MustGetFlagString(utils.MAX_HOST_BANDWIDTH), MustGetFlagInt(utils.JOBS))
+	gplog.FatalOnError(err)
+	// Plugin backups with a data file per table have their checksums verified as the data is read back
+	utils.InitializePipeThroughParameters(backupConfig.Compressed, backupConfig.GetCompressionType(), 0, MustGetFlagString(utils.PLUGIN_CONFIG) != "" && !backupConfig.SingleDataFile)
 	utils.EnsureBackupVersionCompatibility(backupConfig.BackupVersion, version)
 	utils.EnsureDatabaseVersionCompatibility(backupConfig.DatabaseVersion, connectionPool.Version)
 }
@@ -105,17 +114,162 @@ func InitializeFilterLists() {
 	}
 }
 
+/*
+ * With --redirect-schema, every schema being restored is restored to the one
+ * target schema.  With --redirect-schema-file, only the schemas listed in the
+ * file are redirected.  A restore that would give two relations the same name
+ * is rejected.
+ */
+func InitializeRedirectSchemas() {
+	schemaMap := make(map[string]string)
+	if redirectSchema := MustGetFlagString(utils.REDIRECT_SCHEMA); redirectSchema != "" {
+		targetSchema := utils.QuoteIdent(connectionPool, redirectSchema)
+		for _, schema := range GetRestoredSchemas() {
+			schemaMap[schema] = targetSchema
+		}
+	} else if redirectSchemaFile := MustGetFlagString(utils.REDIRECT_SCHEMA_FILE); redirectSchemaFile != "" {
+		unquotedSchemaMap, err := ParseRedirectLines(iohelper.MustReadLinesFromFile(redirectSchemaFile))
+		if err != nil {
+			gplog.Fatal(errors.Wrapf(err, "Invalid schema mapping file %s", redirectSchemaFile), "")
+		}
+		for sourceSchema, targetSchema := range unquotedSchemaMap {
+			schemaMap[utils.QuoteIdent(connectionPool, sourceSchema)] = utils.QuoteIdent(connectionPool, targetSchema)
+		}
+	}
+	for sourceSchema, targetSchema := range schemaMap {
+		gplog.Verbose("Objects in schema %s will be restored to schema %s", sourceSchema, targetSchema)
+	}
+	redirectSchemas = schemaMap
+	if len(schemaMap) == 0 {
+		return
+	}
+	conflicts := utils.FindRedirectSchemaConflicts(getRestoredRelationFQNs(), schemaMap)
+	if len(conflicts) > 0 {
+		gplog.Fatal(errors.Errorf("Cannot redirect schemas, as relations in different schemas would be restored with the same name: %s",
+			strings.Join(conflicts, "; ")), "")
+	}
+	metadataEntries := append(append([]utils.MetadataEntry{}, globalTOC.PredataEntries...), globalTOC.PostdataEntries...)
+	redirectedObjectNames = utils.GetRedirectedObjectNames(metadataEntries, schemaMap)
+}
+
+// Returns the FQNs of the tables, views, and sequences being restored
+func getRestoredRelationFQNs() []string {
+	includeSchemaSet := utils.NewIncludeSet(MustGetFlagStringSlice(utils.INCLUDE_SCHEMA))
+	excludeSchemaSet := utils.NewExcludeSet(MustGetFlagStringSlice(utils.EXCLUDE_SCHEMA))
+	includeRelationSet := utils.NewIncludeSet(MustGetFlagStringSlice(utils.INCLUDE_RELATION))
+	excludeRelationSet := utils.NewExcludeSet(MustGetFlagStringSlice(utils.EXCLUDE_RELATION))
+	relationTypes := map[string]bool{"TABLE": true, "VIEW": true, "SEQUENCE": true}
+	relationFQNs := make([]string, 0)
+	for _, entry := range globalTOC.PredataEntries {
+		relationFQN := utils.MakeFQN(entry.Schema, entry.Name)
+		if relationTypes[entry.ObjectType] && includeSchemaSet.MatchesFilter(entry.Schema) && excludeSchemaSet.MatchesFilter(entry.Schema) &&
+			includeRelationSet.MatchesFilter(relationFQN) && excludeRelationSet.MatchesFilter(relationFQN) {
+			relationFQNs = append(relationFQNs, relationFQN)
+		}
+	}
+	return relationFQNs
+}
+
+/*
+ * Each table in the file is restored under its target name.  Only the
+ * metadata belonging to the table itself is renamed, so that the table can be
+ * restored next to the original table.
+ */
+func InitializeRedirectTables() {
+	tableMap := make(map[string]string)
+	if redirectTableFile := MustGetFlagString(utils.REDIRECT_TABLE_FILE); redirectTableFile != "" {
+		var err error
+		tableMap, err = ParseRedirectLines(iohelper.MustReadLinesFromFile(redirectTableFile))
+		if err != nil {
+			gplog.Fatal(errors.Wrapf(err, "Invalid table mapping file %s", redirectTableFile), "")
+		}
+	}
+	for sourceFQN, targetFQN := range tableMap {
+		utils.ValidateFQNs([]string{sourceFQN, targetFQN})
+		gplog.Verbose("Table %s will be restored as %s", sourceFQN, targetFQN)
+	}
+	redirectTables = tableMap
+}
+
+func ParseRedirectLines(lines []string) (map[string]string, error) {
+	redirectMap := make(map[string]string)
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		names := strings.SplitN(line, "=", 2)
+		if len(names) != 2 || strings.TrimSpace(names[0]) == "" || strings.TrimSpace(names[1]) == "" {
+			return nil, errors.Errorf("Line \"%s\" is not in the format source=target", line)
+		}
+		sourceName := strings.TrimSpace(names[0])
+		if _, ok := redirectMap[sourceName]; ok {
+			return nil, errors.Errorf("%s is mapped more than once", sourceName)
+		}
+		redirectMap[sourceName] = strings.TrimSpace(names[1])
+	}
+	return redirectMap, nil
+}
+
+// Returns the name that a table in the backup is restored to
+func GetRestoredTableFQN(tableFQN string) string {
+	if targetFQN, ok := redirectTables[tableFQN]; ok {
+		return targetFQN
+	}
+	return utils.RedirectSchemaForFQN(tableFQN, redirectSchemas)
+}
+
+/*
+ * Returns the quoted names of the schemas holding the objects being restored,
+ * as selected by the schema and table filters.
+ */
+func GetRestoredSchemas() []string {
+	includeSchemaSet := utils.NewIncludeSet(MustGetFlagStringSlice(utils.INCLUDE_SCHEMA))
+	excludeSchemaSet := utils.NewExcludeSet(MustGetFlagStringSlice(utils.EXCLUDE_SCHEMA))
+	includeRelationSet := utils.NewIncludeSet(MustGetFlagStringSlice(utils.INCLUDE_RELATION))
+	schemas := make([]string, 0)
+	seenSchemas := make(map[string]bool)
+	addSchema := func(schema string, name string) {
+		if schema == "" || seenSchemas[schema] || !includeSchemaSet.MatchesFilter(schema) ||
+			!excludeSchemaSet.MatchesFilter(schema) || !includeRelationSet.MatchesFilter(utils.MakeFQN(schema, name)) {
+			return
+		}
+		seenSchemas[schema] = true
+		schemas = append(schemas, schema)
+	}
+	for _, entry := range globalTOC.PredataEntries {
+		addSchema(entry.Schema, entry.Name)
+	}
+	for _, entry := range globalTOC.DataEntries {
+		addSchema(entry.Schema, entry.Name)
+	}
+	return schemas
+}
+
 func BackupConfigurationValidation() {
 	InitializeFilterLists()
 
 	gplog.Verbose("Gathering information on backup directories")
 	VerifyBackupDirectoriesExistOnAllHosts()
+	if !backupConfig.MetadataOnly && !MustGetFlagBool(utils.METADATA_ONLY) {
+		// gpbackup_helper reads single data files and takes the place of the compression program when needed
+		if backupConfig.SingleDataFile || utils.UsesHelperPipeThroughProgram() {
+			utils.VerifyHelperVersionOnSegments(version, globalCluster)
+		}
+		if utils.IsEncryptionEnabled() {
+			utils.VerifyEncryptionKeyFileOnAllHosts(globalCluster)
+		}
+		if !backupConfig.SingleDataFile {
+			utils.VerifyCompressionProgramOnAllHosts(globalCluster)
+		}
+	}
 
 	VerifyMetadataFilePaths(MustGetFlagBool(utils.WITH_STATS))
 
+	VerifyTOCChecksum()
 	tocFilename := globalFPInfo.GetTOCFilePath()
 	globalTOC = utils.NewTOC(tocFilename)
 	globalTOC.InitializeMetadataEntryMap()
+	VerifyMetadataFileChecksums(MustGetFlagBool(utils.WITH_STATS))
 
 	// Legacy backups prior to the incremental feature would have no restoreplan yaml element
 	if isLegacyBackup := backupConfig.RestorePlan == nil; isLegacyBackup {
@@ -178,7 +332,7 @@ func RecoverMetadataFilesUsingPlugin() {
  */
 
 func GetRestoreMetadataStatements(section string, filename string, includeObjectTypes []string, excludeObjectTypes []string, filterSchemas bool, filterRelations bool) []utils.StatementWithType {
-	metadataFile := iohelper.MustOpenFileForReading(filename)
+	metadataFile := utils.MustOpenFileForReadingAt(filename)
 	var statements []utils.StatementWithType
 	var inSchemas, exSchemas, inRelations, exRelations []string
 	if len(includeObjectTypes) > 0 || len(excludeObjectTypes) > 0 || filterSchemas || filterRelations {
@@ -198,6 +352,10 @@ func GetRestoreMetadataStatements(section string, filename string, includeObject
 		}
 	}
 	statements = globalTOC.GetSQLStatementForObjectTypes(section, metadataFile, includeObjectTypes, excludeObjectTypes, inSchemas, exSchemas, inRelations, exRelations)
+	if section != "global" {
+		statements = utils.SubstituteRedirectTablesInStatements(statements, redirectTables)
+		statements = utils.SubstituteRedirectSchemasInStatements(statements, redirectSchemas, redirectedObjectNames, connectionPool.Version.AtLeast("6"))
+	}
 	return statements
 }
 
@@ -251,6 +409,11 @@ func RestoreSchemas(schemaStatements []utils.StatementWithType, progressBar util
 					gplog.Fatal(err, errMsg)
 				}
 			}
+		} else if restoreState != nil {
+			err = restoreState.RecordStatement(schema)
+			if err != nil {
+				gplog.Fatal(err, "Unable to write to restore state file")
+			}
 		}
 		progressBar.Increment()
 	}
@@ -39,6 +39,24 @@ var _ = Describe("wrapper tests", func() {
 			Expect(result).To(Equal("SET gp_max_csv_line_length = 4194304;\n"))
 		})
 	})
+	Describe("ParseRedirectLines", func() {
+		It("maps each source schema to its target schema", func() {
+			schemaMap, err := restore.ParseRedirectLines([]string{"public=sandbox", "", " My Schema = sandbox2 "})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(schemaMap).To(Equal(map[string]string{"public": "sandbox", "My Schema": "sandbox2"}))
+		})
+		It("returns an error for a line that is not a mapping", func() {
+			_, err := restore.ParseRedirectLines([]string{"public"})
+
+			Expect(err).To(MatchError(`Line "public" is not in the format source=target`))
+		})
+		It("returns an error for a schema that is mapped twice", func() {
+			_, err := restore.ParseRedirectLines([]string{"public=sandbox", "public=sandbox2"})
+
+			Expect(err).To(MatchError("public is mapped more than once"))
+		})
+	})
 	Describe("RestoreSchemas", func() {
 		var (
 			ignoredProgressBar utils.ProgressBar
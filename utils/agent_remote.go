@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 
@@ -38,6 +39,52 @@ func WriteOidListToSegments(oidList []string, c *cluster.Cluster, fpInfo backup_
 	})
 }
 
+/*
+ * A list with a line for every data file on a segment can be longer than the
+ * longest argument a remote command accepts, so each segment's list is written
+ * to a file in the master data directory and copied from there to the segment,
+ * where it can be read from fpInfo.GetSegmentHelperFilePath(contentID, suffix).
+ * The command that reads the copy is responsible for removing it.
+ */
+func CopyFileListsToSegments(fileLists map[int][]string, suffix string, c *cluster.Cluster, fpInfo backup_filepath.FilePathInfo) {
+	masterFiles := make(map[int]string, len(c.ContentIDs))
+	defer func() {
+		for _, masterFile := range masterFiles {
+			_ = os.Remove(masterFile)
+		}
+	}()
+	for _, contentID := range c.ContentIDs {
+		if contentID == -1 {
+			continue
+		}
+		masterFile := fpInfo.GetSegmentHelperFilePath(-1, fmt.Sprintf("%s_%d", suffix, contentID))
+		masterFiles[contentID] = masterFile
+		err := writeFileList(masterFile, fileLists[contentID])
+		gplog.FatalOnError(err, "Unable to write file list %s", masterFile)
+	}
+	remoteOutput := c.GenerateAndExecuteCommand(fmt.Sprintf("Copying %s lists to segments", suffix), func(contentID int) string {
+		return fmt.Sprintf("rsync %s:%s %s", c.GetHostForContent(-1), masterFiles[contentID], fpInfo.GetSegmentHelperFilePath(contentID, suffix))
+	}, cluster.ON_SEGMENTS)
+	c.CheckClusterError(remoteOutput, fmt.Sprintf("Unable to copy %s lists to segments", suffix), func(contentID int) string {
+		return fmt.Sprintf("Unable to copy %s list for segment %d to host %s", suffix, contentID, c.GetHostForContent(contentID))
+	})
+}
+
+func writeFileList(filename string, lines []string) error {
+	file, err := operating.System.OpenFileWrite(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		_, err = fmt.Fprintln(file, line)
+		if err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
+
 func VerifyHelperVersionOnSegments(version string, c *cluster.Cluster) {
 	remoteOutput := c.GenerateAndExecuteCommand("Verifying gpbackup_helper version", func(contentID int) string {
 		gphome := operating.System.Getenv("GPHOME")
@@ -74,7 +121,16 @@ func StartAgent(c *cluster.Cluster, fpInfo backup_filepath.FilePathInfo, operati
 			_, configFilename := filepath.Split(pluginConfigFile)
 			pluginStr = fmt.Sprintf(" --plugin-config /tmp/%s", configFilename)
 		}
-		helperCmdStr := fmt.Sprintf("gpbackup_helper %s --toc-file %s --oid-file %s --pipe-file %s --data-file %s --content %d%s%s", operation, tocFile, oidFile, pipeFile, backupFile, contentID, pluginStr, compressStr)
+		encryptionStr := ""
+		if IsEncryptionEnabled() {
+			encryptionStr = fmt.Sprintf(" --encryption-key-file %s", encryptionKeyFile)
+		}
+		progressStr := ""
+		if IsProgressFileEnabled() {
+			progressStr = fmt.Sprintf(" --progress-file %s", fpInfo.GetSegmentHelperFilePath(contentID, "progress"))
+		}
+		bandwidthStr := getBandwidthString(GetSegmentBandwidthLimit())
+		helperCmdStr := fmt.Sprintf("gpbackup_helper %s --toc-file %s --oid-file %s --pipe-file %s --data-file %s --content %d%s%s%s%s%s", operation, tocFile, oidFile, pipeFile, backupFile, contentID, pluginStr, compressStr, encryptionStr, progressStr, bandwidthStr)
 
 		return fmt.Sprintf(`cat << HEREDOC > %s
 #!/bin/bash
@@ -95,7 +151,9 @@ func CleanUpHelperFilesOnAllHosts(c *cluster.Cluster, fpInfo backup_filepath.Fil
 		errorFile := fmt.Sprintf("%s_error", fpInfo.GetSegmentPipeFilePath(contentID))
 		oidFile := fpInfo.GetSegmentHelperFilePath(contentID, "oid")
 		scriptFile := fpInfo.GetSegmentHelperFilePath(contentID, "script")
-		return fmt.Sprintf("rm -f %s && rm -f %s && rm -f %s", errorFile, oidFile, scriptFile)
+		progressFile := fpInfo.GetSegmentHelperFilePath(contentID, "progress")
+		checksumsFile := fpInfo.GetSegmentHelperFilePath(contentID, "checksums")
+		return fmt.Sprintf("rm -f %s && rm -f %s && rm -f %s && rm -f %s && rm -f %s", errorFile, oidFile, scriptFile, progressFile, checksumsFile)
 	}, cluster.ON_SEGMENTS)
 	errMsg := fmt.Sprintf("Unable to remove segment helper file(s). See %s for a complete list of segments with errors and remove manually.",
 		gplog.GetLogFilePath())
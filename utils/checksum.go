@@ -0,0 +1,115 @@
+package utils
+
+/*
+ * This file contains functions for computing and verifying the checksums
+ * recorded for backup files.
+ */
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/pkg/errors"
+)
+
+const ChecksumProgram = "sha256sum"
+
+func NewChecksumHash() hash.Hash {
+	return sha256.New()
+}
+
+func FormatChecksum(checksumHash hash.Hash) string {
+	return hex.EncodeToString(checksumHash.Sum(nil))
+}
+
+func ComputeFileChecksum(filename string) (string, error) {
+	file, err := operating.System.OpenFileRead(filename, os.O_RDONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	checksumHash := NewChecksumHash()
+	_, err = io.Copy(checksumHash, file)
+	if err != nil {
+		return "", err
+	}
+	return FormatChecksum(checksumHash), nil
+}
+
+/*
+ * Backups taken before checksums were introduced have no recorded checksum,
+ * so an empty expected checksum is treated as nothing to verify.
+ */
+func VerifyFileChecksum(filename string, expectedChecksum string) error {
+	if expectedChecksum == "" {
+		return nil
+	}
+	actualChecksum, err := ComputeFileChecksum(filename)
+	if err != nil {
+		return err
+	}
+	if actualChecksum != expectedChecksum {
+		return errors.Errorf("Checksum mismatch for file %s: expected %s, found %s", filename, expectedChecksum, actualChecksum)
+	}
+	return nil
+}
+
+/*
+ * Returns the lines of a sha256sum manifest for the files in checksumMap (a
+ * map of filename to expected checksum), in the order of their filenames.
+ */
+func GetChecksumManifest(checksumMap map[string]string) []string {
+	filenames := make([]string, 0, len(checksumMap))
+	for filename := range checksumMap {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	manifest := make([]string, len(filenames))
+	for i, filename := range filenames {
+		manifest[i] = fmt.Sprintf("%s  %s", checksumMap[filename], filename)
+	}
+	return manifest
+}
+
+// Returns the checksum of each file in a manifest written by GetChecksumManifest
+func ReadChecksumManifest(filename string) (map[string]string, error) {
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	checksumMap := make(map[string]string)
+	for _, line := range strings.Split(string(contents), "\n") {
+		fields := strings.SplitN(line, "  ", 2) // Format is "[checksum]  [filename]"
+		if len(fields) == 2 {
+			checksumMap[fields[1]] = fields[0]
+		}
+	}
+	return checksumMap, nil
+}
+
+/*
+ * Returns a shell command that checks each file in the manifest file, which
+ * is removed afterwards, and prints one "<filename>: FAILED" line for each
+ * file that is missing, unreadable, or does not match.
+ */
+func GetVerifyChecksumsCommand(manifestFile string) string {
+	return fmt.Sprintf("%s --check --quiet %s 2>/dev/null; rm -f %s", ChecksumProgram, manifestFile, manifestFile)
+}
+
+func ParseFailedChecksumOutput(output string) []string {
+	failedFiles := make([]string, 0)
+	for _, line := range strings.Split(output, "\n") {
+		index := strings.LastIndex(line, ": FAILED")
+		if index != -1 {
+			failedFiles = append(failedFiles, line[:index])
+		}
+	}
+	return failedFiles
+}
@@ -0,0 +1,86 @@
+package utils_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/checksum tests", func() {
+	abcChecksum := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	Describe("ComputeFileChecksum", func() {
+		var filename string
+		BeforeEach(func() {
+			file, _ := ioutil.TempFile("", "checksum")
+			_, _ = file.WriteString("abc")
+			_ = file.Close()
+			filename = file.Name()
+		})
+		AfterEach(func() {
+			_ = os.Remove(filename)
+		})
+		It("computes the checksum of a file", func() {
+			checksum, err := utils.ComputeFileChecksum(filename)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checksum).To(Equal(abcChecksum))
+		})
+		It("returns an error if the file does not exist", func() {
+			_, err := utils.ComputeFileChecksum("/tmp/file_does_not_exist")
+			Expect(err).To(HaveOccurred())
+		})
+		It("does not return an error if the checksum matches", func() {
+			err := utils.VerifyFileChecksum(filename, abcChecksum)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("does not return an error if no checksum was recorded", func() {
+			err := utils.VerifyFileChecksum("/tmp/file_does_not_exist", "")
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("returns an error if the checksum does not match", func() {
+			err := utils.VerifyFileChecksum(filename, "0123")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Checksum mismatch for file " + filename + ": expected 0123, found " + abcChecksum))
+		})
+	})
+	Describe("GetChecksumManifest", func() {
+		It("creates a sorted checksum manifest for the files to verify", func() {
+			checksumMap := map[string]string{"/data/file2": "2222", "/data/file1": "1111"}
+			Expect(utils.GetChecksumManifest(checksumMap)).To(Equal([]string{"1111  /data/file1", "2222  /data/file2"}))
+		})
+	})
+	Describe("ReadChecksumManifest", func() {
+		It("reads the checksum of each file in a manifest", func() {
+			file, _ := ioutil.TempFile("", "manifest")
+			_, _ = file.WriteString("1111  /data/file1\n2222  /data/file with spaces\n")
+			_ = file.Close()
+			defer os.Remove(file.Name())
+
+			checksumMap, err := utils.ReadChecksumManifest(file.Name())
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checksumMap).To(Equal(map[string]string{"/data/file1": "1111", "/data/file with spaces": "2222"}))
+		})
+		It("returns an error if the manifest does not exist", func() {
+			_, err := utils.ReadChecksumManifest("/tmp/file_does_not_exist")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Describe("GetVerifyChecksumsCommand", func() {
+		It("checks the files in the manifest file and then removes it", func() {
+			Expect(utils.GetVerifyChecksumsCommand("/data/checksums")).To(Equal("sha256sum --check --quiet /data/checksums 2>/dev/null; rm -f /data/checksums"))
+		})
+	})
+	Describe("ParseFailedChecksumOutput", func() {
+		It("returns the files that failed verification", func() {
+			output := "/data/file1: FAILED\n/data/file2: FAILED open or read\n"
+			Expect(utils.ParseFailedChecksumOutput(output)).To(Equal([]string{"/data/file1", "/data/file2"}))
+		})
+		It("returns no files when all files pass verification", func() {
+			Expect(utils.ParseFailedChecksumOutput("")).To(BeEmpty())
+		})
+	})
+})
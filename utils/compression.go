@@ -1,9 +1,15 @@
 package utils
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+)
 
 var (
-	pipeThroughProgram PipeThroughProgram
+	pipeThroughProgram           PipeThroughProgram
+	usesHelperPipeThroughProgram bool
 )
 
 type PipeThroughProgram struct {
@@ -13,11 +19,73 @@ type PipeThroughProgram struct {
 	Extension     string
 }
 
-func InitializePipeThroughParameters(compress bool, compressionLevel int) {
-	if compress {
-		pipeThroughProgram = PipeThroughProgram{Name: "gzip", OutputCommand: fmt.Sprintf("gzip -c -%d", compressionLevel), InputCommand: "gzip -d -c", Extension: ".gz"}
-	} else {
-		pipeThroughProgram = PipeThroughProgram{Name: "cat", OutputCommand: "cat -", InputCommand: "cat -", Extension: ""}
+/*
+ * Each compression type maps to the highest compression level its codec
+ * accepts; all codecs accept a minimum level of 1.
+ */
+var compressionLevelLimits = map[string]int{
+	"gzip": 9,
+	"lz4":  12,
+	"zstd": 19,
+}
+
+/*
+ * Data files stored with a plugin cannot be read back on the segments to
+ * compute or verify their checksums, so streamChecksums has gpbackup_helper
+ * compute or verify them as the data passes through it.
+ */
+func InitializePipeThroughParameters(compress bool, compressionType string, compressionLevel int, streamChecksums bool) {
+	pipeThroughProgram = getCompressionPipeThroughProgram(compress, compressionType, compressionLevel)
+	usesHelperPipeThroughProgram = streamChecksums || IsEncryptionEnabled() || IsThrottlingEnabled()
+	if usesHelperPipeThroughProgram {
+		pipeThroughProgram = getHelperPipeThroughProgram(pipeThroughProgram, compressionLevel)
+	}
+}
+
+/*
+ * When encryption, throttling, or streamed checksums are enabled,
+ * gpbackup_helper takes the place of the compression program in the COPY
+ * pipeline, compressing and then encrypting the stream (or decrypting and then
+ * decompressing it) in a single process, as a pipeline would hide a failure in
+ * an earlier program from COPY.
+ */
+func getHelperPipeThroughProgram(compression PipeThroughProgram, compressionLevel int) PipeThroughProgram {
+	helperCommand := fmt.Sprintf("%s/bin/gpbackup_helper", operating.System.Getenv("GPHOME"))
+	outputModeStr := " --compress"
+	inputModeStr := " --decompress"
+	extension := compression.Extension
+	if IsEncryptionEnabled() {
+		outputModeStr = fmt.Sprintf(" --encrypt --encryption-key-file %s", encryptionKeyFile)
+		inputModeStr = fmt.Sprintf(" --decrypt --encryption-key-file %s", encryptionKeyFile)
+		extension += EncryptionExtension
+	}
+	bandwidthStr := getBandwidthString(GetStreamBandwidthLimit())
+	outputCompressStr := ""
+	inputCompressStr := ""
+	if compression.Name != "cat" {
+		outputCompressStr = fmt.Sprintf(" --compression-type %s --compression-level %d", compression.Name, compressionLevel)
+		inputCompressStr = fmt.Sprintf(" --compression-type %s", compression.Name)
+	}
+	return PipeThroughProgram{
+		Name:          compression.Name,
+		OutputCommand: helperCommand + outputModeStr + bandwidthStr + outputCompressStr,
+		InputCommand:  helperCommand + inputModeStr + bandwidthStr + inputCompressStr,
+		Extension:     extension,
+	}
+}
+
+func getCompressionPipeThroughProgram(compress bool, compressionType string, compressionLevel int) PipeThroughProgram {
+	if !compress {
+		return PipeThroughProgram{Name: "cat", OutputCommand: "cat -", InputCommand: "cat -", Extension: ""}
+	}
+	switch compressionType {
+	case "zstd":
+		return PipeThroughProgram{Name: "zstd", OutputCommand: fmt.Sprintf("zstd --compress -%d -c", compressionLevel), InputCommand: "zstd --decompress -c", Extension: ".zst"}
+	case "lz4":
+		return PipeThroughProgram{Name: "lz4", OutputCommand: fmt.Sprintf("lz4 -%d -c", compressionLevel), InputCommand: "lz4 -d -c", Extension: ".lz4"}
+	default:
+		// Backups taken before --compression-type was added have no type recorded and were always compressed with gzip
+		return PipeThroughProgram{Name: "gzip", OutputCommand: fmt.Sprintf("gzip -c -%d", compressionLevel), InputCommand: "gzip -d -c", Extension: ".gz"}
 	}
 }
 
@@ -28,3 +96,31 @@ func GetPipeThroughProgram() PipeThroughProgram {
 func SetPipeThroughProgram(compression PipeThroughProgram) {
 	pipeThroughProgram = compression
 }
+
+// Returns whether COPY runs gpbackup_helper on the segments instead of a compression program
+func UsesHelperPipeThroughProgram() bool {
+	return usesHelperPipeThroughProgram
+}
+
+/*
+ * Unlike gzip, the zstd and lz4 programs are not installed with Greenplum, so
+ * when COPY pipes data through them rather than through gpbackup_helper, they
+ * are checked for on every segment host before any data is copied.
+ */
+func VerifyCompressionProgramOnAllHosts(c *cluster.Cluster) {
+	program := pipeThroughProgram.Name
+	if usesHelperPipeThroughProgram || (program != "zstd" && program != "lz4") {
+		return
+	}
+	remoteOutput := c.GenerateAndExecuteCommand(fmt.Sprintf("Verifying %s is installed on all hosts", program), func(contentID int) string {
+		return fmt.Sprintf("command -v %s > /dev/null", program)
+	}, cluster.ON_HOSTS)
+	c.CheckClusterError(remoteOutput, fmt.Sprintf("Compression program %s is not installed on all hosts", program), func(contentID int) string {
+		return fmt.Sprintf("Compression program %s is not installed on host %s", program, c.GetHostForContent(contentID))
+	})
+}
+
+func GetMaxCompressionLevel(compressionType string) (int, bool) {
+	maxLevel, ok := compressionLevelLimits[compressionType]
+	return maxLevel, ok
+}
@@ -8,8 +8,10 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/structmatcher"
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
 
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("utils/compression tests", func() {
@@ -39,7 +41,7 @@ var _ = Describe("utils/compression tests", func() {
 				InputCommand:  "cat -",
 				Extension:     "",
 			}
-			utils.InitializePipeThroughParameters(false, 3)
+			utils.InitializePipeThroughParameters(false, "", 3, false)
 			resultProgram := utils.GetPipeThroughProgram()
 			structmatcher.ExpectStructsToMatch(&expectedProgram, &resultProgram)
 		})
@@ -52,9 +54,91 @@ var _ = Describe("utils/compression tests", func() {
 				InputCommand:  "gzip -d -c",
 				Extension:     ".gz",
 			}
-			utils.InitializePipeThroughParameters(true, 7)
+			utils.InitializePipeThroughParameters(true, "gzip", 7, false)
 			resultProgram := utils.GetPipeThroughProgram()
 			structmatcher.ExpectStructsToMatch(&expectedProgram, &resultProgram)
 		})
+		It("initializes to use gzip when passed compression and no compression type", func() {
+			originalProgram := utils.GetPipeThroughProgram()
+			defer utils.SetPipeThroughProgram(originalProgram)
+			expectedProgram := utils.PipeThroughProgram{
+				Name:          "gzip",
+				OutputCommand: "gzip -c -1",
+				InputCommand:  "gzip -d -c",
+				Extension:     ".gz",
+			}
+			utils.InitializePipeThroughParameters(true, "", 1, false)
+			resultProgram := utils.GetPipeThroughProgram()
+			structmatcher.ExpectStructsToMatch(&expectedProgram, &resultProgram)
+		})
+		It("initializes to use zstd when passed compression type zstd and a level", func() {
+			originalProgram := utils.GetPipeThroughProgram()
+			defer utils.SetPipeThroughProgram(originalProgram)
+			expectedProgram := utils.PipeThroughProgram{
+				Name:          "zstd",
+				OutputCommand: "zstd --compress -3 -c",
+				InputCommand:  "zstd --decompress -c",
+				Extension:     ".zst",
+			}
+			utils.InitializePipeThroughParameters(true, "zstd", 3, false)
+			resultProgram := utils.GetPipeThroughProgram()
+			structmatcher.ExpectStructsToMatch(&expectedProgram, &resultProgram)
+		})
+		It("initializes to use lz4 when passed compression type lz4 and a level", func() {
+			originalProgram := utils.GetPipeThroughProgram()
+			defer utils.SetPipeThroughProgram(originalProgram)
+			expectedProgram := utils.PipeThroughProgram{
+				Name:          "lz4",
+				OutputCommand: "lz4 -4 -c",
+				InputCommand:  "lz4 -d -c",
+				Extension:     ".lz4",
+			}
+			utils.InitializePipeThroughParameters(true, "lz4", 4, false)
+			resultProgram := utils.GetPipeThroughProgram()
+			structmatcher.ExpectStructsToMatch(&expectedProgram, &resultProgram)
+		})
+		It("pipes data through gpbackup_helper when checksums are streamed", func() {
+			originalProgram := utils.GetPipeThroughProgram()
+			defer utils.SetPipeThroughProgram(originalProgram)
+			defer utils.InitializePipeThroughParameters(false, "", 1, false)
+			operating.System.Getenv = func(key string) string { return "/usr/local/gpdb" }
+			expectedProgram := utils.PipeThroughProgram{
+				Name:          "gzip",
+				OutputCommand: "/usr/local/gpdb/bin/gpbackup_helper --compress --compression-type gzip --compression-level 7",
+				InputCommand:  "/usr/local/gpdb/bin/gpbackup_helper --decompress --compression-type gzip",
+				Extension:     ".gz",
+			}
+			utils.InitializePipeThroughParameters(true, "gzip", 7, true)
+			resultProgram := utils.GetPipeThroughProgram()
+			structmatcher.ExpectStructsToMatch(&expectedProgram, &resultProgram)
+			Expect(utils.UsesHelperPipeThroughProgram()).To(BeTrue())
+		})
+	})
+	Describe("VerifyCompressionProgramOnAllHosts", func() {
+		AfterEach(func() {
+			utils.InitializePipeThroughParameters(false, "", 1, false)
+		})
+		It("checks that zstd is installed on all hosts", func() {
+			utils.InitializePipeThroughParameters(true, "zstd", 3, false)
+			utils.VerifyCompressionProgramOnAllHosts(testCluster)
+			Expect(testExecutor.NumExecutions).To(Equal(1))
+			for _, cmd := range testExecutor.ClusterCommands[0] {
+				Expect(cmd[len(cmd)-1]).To(Equal("command -v zstd > /dev/null"))
+			}
+		})
+		It("does not check for gzip, which is installed with Greenplum", func() {
+			utils.InitializePipeThroughParameters(true, "gzip", 1, false)
+			utils.VerifyCompressionProgramOnAllHosts(testCluster)
+			Expect(testExecutor.NumExecutions).To(Equal(0))
+		})
+		It("panics if lz4 is not installed on a host", func() {
+			utils.InitializePipeThroughParameters(true, "lz4", 1, false)
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{
+				NumErrors: 1,
+				Errors:    map[int]error{1: errors.Errorf("exit status 1")},
+			}
+			defer testhelper.ShouldPanicWithMessage("Compression program lz4 is not installed on all hosts")
+			utils.VerifyCompressionProgramOnAllHosts(testCluster)
+		})
 	})
 })
@@ -0,0 +1,379 @@
+package utils
+
+/*
+ * This file contains functions for encrypting backup files at rest with
+ * AES-256-GCM.
+ *
+ * An encrypted stream starts with a header containing a magic string and a
+ * random nonce prefix, followed by a series of chunks.  Each chunk holds up to
+ * encryptionChunkSize bytes of plaintext sealed with a nonce made from the
+ * prefix and the chunk's position in the stream, and is preceded by its
+ * length.  The last chunk is sealed as such, so a stream that has been
+ * truncated or reordered fails to decrypt instead of yielding partial data.
+ */
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/pkg/errors"
+)
+
+const (
+	EncryptionExtension = ".enc"
+	encryptionChunkSize = 64 * 1024
+	encryptionKeySize   = 32
+	chunkCounterSize    = 4
+	chunkLengthSize     = 4
+)
+
+var (
+	encryptionMagic   = []byte("GPBKENC1")
+	encryptionKey     []byte
+	encryptionKeyFile string
+)
+
+/*
+ * The key file must contain a 32-byte key encoded as 64 hexadecimal
+ * characters, such as the output of "openssl rand -hex 32".
+ */
+func ReadEncryptionKeyFile(keyFile string) ([]byte, error) {
+	contents, err := operating.System.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(contents)))
+	if err != nil || len(key) != encryptionKeySize {
+		return nil, errors.Errorf("Encryption key file %s must contain a %d-byte key encoded as %d hexadecimal characters",
+			keyFile, encryptionKeySize, 2*encryptionKeySize)
+	}
+	return key, nil
+}
+
+func InitializeEncryption(keyFile string) error {
+	encryptionKey = nil
+	encryptionKeyFile = ""
+	if keyFile == "" {
+		return nil
+	}
+	key, err := ReadEncryptionKeyFile(keyFile)
+	if err != nil {
+		return err
+	}
+	encryptionKey = key
+	encryptionKeyFile = keyFile
+	return nil
+}
+
+func IsEncryptionEnabled() bool {
+	return encryptionKey != nil
+}
+
+func GetEncryptionKeyFile() string {
+	return encryptionKeyFile
+}
+
+// Returns "" if encryption is not enabled
+func GetEncryptionKeyFingerprint() string {
+	if encryptionKey == nil {
+		return ""
+	}
+	return GetKeyFingerprint(encryptionKey)
+}
+
+func GetKeyFingerprint(key []byte) string {
+	fingerprint := sha256.Sum256(key)
+	return hex.EncodeToString(fingerprint[:])
+}
+
+/*
+ * Checks the key given for this run against the fingerprint recorded for a
+ * backup, so that a missing or wrong key is reported before any file is read.
+ */
+func ValidateEncryptionKey(backupFingerprint string) error {
+	if backupFingerprint == "" {
+		if encryptionKey != nil {
+			return errors.Errorf("An encryption key file was provided, but the backup is not encrypted")
+		}
+		return nil
+	}
+	if encryptionKey == nil {
+		return errors.Errorf("The backup is encrypted; its encryption key file must be provided with --encryption-key-file")
+	}
+	if fingerprint := GetEncryptionKeyFingerprint(); fingerprint != backupFingerprint {
+		return errors.Errorf("The key in encryption key file %s does not match the key used to encrypt the backup: expected fingerprint %s, found %s",
+			encryptionKeyFile, backupFingerprint, fingerprint)
+	}
+	return nil
+}
+
+/*
+ * gpbackup_helper reads the key from the copy of the key file on its own host,
+ * so it prints the fingerprint of each copy to be checked against the key read
+ * here; the helper version must already have been verified.
+ */
+func VerifyEncryptionKeyFileOnAllHosts(c *cluster.Cluster) {
+	remoteOutput := c.GenerateAndExecuteCommand("Verifying encryption key file on all hosts", func(contentID int) string {
+		return fmt.Sprintf("%s/bin/gpbackup_helper --print-key-fingerprint --encryption-key-file %s", operating.System.Getenv("GPHOME"), encryptionKeyFile)
+	}, cluster.ON_HOSTS_AND_MASTER)
+	c.CheckClusterError(remoteOutput, fmt.Sprintf("Encryption key file %s does not exist or does not contain a valid key on all hosts", encryptionKeyFile), func(contentID int) string {
+		return fmt.Sprintf("Encryption key file %s does not exist or does not contain a valid key on host %s", encryptionKeyFile, c.GetHostForContent(contentID))
+	})
+
+	numIncorrect := 0
+	for contentID := range remoteOutput.Stdouts {
+		if fingerprint := strings.TrimSpace(remoteOutput.Stdouts[contentID]); fingerprint != GetEncryptionKeyFingerprint() {
+			gplog.Verbose("Encryption key mismatch on host %s: Expected fingerprint %s, found fingerprint %s.", c.GetHostForContent(contentID), GetEncryptionKeyFingerprint(), fingerprint)
+			numIncorrect++
+		}
+	}
+	if numIncorrect > 0 {
+		cluster.LogFatalClusterError(fmt.Sprintf("Encryption key file %s must contain the same key on every host, but found a different key", encryptionKeyFile), cluster.ON_HOSTS_AND_MASTER, numIncorrect)
+	}
+}
+
+/*
+ * Streaming encryption and decryption
+ */
+
+type encryptWriter struct {
+	writer      io.Writer
+	aead        cipher.AEAD
+	noncePrefix []byte
+	counter     uint32
+	buffer      []byte
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func getChunkNonce(noncePrefix []byte, counter uint32) []byte {
+	nonce := make([]byte, len(noncePrefix)+chunkCounterSize)
+	copy(nonce, noncePrefix)
+	binary.BigEndian.PutUint32(nonce[len(noncePrefix):], counter)
+	return nonce
+}
+
+func getChunkAdditionalData(isLastChunk bool) []byte {
+	if isLastChunk {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+/*
+ * Close must be called once everything has been written to seal the last
+ * chunk; it does not close the underlying writer.
+ */
+func NewEncryptWriter(writer io.Writer, key []byte) (io.WriteCloser, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	noncePrefix := make([]byte, aead.NonceSize()-chunkCounterSize)
+	_, err = rand.Read(noncePrefix)
+	if err != nil {
+		return nil, err
+	}
+	_, err = writer.Write(append(append([]byte{}, encryptionMagic...), noncePrefix...))
+	if err != nil {
+		return nil, err
+	}
+	return &encryptWriter{writer: writer, aead: aead, noncePrefix: noncePrefix, buffer: make([]byte, 0, encryptionChunkSize)}, nil
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	bytesWritten := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data arrives, so that Close always has a last chunk to seal
+		if len(w.buffer) == encryptionChunkSize {
+			err := w.sealChunk(false)
+			if err != nil {
+				return bytesWritten, err
+			}
+		}
+		n := copy(w.buffer[len(w.buffer):encryptionChunkSize], p)
+		w.buffer = w.buffer[:len(w.buffer)+n]
+		p = p[n:]
+		bytesWritten += n
+	}
+	return bytesWritten, nil
+}
+
+func (w *encryptWriter) Close() error {
+	return w.sealChunk(true)
+}
+
+func (w *encryptWriter) sealChunk(isLastChunk bool) error {
+	if w.counter == math.MaxUint32 {
+		return errors.New("Too much data to encrypt in a single stream")
+	}
+	ciphertext := w.aead.Seal(nil, getChunkNonce(w.noncePrefix, w.counter), w.buffer, getChunkAdditionalData(isLastChunk))
+	w.counter++
+	w.buffer = w.buffer[:0]
+	length := make([]byte, chunkLengthSize)
+	binary.BigEndian.PutUint32(length, uint32(len(ciphertext)))
+	_, err := w.writer.Write(append(length, ciphertext...))
+	return err
+}
+
+type decryptReader struct {
+	reader      io.Reader
+	aead        cipher.AEAD
+	noncePrefix []byte
+	counter     uint32
+	plaintext   []byte
+	done        bool
+}
+
+func NewDecryptReader(reader io.Reader, key []byte) (io.Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, len(encryptionMagic)+aead.NonceSize()-chunkCounterSize)
+	_, err = io.ReadFull(reader, header)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read encryption header")
+	}
+	if !IsEncrypted(header) {
+		return nil, errors.New("Data is not encrypted")
+	}
+	return &decryptReader{reader: reader, aead: aead, noncePrefix: header[len(encryptionMagic):]}, nil
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.plaintext) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		err := r.openChunk()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plaintext)
+	r.plaintext = r.plaintext[n:]
+	return n, nil
+}
+
+func (r *decryptReader) openChunk() error {
+	length := make([]byte, chunkLengthSize)
+	_, err := io.ReadFull(r.reader, length)
+	if err == io.EOF {
+		return errors.New("Encrypted data is truncated")
+	} else if err != nil {
+		return err
+	}
+	size := binary.BigEndian.Uint32(length)
+	if size > encryptionChunkSize+uint32(r.aead.Overhead()) {
+		return errors.New("Encrypted data is corrupt")
+	}
+	ciphertext := make([]byte, size)
+	_, err = io.ReadFull(r.reader, ciphertext)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errors.New("Encrypted data is truncated")
+	} else if err != nil {
+		return err
+	}
+	nonce := getChunkNonce(r.noncePrefix, r.counter)
+	plaintext, err := r.aead.Open(nil, nonce, ciphertext, getChunkAdditionalData(false))
+	if err != nil {
+		plaintext, err = r.aead.Open(nil, nonce, ciphertext, getChunkAdditionalData(true))
+		if err != nil {
+			return errors.New("Unable to decrypt data; the encryption key is incorrect or the data is corrupt")
+		}
+		r.done = true
+		_, err = io.ReadFull(r.reader, make([]byte, 1))
+		if err != io.EOF {
+			return errors.New("Encrypted data has unexpected bytes after the last chunk")
+		}
+	}
+	r.counter++
+	r.plaintext = plaintext
+	return nil
+}
+
+/*
+ * Functions for encrypting and decrypting whole files on the master
+ */
+
+func IsEncrypted(contents []byte) bool {
+	return bytes.HasPrefix(contents, encryptionMagic)
+}
+
+// Returns contents unchanged if encryption is not enabled
+func EncryptIfEnabled(contents []byte) ([]byte, error) {
+	if encryptionKey == nil {
+		return contents, nil
+	}
+	var buffer bytes.Buffer
+	writer, err := NewEncryptWriter(&buffer, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	_, err = writer.Write(contents)
+	if err != nil {
+		return nil, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Returns contents unchanged if they are not encrypted
+func DecryptIfEncrypted(contents []byte) ([]byte, error) {
+	if !IsEncrypted(contents) {
+		return contents, nil
+	}
+	if encryptionKey == nil {
+		return nil, errors.New("File is encrypted; an encryption key file must be provided with --encryption-key-file")
+	}
+	reader, err := NewDecryptReader(bytes.NewReader(contents), encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(reader)
+}
+
+/*
+ * Metadata files are read at arbitrary offsets, which the chunked stream
+ * format does not allow, so an encrypted file is decrypted into memory.
+ */
+func MustOpenFileForReadingAt(filename string) io.ReaderAt {
+	file := iohelper.MustOpenFileForReading(filename)
+	header := make([]byte, len(encryptionMagic))
+	bytesRead, _ := file.ReadAt(header, 0)
+	if !IsEncrypted(header[:bytesRead]) {
+		return file
+	}
+	_ = file.Close()
+	contents, err := operating.System.ReadFile(filename)
+	gplog.FatalOnError(err)
+	contents, err = DecryptIfEncrypted(contents)
+	if err != nil {
+		gplog.Fatal(err, fmt.Sprintf("Unable to read file %s", filename))
+	}
+	return bytes.NewReader(contents)
+}
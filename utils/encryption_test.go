@@ -0,0 +1,224 @@
+package utils_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gp-common-go-libs/structmatcher"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/encryption tests", func() {
+	hexKey := "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	otherHexKey := "1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100"
+	var keyFile string
+	var key []byte
+
+	writeKeyFile := func(contents string) string {
+		file, _ := ioutil.TempFile("", "encryption_key")
+		_, _ = file.WriteString(contents)
+		_ = file.Close()
+		return file.Name()
+	}
+	BeforeEach(func() {
+		keyFile = writeKeyFile(hexKey + "\n")
+		key, _ = utils.ReadEncryptionKeyFile(keyFile)
+	})
+	AfterEach(func() {
+		_ = os.Remove(keyFile)
+		_ = utils.InitializeEncryption("")
+		operating.System = operating.InitializeSystemFunctions()
+	})
+	Describe("ReadEncryptionKeyFile", func() {
+		It("reads a hex-encoded key", func() {
+			Expect(key).To(HaveLen(32))
+			Expect(key[31]).To(Equal(byte(0x1f)))
+		})
+		It("returns an error if the key is the wrong length", func() {
+			shortKeyFile := writeKeyFile("0011")
+			defer os.Remove(shortKeyFile)
+			_, err := utils.ReadEncryptionKeyFile(shortKeyFile)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("must contain a 32-byte key encoded as 64 hexadecimal characters"))
+		})
+		It("returns an error if the file does not exist", func() {
+			_, err := utils.ReadEncryptionKeyFile("/tmp/file_does_not_exist")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Describe("NewEncryptWriter and NewDecryptReader", func() {
+		encrypt := func(plaintext []byte) []byte {
+			var buffer bytes.Buffer
+			writer, err := utils.NewEncryptWriter(&buffer, key)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = writer.Write(plaintext)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(writer.Close()).To(Succeed())
+			return buffer.Bytes()
+		}
+		decrypt := func(ciphertext []byte, decryptionKey []byte) ([]byte, error) {
+			reader, err := utils.NewDecryptReader(bytes.NewReader(ciphertext), decryptionKey)
+			if err != nil {
+				return nil, err
+			}
+			return ioutil.ReadAll(reader)
+		}
+		It("round trips empty data", func() {
+			plaintext, err := decrypt(encrypt([]byte{}), key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(plaintext).To(BeEmpty())
+		})
+		It("round trips data spanning several chunks", func() {
+			data := []byte(strings.Repeat("here is some data\n", 10000))
+			ciphertext := encrypt(data)
+			Expect(utils.IsEncrypted(ciphertext)).To(BeTrue())
+			Expect(bytes.Contains(ciphertext, []byte("here is some data"))).To(BeFalse())
+			plaintext, err := decrypt(ciphertext, key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(plaintext).To(Equal(data))
+		})
+		It("returns an error when decrypting with the wrong key", func() {
+			ciphertext := encrypt([]byte("here is some data\n"))
+			_ = os.Remove(keyFile)
+			keyFile = writeKeyFile(otherHexKey)
+			otherKey, _ := utils.ReadEncryptionKeyFile(keyFile)
+			_, err := decrypt(ciphertext, otherKey)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Unable to decrypt data; the encryption key is incorrect or the data is corrupt"))
+		})
+		It("returns an error when the data has been truncated at a chunk boundary", func() {
+			data := []byte(strings.Repeat("a", 64*1024+1))
+			ciphertext := encrypt(data)
+			lastChunkSize := 4 + 1 + 16
+			_, err := decrypt(ciphertext[:len(ciphertext)-lastChunkSize], key)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Encrypted data is truncated"))
+		})
+		It("returns an error when the data has been modified", func() {
+			ciphertext := encrypt([]byte("here is some data\n"))
+			ciphertext[len(ciphertext)-1] ^= 0xff
+			_, err := decrypt(ciphertext, key)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Describe("EncryptIfEnabled and DecryptIfEncrypted", func() {
+		It("leaves contents unchanged when encryption is not enabled", func() {
+			contents, err := utils.EncryptIfEnabled([]byte("contents"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal("contents"))
+			contents, err = utils.DecryptIfEncrypted(contents)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal("contents"))
+		})
+		It("round trips contents when encryption is enabled", func() {
+			Expect(utils.InitializeEncryption(keyFile)).To(Succeed())
+			contents, err := utils.EncryptIfEnabled([]byte("contents"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(utils.IsEncrypted(contents)).To(BeTrue())
+			contents, err = utils.DecryptIfEncrypted(contents)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal("contents"))
+		})
+		It("returns an error when decrypting without a key", func() {
+			Expect(utils.InitializeEncryption(keyFile)).To(Succeed())
+			contents, _ := utils.EncryptIfEnabled([]byte("contents"))
+			_ = utils.InitializeEncryption("")
+			_, err := utils.DecryptIfEncrypted(contents)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Describe("ValidateEncryptionKey", func() {
+		It("succeeds for an unencrypted backup when no key is given", func() {
+			Expect(utils.ValidateEncryptionKey("")).To(Succeed())
+		})
+		It("succeeds when the key matches the fingerprint", func() {
+			Expect(utils.InitializeEncryption(keyFile)).To(Succeed())
+			Expect(utils.ValidateEncryptionKey(utils.GetKeyFingerprint(key))).To(Succeed())
+		})
+		It("returns an error for an encrypted backup when no key is given", func() {
+			err := utils.ValidateEncryptionKey(utils.GetKeyFingerprint(key))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("The backup is encrypted; its encryption key file must be provided with --encryption-key-file"))
+		})
+		It("returns an error for an unencrypted backup when a key is given", func() {
+			Expect(utils.InitializeEncryption(keyFile)).To(Succeed())
+			Expect(utils.ValidateEncryptionKey("")).ToNot(Succeed())
+		})
+		It("returns an error when the key does not match the fingerprint", func() {
+			Expect(utils.InitializeEncryption(keyFile)).To(Succeed())
+			err := utils.ValidateEncryptionKey("0123")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("does not match the key used to encrypt the backup"))
+		})
+	})
+	Describe("VerifyEncryptionKeyFileOnAllHosts", func() {
+		var (
+			testCluster  *cluster.Cluster
+			testExecutor *testhelper.TestExecutor
+		)
+		BeforeEach(func() {
+			operating.System.CurrentUser = func() (*user.User, error) { return &user.User{Username: "testUser", HomeDir: "testDir"}, nil }
+			operating.System.Hostname = func() (string, error) { return "testHost", nil }
+			testExecutor = &testhelper.TestExecutor{}
+			testCluster = cluster.NewCluster([]cluster.SegConfig{
+				{ContentID: -1, Hostname: "localhost", DataDir: "/data/gpseg-1"},
+				{ContentID: 0, Hostname: "remotehost1", DataDir: "/data/gpseg0"},
+			})
+			testCluster.Executor = testExecutor
+			Expect(utils.InitializeEncryption(keyFile)).To(Succeed())
+		})
+		It("succeeds when every host has the same key", func() {
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{
+				Stdouts: map[int]string{-1: utils.GetKeyFingerprint(key) + "\n", 0: utils.GetKeyFingerprint(key) + "\n"},
+			}
+			utils.VerifyEncryptionKeyFileOnAllHosts(testCluster)
+			Expect(testExecutor.NumExecutions).To(Equal(1))
+		})
+		It("panics when a host has a different key", func() {
+			otherKeyFile := writeKeyFile(otherHexKey)
+			defer os.Remove(otherKeyFile)
+			otherKey, _ := utils.ReadEncryptionKeyFile(otherKeyFile)
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{
+				Stdouts: map[int]string{-1: utils.GetKeyFingerprint(key) + "\n", 0: utils.GetKeyFingerprint(otherKey) + "\n"},
+			}
+			defer testhelper.ShouldPanicWithMessage("must contain the same key on every host, but found a different key")
+			utils.VerifyEncryptionKeyFileOnAllHosts(testCluster)
+		})
+	})
+	Describe("InitializePipeThroughParameters", func() {
+		It("pipes data through gpbackup_helper when encryption is enabled", func() {
+			originalProgram := utils.GetPipeThroughProgram()
+			defer utils.SetPipeThroughProgram(originalProgram)
+			operating.System.Getenv = func(key string) string { return "/usr/local/gpdb" }
+			Expect(utils.InitializeEncryption(keyFile)).To(Succeed())
+			expectedProgram := utils.PipeThroughProgram{
+				Name:          "gzip",
+				OutputCommand: "/usr/local/gpdb/bin/gpbackup_helper --encrypt --encryption-key-file " + keyFile + " --compression-type gzip --compression-level 3",
+				InputCommand:  "/usr/local/gpdb/bin/gpbackup_helper --decrypt --encryption-key-file " + keyFile + " --compression-type gzip",
+				Extension:     ".gz.enc",
+			}
+			utils.InitializePipeThroughParameters(true, "gzip", 3, false)
+			resultProgram := utils.GetPipeThroughProgram()
+			structmatcher.ExpectStructsToMatch(&expectedProgram, &resultProgram)
+		})
+		It("does not pass a compression type to gpbackup_helper when compression is disabled", func() {
+			originalProgram := utils.GetPipeThroughProgram()
+			defer utils.SetPipeThroughProgram(originalProgram)
+			operating.System.Getenv = func(key string) string { return "/usr/local/gpdb" }
+			Expect(utils.InitializeEncryption(keyFile)).To(Succeed())
+			utils.InitializePipeThroughParameters(false, "", 0, false)
+			resultProgram := utils.GetPipeThroughProgram()
+			Expect(resultProgram.OutputCommand).To(Equal("/usr/local/gpdb/bin/gpbackup_helper --encrypt --encryption-key-file " + keyFile))
+			Expect(resultProgram.Extension).To(Equal(".enc"))
+		})
+	})
+})
@@ -16,31 +16,55 @@ import (
 const (
 	BACKUP_DIR            = "backup-dir"
 	COMPRESSION_LEVEL     = "compression-level"
+	COMPRESSION_TYPE      = "compression-type"
 	DATA_ONLY             = "data-only"
 	DBNAME                = "dbname"
 	DEBUG                 = "debug"
+	DIFFERENTIAL          = "differential"
+	ENCRYPTION_KEY_FILE   = "encryption-key-file"
 	EXCLUDE_RELATION      = "exclude-table"
 	EXCLUDE_RELATION_FILE = "exclude-table-file"
 	EXCLUDE_SCHEMA        = "exclude-schema"
 	FROM_TIMESTAMP        = "from-timestamp"
+	HISTORY_FILE          = "history-file"
 	INCLUDE_RELATION      = "include-table"
 	INCLUDE_RELATION_FILE = "include-table-file"
 	INCLUDE_SCHEMA        = "include-schema"
 	INCREMENTAL           = "incremental"
 	JOBS                  = "jobs"
 	LEAF_PARTITION_DATA   = "leaf-partition-data"
+	MAX_BANDWIDTH         = "max-bandwidth"
+	MAX_HOST_BANDWIDTH    = "max-host-bandwidth"
 	METADATA_ONLY         = "metadata-only"
 	NO_COMPRESSION        = "no-compression"
 	PLUGIN_CONFIG         = "plugin-config"
+	PROGRESS_FILE         = "progress-file"
 	QUIET                 = "quiet"
+	RESUME                = "resume"
 	SINGLE_DATA_FILE      = "single-data-file"
 	VERBOSE               = "verbose"
 	WITH_STATS            = "with-stats"
 	CREATE_DB             = "create-db"
 	ON_ERROR_CONTINUE     = "on-error-continue"
+	OUTPUT_SQL            = "output-sql"
 	REDIRECT_DB           = "redirect-db"
+	REDIRECT_SCHEMA       = "redirect-schema"
+	REDIRECT_SCHEMA_FILE  = "redirect-schema-file"
+	REDIRECT_TABLE_FILE   = "redirect-table-file"
 	TIMESTAMP             = "timestamp"
+	TRUNCATE_TABLE        = "truncate-table"
 	WITH_GLOBALS          = "with-globals"
+	AFTER                 = "after"
+	AS_OF                 = "as-of"
+	BACKUP_TYPE           = "type"
+	BEFORE                = "before"
+	DRY_RUN               = "dry-run"
+	FORCE                 = "force"
+	FORMAT                = "format"
+	KEEP_DAYS             = "keep-days"
+	KEEP_FULL             = "keep-full"
+	PLUGIN                = "plugin"
+	STATUS                = "status"
 )
 
 /*
@@ -7,6 +7,7 @@ package utils
 
 import (
 	"fmt"
+	"hash"
 	"io"
 	"strings"
 
@@ -90,19 +91,47 @@ type FileWithByteCount struct {
 	Filename  string
 	writer    io.Writer
 	closer    io.WriteCloser
+	encrypter io.WriteCloser
+	checksum  hash.Hash
 	ByteCount uint64
 }
 
 func NewFileWithByteCount(writer io.Writer) *FileWithByteCount {
-	return &FileWithByteCount{"", writer, nil, 0}
+	return &FileWithByteCount{"", writer, nil, nil, nil, 0}
 }
 
+/*
+ * ByteCount counts the bytes written before any encryption, as those are the
+ * offsets at which gprestore reads statements from the decrypted file, while
+ * the checksum covers the bytes as written to disk.
+ */
 func NewFileWithByteCountFromFile(filename string) *FileWithByteCount {
 	file := iohelper.MustOpenFileForWriting(filename)
-	return &FileWithByteCount{filename, file, file, 0}
+	checksum := NewChecksumHash()
+	writer := io.MultiWriter(file, checksum)
+	var encrypter io.WriteCloser
+	if IsEncryptionEnabled() {
+		var err error
+		encrypter, err = NewEncryptWriter(writer, encryptionKey)
+		gplog.FatalOnError(err)
+		writer = encrypter
+	}
+	return &FileWithByteCount{filename, writer, file, encrypter, checksum, 0}
+}
+
+// Returns the checksum of everything written so far, or "" if none is being computed
+func (file *FileWithByteCount) Checksum() string {
+	if file.checksum == nil {
+		return ""
+	}
+	return FormatChecksum(file.checksum)
 }
 
 func (file *FileWithByteCount) Close() {
+	if file.encrypter != nil {
+		err := file.encrypter.Close()
+		gplog.FatalOnError(err)
+	}
 	if file.closer != nil {
 		_ = file.closer.Close()
 		if file.Filename != "" {
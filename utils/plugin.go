@@ -66,13 +66,37 @@ func (plugin *PluginConfig) MustBackupFile(filenamePath string) {
 	gplog.FatalOnError(err)
 }
 
-func (plugin *PluginConfig) MustRestoreFile(filenamePath string) {
+func (plugin *PluginConfig) RestoreFile(filenamePath string) error {
 	directory, _ := filepath.Split(filenamePath)
 	err := operating.System.MkdirAll(directory, 0755)
-	gplog.FatalOnError(err)
+	if err != nil {
+		return err
+	}
 	command := fmt.Sprintf("%s restore_file %s %s", plugin.ExecutablePath, plugin.ConfigPath, filenamePath)
 	output, err := exec.Command("bash", "-c", command).CombinedOutput()
-	gplog.FatalOnError(err, string(output))
+	if err != nil {
+		return fmt.Errorf("Plugin failed to restore %s. %s", filenamePath, string(output))
+	}
+	return nil
+}
+
+func (plugin *PluginConfig) MustRestoreFile(filenamePath string) {
+	err := plugin.RestoreFile(filenamePath)
+	gplog.FatalOnError(err)
+}
+
+/*
+ * Removes every file the plugin stored for the backup with the given
+ * timestamp.  This is run once, on the master, with a plugin that implements
+ * the delete_backup command.
+ */
+func (plugin *PluginConfig) DeleteBackup(timestamp string) error {
+	command := fmt.Sprintf("source %s/greenplum_path.sh && %s delete_backup %s %s", operating.System.Getenv("GPHOME"), plugin.ExecutablePath, plugin.ConfigPath, timestamp)
+	output, err := exec.Command("bash", "-c", command).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Plugin failed to delete backup %s. %s", timestamp, string(output))
+	}
+	return nil
 }
 
 func (plugin *PluginConfig) CheckPluginExistsOnAllHosts(c *cluster.Cluster) {
@@ -0,0 +1,221 @@
+package utils
+
+/*
+ * This file contains functions for writing machine-readable progress events,
+ * one JSON object per line, to the file given with --progress-file.
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/backup_filepath"
+	"github.com/pkg/errors"
+)
+
+const (
+	EVENT_PHASE_START      = "phase_start"
+	EVENT_PHASE_END        = "phase_end"
+	EVENT_TABLE_START      = "table_start"
+	EVENT_TABLE_FINISH     = "table_finish"
+	EVENT_SEGMENT_PROGRESS = "segment_progress"
+	EVENT_ERROR            = "error"
+	EVENT_END              = "end"
+
+	// How often the gpbackup_helper progress files on the segments are read
+	segmentProgressInterval = 10 * time.Second
+)
+
+/*
+ * Rows, Bytes, Segment, and Tables are pointers so that zero values are still
+ * written for the events they apply to.
+ */
+type ProgressEvent struct {
+	Time      string `json:"time"`
+	Program   string `json:"program"`
+	Timestamp string `json:"timestamp"`
+	Event     string `json:"event"`
+	Phase     string `json:"phase,omitempty"`
+	Table     string `json:"table,omitempty"`
+	Oid       uint32 `json:"oid,omitempty"`
+	Rows      *int64 `json:"rows,omitempty"`
+	Bytes     *int64 `json:"bytes,omitempty"`
+	Segment   *int   `json:"segment,omitempty"`
+	Tables    *int64 `json:"tables,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+var (
+	progressFile      io.WriteCloser
+	progressMutex     sync.Mutex
+	progressProgram   string
+	progressTimestamp string
+)
+
+/*
+ * The file is opened for appending so that a path such as /dev/fd/3 can be
+ * used to write events to a file descriptor inherited from the caller.
+ */
+func InitializeProgressFile(filename string, program string, timestamp string) error {
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+	progressFile = nil
+	if filename == "" {
+		return nil
+	}
+	file, err := operating.System.OpenFileWrite(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	progressFile = file
+	progressProgram = program
+	progressTimestamp = timestamp
+	return nil
+}
+
+func IsProgressFileEnabled() bool {
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+	return progressFile != nil
+}
+
+func CloseProgressFile() {
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+	if progressFile != nil {
+		_ = progressFile.Close()
+		progressFile = nil
+	}
+}
+
+// A failure to write an event is not worth failing the backup or restore over
+func EmitProgressEvent(event ProgressEvent) {
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+	if progressFile == nil {
+		return
+	}
+	event.Time = time.Now().Format(time.RFC3339)
+	event.Program = progressProgram
+	event.Timestamp = progressTimestamp
+	line, err := json.Marshal(event)
+	if err == nil {
+		_, err = progressFile.Write(append(line, '\n'))
+	}
+	if err != nil {
+		gplog.Warn("Unable to write progress event: %v", err)
+	}
+}
+
+func EmitPhaseStart(phase string) {
+	EmitProgressEvent(ProgressEvent{Event: EVENT_PHASE_START, Phase: phase})
+}
+
+func EmitPhaseEnd(phase string) {
+	EmitProgressEvent(ProgressEvent{Event: EVENT_PHASE_END, Phase: phase})
+}
+
+func EmitTableStart(table string, oid uint32, bytes int64) {
+	EmitProgressEvent(ProgressEvent{Event: EVENT_TABLE_START, Table: table, Oid: oid, Bytes: &bytes})
+}
+
+func EmitTableFinish(table string, oid uint32, rows int64, bytes int64) {
+	EmitProgressEvent(ProgressEvent{Event: EVENT_TABLE_FINISH, Table: table, Oid: oid, Rows: &rows, Bytes: &bytes})
+}
+
+func EmitError(table string, message string) {
+	EmitProgressEvent(ProgressEvent{Event: EVENT_ERROR, Table: table, Message: message})
+}
+
+func EmitEnd(errorCode int) {
+	status := "success"
+	if errorCode != 0 {
+		status = "failure"
+	}
+	EmitProgressEvent(ProgressEvent{Event: EVENT_END, Status: status})
+}
+
+/*
+ * gpbackup_helper writes the number of tables and bytes it has processed so
+ * far to a progress file on its segment, as "<tables> <bytes>", which is read
+ * here and reported as a segment_progress event whenever it changes.
+ */
+func ParseSegmentProgress(output string) (int64, int64, error) {
+	fields := strings.Fields(output)
+	if len(fields) != 2 {
+		return 0, 0, errors.Errorf("Invalid segment progress %q", output)
+	}
+	tables, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	bytes, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return tables, bytes, nil
+}
+
+func FormatSegmentProgress(tables int64, bytes int64) string {
+	return fmt.Sprintf("%d %d\n", tables, bytes)
+}
+
+func emitSegmentProgress(c *cluster.Cluster, fpInfo backup_filepath.FilePathInfo, lastProgress map[int]string) {
+	remoteOutput := c.GenerateAndExecuteCommand("Reading gpbackup_helper progress on segments", func(contentID int) string {
+		return fmt.Sprintf("cat %s 2>/dev/null || true", fpInfo.GetSegmentHelperFilePath(contentID, "progress"))
+	}, cluster.ON_SEGMENTS)
+	for contentID := range remoteOutput.Stdouts {
+		output := strings.TrimSpace(remoteOutput.Stdouts[contentID])
+		if output == "" || output == lastProgress[contentID] {
+			continue
+		}
+		tables, bytes, err := ParseSegmentProgress(output)
+		if err != nil {
+			continue
+		}
+		lastProgress[contentID] = output
+		segment := contentID
+		EmitProgressEvent(ProgressEvent{Event: EVENT_SEGMENT_PROGRESS, Segment: &segment, Tables: &tables, Bytes: &bytes})
+	}
+}
+
+/*
+ * Polls the gpbackup_helper progress files until the returned function is
+ * called, which reads them one last time so the final progress is reported.
+ */
+func StartSegmentProgressPolling(c *cluster.Cluster, fpInfo backup_filepath.FilePathInfo) func() {
+	if !IsProgressFileEnabled() {
+		return func() {}
+	}
+	lastProgress := make(map[int]string, 0)
+	done := make(chan bool)
+	finished := make(chan bool)
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(segmentProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				emitSegmentProgress(c, fpInfo, lastProgress)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+		emitSegmentProgress(c, fpInfo, lastProgress)
+	}
+}
@@ -0,0 +1,91 @@
+package utils_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/progress_events tests", func() {
+	var filename string
+	readEvents := func() []map[string]interface{} {
+		contents, _ := ioutil.ReadFile(filename)
+		events := make([]map[string]interface{}, 0)
+		for _, line := range strings.Split(strings.TrimSpace(string(contents)), "\n") {
+			if line == "" {
+				continue
+			}
+			event := make(map[string]interface{})
+			Expect(json.Unmarshal([]byte(line), &event)).To(Succeed())
+			events = append(events, event)
+		}
+		return events
+	}
+	BeforeEach(func() {
+		file, _ := ioutil.TempFile("", "progress")
+		_ = file.Close()
+		filename = file.Name()
+	})
+	AfterEach(func() {
+		utils.CloseProgressFile()
+		_ = os.Remove(filename)
+	})
+	Describe("EmitProgressEvent", func() {
+		It("writes one JSON object per event", func() {
+			Expect(utils.InitializeProgressFile(filename, "gpbackup", "20170101010101")).To(Succeed())
+			utils.EmitPhaseStart("data")
+			utils.EmitTableFinish("public.foo", 1, 0, 8192)
+			utils.EmitEnd(0)
+			utils.CloseProgressFile()
+
+			events := readEvents()
+			Expect(events).To(HaveLen(3))
+			Expect(events[0]["program"]).To(Equal("gpbackup"))
+			Expect(events[0]["timestamp"]).To(Equal("20170101010101"))
+			Expect(events[0]["event"]).To(Equal("phase_start"))
+			Expect(events[0]["phase"]).To(Equal("data"))
+			Expect(events[0]).ToNot(HaveKey("rows"))
+			Expect(events[1]["event"]).To(Equal("table_finish"))
+			Expect(events[1]["table"]).To(Equal("public.foo"))
+			Expect(events[1]["rows"]).To(Equal(float64(0)))
+			Expect(events[1]["bytes"]).To(Equal(float64(8192)))
+			Expect(events[2]["event"]).To(Equal("end"))
+			Expect(events[2]["status"]).To(Equal("success"))
+		})
+		It("appends to an existing file", func() {
+			_ = ioutil.WriteFile(filename, []byte(`{"event":"end"}`+"\n"), 0644)
+			Expect(utils.InitializeProgressFile(filename, "gprestore", "20170101010101")).To(Succeed())
+			utils.EmitError("public.foo", "some error")
+			utils.CloseProgressFile()
+
+			events := readEvents()
+			Expect(events).To(HaveLen(2))
+			Expect(events[1]["event"]).To(Equal("error"))
+			Expect(events[1]["message"]).To(Equal("some error"))
+		})
+		It("does nothing when no progress file is given", func() {
+			Expect(utils.InitializeProgressFile("", "gpbackup", "20170101010101")).To(Succeed())
+			Expect(utils.IsProgressFileEnabled()).To(BeFalse())
+			utils.EmitPhaseStart("data")
+			Expect(readEvents()).To(BeEmpty())
+		})
+	})
+	Describe("ParseSegmentProgress", func() {
+		It("parses the tables and bytes written by gpbackup_helper", func() {
+			tables, bytes, err := utils.ParseSegmentProgress(utils.FormatSegmentProgress(3, 4096))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tables).To(Equal(int64(3)))
+			Expect(bytes).To(Equal(int64(4096)))
+		})
+		It("returns an error for malformed progress", func() {
+			_, _, err := utils.ParseSegmentProgress("3")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
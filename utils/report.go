@@ -104,9 +104,13 @@ func (report *Report) constructIncrementalSection() string {
 	for _, restorePlanEntry := range report.RestorePlan {
 		backupTimestamps = append(backupTimestamps, restorePlanEntry.Timestamp)
 	}
+	differentialStr := ""
+	if report.Differential {
+		differentialStr = "Differential: True\n"
+	}
 	return fmt.Sprintf(`Incremental: True
-Incremental Backup Set:
-%s`, strings.Join(backupTimestamps, "\n"))
+%sIncremental Backup Set:
+%s`, differentialStr, strings.Join(backupTimestamps, "\n"))
 }
 
 func (report *Report) WriteBackupReportFile(reportFilename string, timestamp string, objectCounts map[string]int, errMsg string) {
@@ -157,7 +161,22 @@ Backup Status: %s
 	_ = operating.System.Chmod(reportFilename, 0444)
 }
 
-func WriteRestoreReportFile(reportFilename string, backupTimestamp string, startTimestamp string, connectionPool *dbconn.DBConn, restoreVersion string, errMsg string) {
+/*
+ * For a restore of an incremental backup, this records the backup in the
+ * restore plan that each table's data was restored from and the table
+ * changes recorded by each backup in the restore plan, keyed by timestamp.
+ */
+type RestoreDataSources struct {
+	Tables  []TableDataSource
+	Changes map[string][]TableChange
+}
+
+type TableDataSource struct {
+	Table     string
+	Timestamp string
+}
+
+func WriteRestoreReportFile(reportFilename string, backupTimestamp string, startTimestamp string, connectionPool *dbconn.DBConn, restoreVersion string, errMsg string, dataSources *RestoreDataSources) {
 	reportFile, err := iohelper.OpenFileForWriting(reportFilename)
 	if err != nil {
 		gplog.Error("Unable to open restore report file %s", reportFilename)
@@ -192,6 +211,9 @@ Restore Status: %s`
 		backupTimestamp, connectionPool.Version.VersionString, restoreVersion,
 		connectionPool.DBName, gprestoreCommandLine,
 		start, end, duration, restoreStatus)
+	if err == nil && dataSources != nil {
+		_, err = fmt.Fprint(reportFile, dataSources.String())
+	}
 	if err != nil {
 		gplog.Error("Unable to write restore report file %s", reportFilename)
 		return
@@ -200,6 +222,41 @@ Restore Status: %s`
 	_ = operating.System.Chmod(reportFilename, 0444)
 }
 
+func (dataSources *RestoreDataSources) String() string {
+	lines := make([]string, 0)
+	if len(dataSources.Tables) > 0 {
+		tableWidth := 0
+		for _, source := range dataSources.Tables {
+			if len(source.Table) > tableWidth {
+				tableWidth = len(source.Table)
+			}
+		}
+		lines = append(lines, "", "Table Data Restored From:")
+		for _, source := range dataSources.Tables {
+			lines = append(lines, fmt.Sprintf("%-*s  %s", tableWidth, source.Table, source.Timestamp))
+		}
+	}
+	timestamps := make([]string, 0, len(dataSources.Changes))
+	for timestamp, changes := range dataSources.Changes {
+		if len(changes) > 0 {
+			timestamps = append(timestamps, timestamp)
+		}
+	}
+	if len(timestamps) > 0 {
+		sort.Strings(timestamps)
+		lines = append(lines, "", "Table Changes Recorded by Incremental Backups:")
+		for _, timestamp := range timestamps {
+			for _, change := range dataSources.Changes[timestamp] {
+				lines = append(lines, fmt.Sprintf("%s: %s", timestamp, change))
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "\n" + strings.Join(lines, "\n")
+}
+
 func GetDurationInfo(timestamp string, endTime time.Time) (string, string, string) {
 	startTime, _ := time.ParseInLocation("20060102150405", timestamp, operating.System.Local)
 	duration := reformatDuration(endTime.Sub(startTime))
@@ -186,7 +186,7 @@ types                        1000`))
 
 		It("writes a report for a failed restore", func() {
 			gplog.SetErrorCode(2)
-			utils.WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "Cannot access /tmp/backups: Permission denied")
+			utils.WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "Cannot access /tmp/backups: Permission denied", nil)
 			Expect(buffer).To(gbytes.Say(`Greenplum Database Restore Report
 
 Timestamp Key: 20170101010101
@@ -205,7 +205,7 @@ Restore Error: Cannot access /tmp/backups: Permission denied`))
 		})
 		It("writes a report for a successful restore", func() {
 			gplog.SetErrorCode(0)
-			utils.WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "")
+			utils.WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", nil)
 			Expect(buffer).To(gbytes.Say(`Greenplum Database Restore Report
 
 Timestamp Key: 20170101010101
@@ -223,7 +223,7 @@ Restore Status: Success`))
 		})
 		It("writes a report for a successful restore with errors", func() {
 			gplog.SetErrorCode(1)
-			utils.WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "")
+			utils.WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", nil)
 			Expect(buffer).To(gbytes.Say(`Greenplum Database Restore Report
 
 Timestamp Key: 20170101010101
@@ -239,13 +239,39 @@ Duration: 4:03:01
 
 Restore Status: Success but non-fatal errors occurred. See log file .+ for details.`))
 		})
+		It("writes the backup each table's data came from for an incremental restore", func() {
+			gplog.SetErrorCode(0)
+			dataSources := &utils.RestoreDataSources{
+				Tables: []utils.TableDataSource{
+					{Table: "public.foo", Timestamp: "20170101010101"},
+					{Table: "public.renamed", Timestamp: "20170101020202"},
+				},
+				Changes: map[string][]utils.TableChange{
+					"20170101010101": {},
+					"20170101020202": {
+						{Table: "public.renamed", PreviousName: "public.bar", Change: utils.TABLE_RENAMED},
+						{Table: "public.baz", Change: utils.TABLE_DROPPED},
+					},
+				},
+			}
+			utils.WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", dataSources)
+			Expect(buffer).To(gbytes.Say(`Restore Status: Success
+
+Table Data Restored From:
+public.foo      20170101010101
+public.renamed  20170101020202
+
+Table Changes Recorded by Incremental Backups:
+20170101020202: public.renamed was renamed from public.bar
+20170101020202: public.baz was dropped`))
+		})
 	})
 	Describe("SetBackupParamFromFlags", func() {
 		AfterEach(func() {
-			utils.InitializePipeThroughParameters(false, 0)
+			utils.InitializePipeThroughParameters(false, "", 0, false)
 		})
 		It("configures the Report struct correctly", func() {
-			utils.InitializePipeThroughParameters(true, 0)
+			utils.InitializePipeThroughParameters(true, "gzip", 0, false)
 			backupCmdFlags := pflag.NewFlagSet("gpbackup", pflag.ExitOnError)
 			backup.SetFlagDefaults(backupCmdFlags)
 			backup.SetCmdFlags(backupCmdFlags)
@@ -263,6 +289,7 @@ Restore Status: Success but non-fatal errors occurred. See log file .+ for detai
 			structmatcher.ExpectStructsToMatch(backup_history.BackupConfig{
 				BackupVersion:        "0.1.0",
 				Compressed:           true,
+				CompressionType:      "gzip",
 				DatabaseName:         "testdb",
 				DatabaseVersion:      "5.0.0 build test",
 				IncludeSchemas:       []string{},
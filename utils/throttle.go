@@ -0,0 +1,197 @@
+package utils
+
+/*
+ * This file contains functions for limiting the bandwidth used to read and
+ * write backup files with --max-bandwidth and --max-host-bandwidth.
+ */
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/pkg/errors"
+)
+
+var (
+	// The bandwidth, in bytes per second, allowed for each segment
+	segmentBandwidth int64
+	// The number of streams over which each segment's bandwidth is shared
+	numBandwidthStreams int
+
+	bandwidthRegex = regexp.MustCompile(`^(\d+)([KMG]B?)?$`)
+	bandwidthUnits = map[string]int64{"": 1, "K": 1 << 10, "M": 1 << 20, "G": 1 << 30}
+)
+
+/*
+ * Bandwidths are given in bytes per second, with an optional K, M, or G
+ * suffix (with or without a trailing B) for powers of 1024.
+ */
+func ParseBandwidth(bandwidth string) (int64, error) {
+	if bandwidth == "" {
+		return 0, nil
+	}
+	matches := bandwidthRegex.FindStringSubmatch(strings.ToUpper(bandwidth))
+	if matches == nil {
+		return 0, errors.Errorf("Bandwidth %s is invalid.  Bandwidths must be a number of bytes per second, optionally followed by K, M, or G.", bandwidth)
+	}
+	value, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil || value == 0 {
+		return 0, errors.Errorf("Bandwidth %s is invalid.  Bandwidths must be a positive number of bytes per second.", bandwidth)
+	}
+	return value * bandwidthUnits[strings.TrimSuffix(matches[2], "B")], nil
+}
+
+/*
+ * A host's bandwidth is shared evenly among its primary segments.  As every
+ * segment runs the same COPY command, the host with the most segments sets the
+ * limit for all of them.
+ */
+func GetSegmentBandwidth(c *cluster.Cluster, maxSegmentBandwidth int64, maxHostBandwidth int64) int64 {
+	bandwidth := maxSegmentBandwidth
+	if maxHostBandwidth > 0 {
+		segmentsPerHost := make(map[string]int64, 0)
+		var maxSegmentsPerHost int64 = 1
+		for _, contentID := range c.ContentIDs {
+			if contentID == -1 {
+				continue
+			}
+			host := c.GetHostForContent(contentID)
+			segmentsPerHost[host]++
+			if segmentsPerHost[host] > maxSegmentsPerHost {
+				maxSegmentsPerHost = segmentsPerHost[host]
+			}
+		}
+		hostShare := maxHostBandwidth / maxSegmentsPerHost
+		if hostShare < 1 {
+			hostShare = 1
+		}
+		if bandwidth == 0 || hostShare < bandwidth {
+			bandwidth = hostShare
+		}
+	}
+	return bandwidth
+}
+
+func InitializeBandwidthLimits(c *cluster.Cluster, maxBandwidth string, maxHostBandwidth string, numStreams int) error {
+	maxSegmentBandwidth, err := ParseBandwidth(maxBandwidth)
+	if err != nil {
+		return err
+	}
+	maxHostBandwidthBytes, err := ParseBandwidth(maxHostBandwidth)
+	if err != nil {
+		return err
+	}
+	InitializeThrottling(GetSegmentBandwidth(c, maxSegmentBandwidth, maxHostBandwidthBytes), numStreams)
+	return nil
+}
+
+/*
+ * With one data file per table, each of the numStreams connections runs its
+ * own COPY on every segment, so the segment's bandwidth is split among them.
+ */
+func InitializeThrottling(bandwidth int64, numStreams int) {
+	segmentBandwidth = bandwidth
+	numBandwidthStreams = numStreams
+	if numBandwidthStreams < 1 {
+		numBandwidthStreams = 1
+	}
+}
+
+func IsThrottlingEnabled() bool {
+	return segmentBandwidth > 0
+}
+
+// The bandwidth for the single gpbackup_helper agent on each segment
+func GetSegmentBandwidthLimit() int64 {
+	return segmentBandwidth
+}
+
+// The bandwidth for each COPY command on each segment
+func GetStreamBandwidthLimit() int64 {
+	streamBandwidth := segmentBandwidth / int64(numBandwidthStreams)
+	if segmentBandwidth > 0 && streamBandwidth < 1 {
+		streamBandwidth = 1
+	}
+	return streamBandwidth
+}
+
+func getBandwidthString(bandwidth int64) string {
+	if bandwidth <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" --max-bandwidth %d", bandwidth)
+}
+
+/*
+ * Streaming bandwidth limits
+ */
+
+/*
+ * The limiter sleeps whenever more bytes have passed through it than the
+ * bandwidth allows for the time elapsed.  At most one second of unused
+ * bandwidth is saved up, so a stream that stalls, for instance while waiting
+ * for the next pipe to be opened, does not burst far above the limit after.
+ */
+type bandwidthLimiter struct {
+	bytesPerSecond int64
+	start          time.Time
+	bytes          int64
+}
+
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	return &bandwidthLimiter{bytesPerSecond: bytesPerSecond, start: time.Now()}
+}
+
+func (limiter *bandwidthLimiter) wait(numBytes int) {
+	limiter.bytes += int64(numBytes)
+	expected := time.Duration(float64(limiter.bytes) / float64(limiter.bytesPerSecond) * float64(time.Second))
+	elapsed := time.Since(limiter.start)
+	if expected > elapsed {
+		time.Sleep(expected - elapsed)
+	} else if elapsed-expected > time.Second {
+		limiter.start = time.Now().Add(-expected - time.Second)
+	}
+}
+
+type throttledWriter struct {
+	writer  io.Writer
+	limiter *bandwidthLimiter
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.limiter.wait(n)
+	return n, err
+}
+
+type throttledReader struct {
+	reader  io.Reader
+	limiter *bandwidthLimiter
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.limiter.wait(n)
+	return n, err
+}
+
+// A bandwidth of 0 leaves the writer unthrottled
+func NewThrottledWriter(writer io.Writer, bytesPerSecond int64) io.Writer {
+	if bytesPerSecond <= 0 {
+		return writer
+	}
+	return &throttledWriter{writer: writer, limiter: newBandwidthLimiter(bytesPerSecond)}
+}
+
+// A bandwidth of 0 leaves the reader unthrottled
+func NewThrottledReader(reader io.Reader, bytesPerSecond int64) io.Reader {
+	if bytesPerSecond <= 0 {
+		return reader
+	}
+	return &throttledReader{reader: reader, limiter: newBandwidthLimiter(bytesPerSecond)}
+}
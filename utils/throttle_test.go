@@ -0,0 +1,98 @@
+package utils_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/throttle tests", func() {
+	AfterEach(func() {
+		utils.InitializeThrottling(0, 1)
+		operating.System = operating.InitializeSystemFunctions()
+	})
+	Describe("ParseBandwidth", func() {
+		It("parses a number of bytes per second", func() {
+			Expect(utils.ParseBandwidth("1000")).To(Equal(int64(1000)))
+		})
+		It("parses bandwidths with unit suffixes", func() {
+			Expect(utils.ParseBandwidth("10K")).To(Equal(int64(10 * 1024)))
+			Expect(utils.ParseBandwidth("10kb")).To(Equal(int64(10 * 1024)))
+			Expect(utils.ParseBandwidth("50MB")).To(Equal(int64(50 * 1024 * 1024)))
+			Expect(utils.ParseBandwidth("2G")).To(Equal(int64(2 * 1024 * 1024 * 1024)))
+		})
+		It("returns 0 when no bandwidth is given", func() {
+			Expect(utils.ParseBandwidth("")).To(Equal(int64(0)))
+		})
+		It("returns an error for an invalid bandwidth", func() {
+			_, err := utils.ParseBandwidth("fast")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Bandwidth fast is invalid.  Bandwidths must be a number of bytes per second, optionally followed by K, M, or G."))
+		})
+		It("returns an error for a bandwidth of 0", func() {
+			_, err := utils.ParseBandwidth("0M")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Describe("GetSegmentBandwidth", func() {
+		testCluster := testutils.SetDefaultSegmentConfiguration()
+		It("uses the segment bandwidth when no host bandwidth is given", func() {
+			Expect(utils.GetSegmentBandwidth(testCluster, 1000, 0)).To(Equal(int64(1000)))
+		})
+		It("shares the host bandwidth among the segments on the host", func() {
+			Expect(utils.GetSegmentBandwidth(testCluster, 0, 1000)).To(Equal(int64(500)))
+		})
+		It("uses the lower of the segment bandwidth and the host share", func() {
+			Expect(utils.GetSegmentBandwidth(testCluster, 400, 1000)).To(Equal(int64(400)))
+			Expect(utils.GetSegmentBandwidth(testCluster, 600, 1000)).To(Equal(int64(500)))
+		})
+	})
+	Describe("GetStreamBandwidthLimit", func() {
+		It("splits the segment bandwidth among the streams", func() {
+			utils.InitializeThrottling(1000, 4)
+			Expect(utils.GetSegmentBandwidthLimit()).To(Equal(int64(1000)))
+			Expect(utils.GetStreamBandwidthLimit()).To(Equal(int64(250)))
+		})
+	})
+	Describe("NewThrottledWriter and NewThrottledReader", func() {
+		It("limits the rate at which data is written", func() {
+			start := time.Now()
+			writer := utils.NewThrottledWriter(ioutil.Discard, 100*1024)
+			_, err := writer.Write(make([]byte, 50*1024))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(time.Since(start)).To(BeNumerically(">=", 450*time.Millisecond))
+		})
+		It("limits the rate at which data is read", func() {
+			start := time.Now()
+			reader := utils.NewThrottledReader(bytes.NewReader(make([]byte, 50*1024)), 100*1024)
+			data, err := ioutil.ReadAll(reader)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(HaveLen(50 * 1024))
+			Expect(time.Since(start)).To(BeNumerically(">=", 450*time.Millisecond))
+		})
+		It("does not wrap the writer when there is no limit", func() {
+			var buffer bytes.Buffer
+			Expect(utils.NewThrottledWriter(&buffer, 0)).To(Equal(&buffer))
+		})
+	})
+	Describe("InitializePipeThroughParameters", func() {
+		It("pipes data through gpbackup_helper when throttling is enabled", func() {
+			originalProgram := utils.GetPipeThroughProgram()
+			defer utils.SetPipeThroughProgram(originalProgram)
+			operating.System.Getenv = func(key string) string { return "/usr/local/gpdb" }
+			utils.InitializeThrottling(1000, 2)
+			utils.InitializePipeThroughParameters(true, "zstd", 3, false)
+			resultProgram := utils.GetPipeThroughProgram()
+			Expect(resultProgram.OutputCommand).To(Equal("/usr/local/gpdb/bin/gpbackup_helper --compress --max-bandwidth 500 --compression-type zstd --compression-level 3"))
+			Expect(resultProgram.InputCommand).To(Equal("/usr/local/gpdb/bin/gpbackup_helper --decompress --max-bandwidth 500 --compression-type zstd"))
+			Expect(resultProgram.Extension).To(Equal(".zst"))
+		})
+	})
+})
@@ -3,8 +3,13 @@ package utils
 import (
 	"fmt"
 	"io"
+	"os"
 	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
 	"github.com/greenplum-db/gp-common-go-libs/operating"
@@ -19,10 +24,15 @@ type TOC struct {
 	StatisticsEntries   []MetadataEntry
 	DataEntries         []MasterDataEntry
 	IncrementalMetadata IncrementalEntries
+	MetadataChecksum    string
+	StatisticsChecksum  string
+	SegmentConfig       []cluster.SegConfig
+	SegmentTOCChecksums map[int]string `yaml:",omitempty"`
 }
 
 type SegmentTOC struct {
 	DataEntries map[uint]SegmentDataEntry
+	Checksum    string
 }
 
 type MetadataEntry struct {
@@ -41,15 +51,25 @@ type MasterDataEntry struct {
 	AttributeString string
 	RowsCopied      int64
 	PartitionRoot   string
+	Checksums       map[int]string
+	Size            int64
 }
 
+/*
+ * For single-data-file backups, the checksum covers the uncompressed bytes
+ * between StartByte and EndByte, as that is the range the helper streams.
+ */
 type SegmentDataEntry struct {
 	StartByte uint64
 	EndByte   uint64
+	Checksum  string
 }
 
 type IncrementalEntries struct {
-	AO map[string]AOEntry
+	AO      map[string]AOEntry
+	Heap    map[string]HeapEntry     `yaml:",omitempty"`
+	Tables  map[string]TableIdentity `yaml:",omitempty"`
+	Changes []TableChange            `yaml:",omitempty"`
 }
 
 type AOEntry struct {
@@ -57,10 +77,53 @@ type AOEntry struct {
 	LastDDLTimestamp string
 }
 
+type HeapEntry struct {
+	Fingerprint      string
+	LastDDLTimestamp string
+}
+
+/*
+ * A table keeps its oid when it is renamed and gets a new one when it is
+ * dropped and recreated, while its relfilenode changes whenever its data is
+ * rewritten, so together they identify a table independently of its name.
+ */
+type TableIdentity struct {
+	Oid         uint32
+	RelFileNode uint32
+}
+
+const (
+	TABLE_RENAMED   = "renamed"
+	TABLE_DROPPED   = "dropped"
+	TABLE_RECREATED = "recreated"
+	TABLE_REWRITTEN = "rewritten"
+)
+
+/*
+ * A change to a table since the backup an incremental backup is based on.
+ * PreviousName is only set for renamed tables.
+ */
+type TableChange struct {
+	Table        string
+	PreviousName string `yaml:",omitempty"`
+	Change       string
+}
+
+func (change TableChange) String() string {
+	if change.Change == TABLE_RENAMED {
+		return fmt.Sprintf("%s was renamed from %s", change.Table, change.PreviousName)
+	}
+	return fmt.Sprintf("%s was %s", change.Table, change.Change)
+}
+
 func NewTOC(filename string) *TOC {
 	toc := &TOC{}
 	contents, err := operating.System.ReadFile(filename)
 	gplog.FatalOnError(err)
+	contents, err = DecryptIfEncrypted(contents)
+	if err != nil {
+		gplog.Fatal(err, fmt.Sprintf("Unable to read table of contents file %s", filename))
+	}
 	err = yaml.Unmarshal(contents, toc)
 	gplog.FatalOnError(err)
 	return toc
@@ -79,27 +142,47 @@ func (toc *TOC) WriteToFileAndMakeReadOnly(filename string) {
 	tocFile := iohelper.MustOpenFileForWriting(filename)
 	tocContents, err := yaml.Marshal(toc)
 	gplog.FatalOnError(err)
+	tocContents, err = EncryptIfEnabled(tocContents)
+	gplog.FatalOnError(err)
 	MustPrintBytes(tocFile, tocContents)
 	err = operating.System.Chmod(filename, 0444)
 	gplog.FatalOnError(err)
 }
 
 //This function return an error rather than Fataling because it is called by the helper
+/*
+ * The TOC is written to a temporary file and renamed into place, as gpbackup
+ * takes the checksum of the TOC as soon as the file appears.
+ */
 func (toc *SegmentTOC) WriteToFileAndMakeReadOnly(filename string) error {
-	tocFile, err := iohelper.OpenFileForWriting(filename)
+	tocContents, err := yaml.Marshal(toc)
 	if err != nil {
 		return err
 	}
-	tocContents, err := yaml.Marshal(toc)
+	tempFilename := fmt.Sprintf("%s.%d.tmp", filename, os.Getpid())
+	tempFile, err := os.OpenFile(tempFilename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tempFilename)
+	}()
+	_, err = tempFile.Write(tocContents)
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
 	if err != nil {
 		return err
 	}
-	_, err = tocFile.Write(tocContents)
+	err = operating.System.Chmod(tempFilename, 0444)
 	if err != nil {
 		return err
 	}
-	err = operating.System.Chmod(filename, 0444)
-	return err
+	return os.Rename(tempFilename, filename)
 }
 
 type StatementWithType struct {
@@ -243,6 +326,280 @@ func SubstituteRedirectDatabaseInStatements(statements []StatementWithType, oldQ
 	return statements
 }
 
+/*
+ * Only the names of objects in the backup are rewritten: an object in a
+ * redirected schema is moved to its target schema, along with the references
+ * to it by schema-qualified name in the statements of other objects.  The
+ * names are those returned by GetRedirectedObjectNames for the whole backup,
+ * as objects refer to objects restored in other sections.  References in
+ * string literals, such as the 'schema.table'::regclass casts in sequence
+ * defaults and statistics, are rewritten too, but text that merely looks like
+ * a qualified name, such as in function bodies or comments, is left alone
+ * unless it names one of those objects.  Tuple statistics identify the schema
+ * by its oid in the backed-up database, so they look up the target schema by
+ * name instead.
+ *
+ * The statements for a redirected schema itself are replaced with one
+ * statement creating each target schema if it does not exist.  CREATE SCHEMA
+ * IF NOT EXISTS is only available in GPDB 6 and later, so earlier versions use
+ * CREATE SCHEMA, which RestoreSchemas allows to fail if the schema exists.
+ */
+func SubstituteRedirectSchemasInStatements(statements []StatementWithType, schemaMap map[string]string, redirectedNames map[string]bool, createIfNotExists bool) []StatementWithType {
+	if len(schemaMap) == 0 {
+		return statements
+	}
+	sourceSchemas := make([]string, 0, len(schemaMap))
+	for sourceSchema := range schemaMap {
+		sourceSchemas = append(sourceSchemas, regexp.QuoteMeta(sourceSchema))
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(sourceSchemas)))
+	pattern := regexp.MustCompile(fmt.Sprintf(`(^|[^\w"$.\x{80}-\x{10FFFF}])(%s)\.("(?:[^"]|"")+"|(?:[\w$]|[^\x00-\x7F])+)`, strings.Join(sourceSchemas, "|")))
+	namespacePattern := regexp.MustCompile(`(?m)^AND relnamespace = \d+;`)
+	createSchemaFormat := "\n\nCREATE SCHEMA %s;\n"
+	if createIfNotExists {
+		createSchemaFormat = "\n\nCREATE SCHEMA IF NOT EXISTS %s;\n"
+	}
+
+	newStatements := make([]StatementWithType, 0, len(statements))
+	createdSchemas := make(map[string]bool)
+	for _, statement := range statements {
+		targetSchema, isRedirected := schemaMap[statement.Schema]
+		if statement.ObjectType == "SCHEMA" && isRedirected {
+			// The public schema always exists, so it is never created
+			if !createdSchemas[targetSchema] && targetSchema != "public" {
+				createdSchemas[targetSchema] = true
+				newStatements = append(newStatements, StatementWithType{Schema: targetSchema, Name: targetSchema,
+					ObjectType: "SCHEMA", Statement: fmt.Sprintf(createSchemaFormat, targetSchema)})
+			}
+			continue
+		}
+		if statement.Schema == "" {
+			newStatements = append(newStatements, statement)
+			continue
+		}
+		statement.Statement = pattern.ReplaceAllStringFunc(statement.Statement, func(match string) string {
+			submatches := pattern.FindStringSubmatch(match)
+			if !redirectedNames[MakeFQN(submatches[2], submatches[3])] {
+				return match
+			}
+			return submatches[1] + MakeFQN(schemaMap[submatches[2]], submatches[3])
+		})
+		statement.ReferenceObject = RedirectSchemaForFQN(statement.ReferenceObject, schemaMap)
+		if isRedirected {
+			statement.Schema = targetSchema
+			if statement.ObjectType == "STATISTICS" {
+				statement.Statement = namespacePattern.ReplaceAllString(statement.Statement,
+					fmt.Sprintf("AND relnamespace = (SELECT oid FROM pg_namespace WHERE nspname = '%s');", EscapeSingleQuotes(UnquoteIdent(targetSchema))))
+			}
+		}
+		newStatements = append(newStatements, statement)
+	}
+	return newStatements
+}
+
+/*
+ * Returns the schema-qualified names of the objects in the redirected schemas,
+ * including the relations that indexes, constraints, and triggers belong to,
+ * for SubstituteRedirectSchemasInStatements.  Functions and aggregates are
+ * recorded with their arguments, which references to them do not include.
+ */
+func GetRedirectedObjectNames(entries []MetadataEntry, schemaMap map[string]string) map[string]bool {
+	redirectedNames := make(map[string]bool)
+	for _, entry := range entries {
+		if _, isRedirected := schemaMap[entry.Schema]; isRedirected && entry.ObjectType != "SCHEMA" {
+			name := strings.SplitN(entry.Name, "(", 2)[0]
+			redirectedNames[MakeFQN(entry.Schema, name)] = true
+		}
+		if referenceSchema, _ := SplitFQN(entry.ReferenceObject); entry.ReferenceObject != "" && schemaMap[referenceSchema] != "" {
+			redirectedNames[entry.ReferenceObject] = true
+		}
+	}
+	return redirectedNames
+}
+
+/*
+ * Returns the name a table is restored to, given its schema-qualified name in
+ * the backup.
+ */
+func RedirectSchemaForFQN(tableFQN string, schemaMap map[string]string) string {
+	for sourceSchema, targetSchema := range schemaMap {
+		if strings.HasPrefix(tableFQN, sourceSchema+".") {
+			return targetSchema + tableFQN[len(sourceSchema):]
+		}
+	}
+	return tableFQN
+}
+
+/*
+ * Relations in schemas that are redirected to the same schema, or to a schema
+ * that is itself restored, cannot share a name, as only one of them could be
+ * restored.  Returns a description of each name that would be shared.
+ */
+func FindRedirectSchemaConflicts(relationFQNs []string, schemaMap map[string]string) []string {
+	targetFQNs := make([]string, 0)
+	sourcesByTarget := make(map[string][]string)
+	seenSources := make(map[string]bool)
+	for _, sourceFQN := range relationFQNs {
+		if seenSources[sourceFQN] {
+			continue
+		}
+		seenSources[sourceFQN] = true
+		targetFQN := RedirectSchemaForFQN(sourceFQN, schemaMap)
+		if _, ok := sourcesByTarget[targetFQN]; !ok {
+			targetFQNs = append(targetFQNs, targetFQN)
+		}
+		sourcesByTarget[targetFQN] = append(sourcesByTarget[targetFQN], sourceFQN)
+	}
+	conflicts := make([]string, 0)
+	for _, targetFQN := range targetFQNs {
+		if sources := sourcesByTarget[targetFQN]; len(sources) > 1 {
+			conflicts = append(conflicts, fmt.Sprintf("%s would all be restored as %s", strings.Join(sources, ", "), targetFQN))
+		}
+	}
+	return conflicts
+}
+
+/*
+ * Restores a table under a new name by rewriting the statements for the table
+ * itself, its statistics, and the constraints, indexes, triggers, and rules
+ * that belong to it.  Other statements that refer to the table, such as views
+ * and foreign keys on other tables, keep referring to the original table.
+ * Index and constraint names are unique within a schema, so that the table
+ * can be restored next to the original, every index, constraint, and trigger
+ * of the table is renamed after the new table: a name that starts with the
+ * name of the table, as generated names do, starts with the new table name
+ * instead, and any other name is prefixed with the new table name.
+ */
+func SubstituteRedirectTablesInStatements(statements []StatementWithType, tableMap map[string]string) []StatementWithType {
+	if len(tableMap) == 0 {
+		return statements
+	}
+	dependentObjectTypes := map[string]bool{"CONSTRAINT": true, "INDEX": true, "RULE": true, "TRIGGER": true}
+	tupleStatisticsPattern := regexp.MustCompile(`(?m)^WHERE relname = '.*'\nAND relnamespace = \d+;`)
+	// Index and constraint names are reserved per schema, and trigger names per table
+	usedNames := make(map[string]bool)
+	for _, statement := range statements {
+		if statement.ObjectType == "CONSTRAINT" || statement.ObjectType == "INDEX" {
+			usedNames[MakeFQN(statement.Schema, UnquoteIdent(statement.Name))] = true
+		} else if statement.ObjectType == "TRIGGER" {
+			usedNames[MakeFQN(statement.ReferenceObject, UnquoteIdent(statement.Name))] = true
+		}
+	}
+	for i, statement := range statements {
+		sourceFQN := statement.ReferenceObject
+		if statement.ObjectType == "TABLE" || statement.ObjectType == "STATISTICS" {
+			sourceFQN = MakeFQN(statement.Schema, statement.Name)
+		} else if !dependentObjectTypes[statement.ObjectType] {
+			continue
+		}
+		targetFQN, isRedirected := tableMap[sourceFQN]
+		if !isRedirected {
+			continue
+		}
+		sourceSchema, sourceName := SplitFQN(sourceFQN)
+		targetSchema, targetName := SplitFQN(targetFQN)
+
+		if statement.ObjectType == "TABLE" || statement.ObjectType == "STATISTICS" {
+			statement.Schema, statement.Name = targetSchema, targetName
+		} else {
+			newName := statement.Name
+			if statement.ObjectType != "RULE" {
+				namespace := targetSchema
+				if statement.ObjectType == "TRIGGER" {
+					namespace = targetFQN
+				}
+				newName = getRedirectedDependentName(UnquoteIdent(statement.Name), UnquoteIdent(sourceName), UnquoteIdent(targetName), namespace, usedNames)
+			}
+			statement.Statement = replaceIdentifier(statement.Statement, MakeFQN(sourceSchema, statement.Name), MakeFQN(targetSchema, newName))
+			statement.Statement = replaceIdentifier(statement.Statement, sourceFQN, targetFQN)
+			statement.Statement = replaceIdentifier(statement.Statement, statement.Name, newName)
+			statement.Schema, statement.Name, statement.ReferenceObject = targetSchema, newName, targetFQN
+			statements[i] = statement
+			continue
+		}
+		statement.Statement = replaceIdentifier(statement.Statement, sourceFQN, targetFQN)
+		if statement.ObjectType == "STATISTICS" {
+			statement.Statement = tupleStatisticsPattern.ReplaceAllLiteralString(statement.Statement,
+				fmt.Sprintf("WHERE relname = '%s'\nAND relnamespace = (SELECT oid FROM pg_namespace WHERE nspname = '%s');",
+					EscapeSingleQuotes(UnquoteIdent(targetName)), EscapeSingleQuotes(UnquoteIdent(targetSchema))))
+		}
+		statements[i] = statement
+	}
+	return statements
+}
+
+/*
+ * Returns the quoted name of an index, constraint, or trigger of a redirected
+ * table, which is made unique within namespace by adding a number to it if
+ * needed.  Names are truncated to the 63 bytes that identifiers can hold.
+ */
+func getRedirectedDependentName(name string, sourceTableName string, targetTableName string, namespace string, usedNames map[string]bool) string {
+	baseName := targetTableName + "_" + name
+	if strings.HasPrefix(name, sourceTableName) {
+		baseName = targetTableName + strings.TrimPrefix(name, sourceTableName)
+	}
+	newName := truncateIdentifier(baseName, maxIdentifierLength)
+	for suffixNum := 1; usedNames[MakeFQN(namespace, newName)]; suffixNum++ {
+		suffix := fmt.Sprintf("_%d", suffixNum)
+		newName = truncateIdentifier(baseName, maxIdentifierLength-len(suffix)) + suffix
+	}
+	usedNames[MakeFQN(namespace, newName)] = true
+	return quoteIdentIfNeeded(newName)
+}
+
+const maxIdentifierLength = 63
+
+var unquotedIdentifierPattern = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+
+func truncateIdentifier(ident string, maxLength int) string {
+	if len(ident) <= maxLength {
+		return ident
+	}
+	ident = ident[:maxLength]
+	// Do not leave part of a multibyte character at the end
+	for len(ident) > 0 && !utf8.ValidString(ident) {
+		ident = ident[:len(ident)-1]
+	}
+	return ident
+}
+
+func quoteIdentIfNeeded(ident string) string {
+	if unquotedIdentifierPattern.MatchString(ident) {
+		return ident
+	}
+	return `"` + strings.Replace(ident, `"`, `""`, -1) + `"`
+}
+
+/*
+ * Replaces each occurrence of an identifier that is not part of a longer or
+ * differently qualified identifier.
+ */
+func replaceIdentifier(statement string, oldIdent string, newIdent string) string {
+	if oldIdent == newIdent {
+		return statement
+	}
+	isIdentifierChar := func(c byte) bool {
+		return c == '_' || c == '$' || c == '"' || c >= 0x80 ||
+			('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+	}
+	result := ""
+	for {
+		index := strings.Index(statement, oldIdent)
+		if index < 0 {
+			return result + statement
+		}
+		end := index + len(oldIdent)
+		startsIdentifier := index == 0 || !(isIdentifierChar(statement[index-1]) || statement[index-1] == '.')
+		endsIdentifier := end == len(statement) || !isIdentifierChar(statement[end])
+		if startsIdentifier && endsIdentifier {
+			result += statement[:index] + newIdent
+		} else {
+			result += statement[:end]
+		}
+		statement = statement[end:]
+	}
+}
+
 func RemoveActiveRole(activeUser string, statements []StatementWithType) []StatementWithType {
 	newStatements := make([]StatementWithType, 0)
 	for _, statement := range statements {
@@ -278,10 +635,26 @@ func (toc *TOC) AddMetadataEntry(section string, entry MetadataEntry, start, end
 }
 
 func (toc *TOC) AddMasterDataEntry(schema string, name string, oid uint32, attributeString string, rowsCopied int64, PartitionRoot string) {
-	toc.DataEntries = append(toc.DataEntries, MasterDataEntry{schema, name, oid, attributeString, rowsCopied, PartitionRoot})
+	toc.DataEntries = append(toc.DataEntries, MasterDataEntry{Schema: schema, Name: name, Oid: oid, AttributeString: attributeString, RowsCopied: rowsCopied, PartitionRoot: PartitionRoot})
+}
+
+func (toc *TOC) AddDataEntryChecksums(checksumMap map[uint32]map[int]string) {
+	for i, entry := range toc.DataEntries {
+		if checksums, ok := checksumMap[entry.Oid]; ok {
+			toc.DataEntries[i].Checksums = checksums
+		}
+	}
+}
+
+func (toc *TOC) AddDataEntrySizes(sizeMap map[uint32]int64) {
+	for i, entry := range toc.DataEntries {
+		if size, ok := sizeMap[entry.Oid]; ok {
+			toc.DataEntries[i].Size = size
+		}
+	}
 }
 
-func (toc *SegmentTOC) AddSegmentDataEntry(oid uint, startByte uint64, endByte uint64) {
+func (toc *SegmentTOC) AddSegmentDataEntry(oid uint, startByte uint64, endByte uint64, checksum string) {
 	// We use uint for oid since the flags package does not have a uint32 flag
-	toc.DataEntries[oid] = SegmentDataEntry{startByte, endByte}
+	toc.DataEntries[oid] = SegmentDataEntry{startByte, endByte, checksum}
 }
@@ -2,6 +2,7 @@ package utils_test
 
 import (
 	"bytes"
+	"strings"
 
 	"github.com/greenplum-db/gpbackup/testutils"
 	"github.com/greenplum-db/gpbackup/utils"
@@ -360,6 +361,204 @@ COMMENT ON DATABASE "db-special-chär$" IS 'this is a database comment';`}
 `))
 		})
 	})
+	Describe("SubstituteRedirectSchemasInStatements", func() {
+		schemaMap := map[string]string{"public": "sandbox", `"Other Schema"`: "sandbox", "sandbox": "archive"}
+		sequence := utils.MetadataEntry{Schema: "public", Name: "foo_i_seq", ObjectType: "SEQUENCE"}
+		tableEntry := utils.MetadataEntry{Schema: "public", Name: "foo", ObjectType: "TABLE"}
+		typeEntry := utils.MetadataEntry{Schema: `"Other Schema"`, Name: "mytype", ObjectType: "TYPE"}
+		functionEntry := utils.MetadataEntry{Schema: "public", Name: "audit(integer)", ObjectType: "FUNCTION"}
+		indexEntry := utils.MetadataEntry{Schema: "sandbox", Name: "bar_idx", ObjectType: "INDEX", ReferenceObject: "sandbox.bar"}
+		redirectedNames := utils.GetRedirectedObjectNames([]utils.MetadataEntry{sequence, tableEntry, typeEntry, functionEntry, indexEntry}, schemaMap)
+		It("rewrites the schema-qualified names of objects in the backup, including those in string literals", func() {
+			table := utils.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE",
+				Statement: "CREATE TABLE public.foo (\n\ti integer DEFAULT nextval('public.foo_i_seq'::regclass),\n\tj \"Other Schema\".mytype,\n\tk xpublic.mytype\n);"}
+			owner := utils.StatementWithType{Schema: "public", Name: "foo_i_seq", ObjectType: "SEQUENCE OWNER", ReferenceObject: "public.foo",
+				Statement: "ALTER SEQUENCE public.foo_i_seq OWNED BY public.foo.i;"}
+			index := utils.StatementWithType{Schema: "sandbox", Name: "bar_idx", ObjectType: "INDEX", ReferenceObject: "sandbox.bar",
+				Statement: "CREATE INDEX bar_idx ON sandbox.bar USING btree (i);"}
+			trigger := utils.StatementWithType{Schema: "unmapped", Name: "foo_trigger", ObjectType: "TRIGGER", ReferenceObject: "unmapped.foo",
+				Statement: "CREATE TRIGGER foo_trigger AFTER INSERT ON unmapped.foo FOR EACH ROW EXECUTE PROCEDURE public.audit();"}
+
+			statements := utils.SubstituteRedirectSchemasInStatements([]utils.StatementWithType{table, owner, index, trigger}, schemaMap, redirectedNames, true)
+
+			Expect(statements).To(Equal([]utils.StatementWithType{
+				{Schema: "sandbox", Name: "foo", ObjectType: "TABLE",
+					Statement: "CREATE TABLE sandbox.foo (\n\ti integer DEFAULT nextval('sandbox.foo_i_seq'::regclass),\n\tj sandbox.mytype,\n\tk xpublic.mytype\n);"},
+				{Schema: "sandbox", Name: "foo_i_seq", ObjectType: "SEQUENCE OWNER", ReferenceObject: "sandbox.foo",
+					Statement: "ALTER SEQUENCE sandbox.foo_i_seq OWNED BY sandbox.foo.i;"},
+				{Schema: "archive", Name: "bar_idx", ObjectType: "INDEX", ReferenceObject: "archive.bar",
+					Statement: "CREATE INDEX bar_idx ON archive.bar USING btree (i);"},
+				{Schema: "unmapped", Name: "foo_trigger", ObjectType: "TRIGGER", ReferenceObject: "unmapped.foo",
+					Statement: "CREATE TRIGGER foo_trigger AFTER INSERT ON unmapped.foo FOR EACH ROW EXECUTE PROCEDURE sandbox.audit();"},
+			}))
+		})
+		It("leaves text that is not the name of an object in the backup unchanged", func() {
+			function := utils.StatementWithType{Schema: "public", Name: "audit(integer)", ObjectType: "FUNCTION",
+				Statement: "CREATE FUNCTION public.audit(integer) RETURNS integer AS $$SELECT count(*) FROM public.log WHERE msg = 'see public.readme'$$ LANGUAGE sql;"}
+			comment := utils.StatementWithType{Schema: "unmapped", Name: "log", ObjectType: "TABLE",
+				Statement: "COMMENT ON TABLE unmapped.log IS 'copied from public.log';"}
+
+			statements := utils.SubstituteRedirectSchemasInStatements([]utils.StatementWithType{function, comment}, schemaMap, redirectedNames, true)
+
+			Expect(statements[0].Statement).To(Equal("CREATE FUNCTION sandbox.audit(integer) RETURNS integer AS $$SELECT count(*) FROM public.log WHERE msg = 'see public.readme'$$ LANGUAGE sql;"))
+			Expect(statements[1]).To(Equal(comment))
+		})
+		It("looks up the target schema by name in tuple statistics", func() {
+			statistics := utils.StatementWithType{Schema: "public", Name: "foo", ObjectType: "STATISTICS",
+				Statement: "UPDATE pg_class\nSET\n\trelpages = 1::int,\n\treltuples = 1.000000::real\nWHERE relname = 'foo'\nAND relnamespace = 2200;\n\nDELETE FROM pg_statistic WHERE starelid = 'public.foo'::regclass::oid AND staattnum = 1;"}
+
+			statements := utils.SubstituteRedirectSchemasInStatements([]utils.StatementWithType{statistics}, schemaMap, redirectedNames, true)
+
+			Expect(statements[0].Statement).To(Equal("UPDATE pg_class\nSET\n\trelpages = 1::int,\n\treltuples = 1.000000::real\nWHERE relname = 'foo'\nAND relnamespace = (SELECT oid FROM pg_namespace WHERE nspname = 'sandbox');\n\nDELETE FROM pg_statistic WHERE starelid = 'sandbox.foo'::regclass::oid AND staattnum = 1;"))
+		})
+		It("creates each target schema once, if it does not exist, in place of the redirected schemas", func() {
+			schemas := []utils.StatementWithType{
+				{Schema: "public", Name: "public", ObjectType: "SCHEMA", Statement: "\n\nCOMMENT ON SCHEMA public IS 'standard public schema';\n"},
+				{Schema: `"Other Schema"`, Name: `"Other Schema"`, ObjectType: "SCHEMA", Statement: "\n\nCREATE SCHEMA \"Other Schema\";\n"},
+				{Schema: "unmapped", Name: "unmapped", ObjectType: "SCHEMA", Statement: "\n\nCREATE SCHEMA unmapped;\n"},
+			}
+
+			statements := utils.SubstituteRedirectSchemasInStatements(schemas, schemaMap, redirectedNames, true)
+
+			Expect(statements).To(Equal([]utils.StatementWithType{
+				{Schema: "sandbox", Name: "sandbox", ObjectType: "SCHEMA", Statement: "\n\nCREATE SCHEMA IF NOT EXISTS sandbox;\n"},
+				{Schema: "unmapped", Name: "unmapped", ObjectType: "SCHEMA", Statement: "\n\nCREATE SCHEMA unmapped;\n"},
+			}))
+		})
+		It("creates target schemas without IF NOT EXISTS for versions that do not support it", func() {
+			schema := utils.StatementWithType{Schema: "public", Name: "public", ObjectType: "SCHEMA", Statement: "\n\nCOMMENT ON SCHEMA public IS 'standard public schema';\n"}
+
+			statements := utils.SubstituteRedirectSchemasInStatements([]utils.StatementWithType{schema}, schemaMap, redirectedNames, false)
+
+			Expect(statements[0].Statement).To(Equal("\n\nCREATE SCHEMA sandbox;\n"))
+		})
+		It("does not modify statements if no schemas are redirected", func() {
+			table := utils.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "CREATE TABLE public.foo (i int);"}
+
+			statements := utils.SubstituteRedirectSchemasInStatements([]utils.StatementWithType{table}, map[string]string{}, map[string]bool{}, true)
+
+			Expect(statements).To(Equal([]utils.StatementWithType{table}))
+		})
+	})
+	Describe("FindRedirectSchemaConflicts", func() {
+		It("reports relations in different schemas that would be restored with the same name", func() {
+			relationFQNs := []string{"public.foo", "sales.foo", "sales.bar", "archive.foo", "archive.baz"}
+
+			conflicts := utils.FindRedirectSchemaConflicts(relationFQNs, map[string]string{"public": "sandbox", "sales": "sandbox"})
+
+			Expect(conflicts).To(Equal([]string{"public.foo, sales.foo would all be restored as sandbox.foo"}))
+		})
+		It("reports a redirected relation with the same name as a relation restored to the target schema", func() {
+			conflicts := utils.FindRedirectSchemaConflicts([]string{"public.foo", "sales.foo"}, map[string]string{"public": "sales"})
+
+			Expect(conflicts).To(Equal([]string{"public.foo, sales.foo would all be restored as sales.foo"}))
+		})
+		It("reports no conflicts when every relation keeps a unique name", func() {
+			Expect(utils.FindRedirectSchemaConflicts([]string{"public.foo", "sales.bar"}, map[string]string{"public": "sandbox", "sales": "sandbox"})).To(BeEmpty())
+		})
+	})
+	Describe("SubstituteRedirectTablesInStatements", func() {
+		tableMap := map[string]string{"sales.orders": "sales.orders_restored", "sales.items": "sandbox.items"}
+		It("renames a table and the statements belonging to it", func() {
+			table := utils.StatementWithType{Schema: "sales", Name: "orders", ObjectType: "TABLE",
+				Statement: "CREATE TABLE sales.orders (\n\tid integer\n) DISTRIBUTED BY (id);\n\nCOMMENT ON COLUMN sales.orders.id IS 'order id';"}
+			trigger := utils.StatementWithType{Schema: "sales", Name: "orders_trigger", ObjectType: "TRIGGER", ReferenceObject: "sales.orders",
+				Statement: "CREATE TRIGGER orders_trigger AFTER INSERT ON sales.orders FOR EACH ROW EXECUTE PROCEDURE sales.orders_audit();"}
+			view := utils.StatementWithType{Schema: "sales", Name: "orders_view", ObjectType: "VIEW",
+				Statement: "CREATE VIEW sales.orders_view AS SELECT * FROM sales.orders;"}
+
+			statements := utils.SubstituteRedirectTablesInStatements([]utils.StatementWithType{table, trigger, view}, tableMap)
+
+			Expect(statements).To(Equal([]utils.StatementWithType{
+				{Schema: "sales", Name: "orders_restored", ObjectType: "TABLE",
+					Statement: "CREATE TABLE sales.orders_restored (\n\tid integer\n) DISTRIBUTED BY (id);\n\nCOMMENT ON COLUMN sales.orders_restored.id IS 'order id';"},
+				{Schema: "sales", Name: "orders_restored_trigger", ObjectType: "TRIGGER", ReferenceObject: "sales.orders_restored",
+					Statement: "CREATE TRIGGER orders_restored_trigger AFTER INSERT ON sales.orders_restored FOR EACH ROW EXECUTE PROCEDURE sales.orders_audit();"},
+				view,
+			}))
+		})
+		It("renames indexes and constraints named after their table", func() {
+			constraint := utils.StatementWithType{Schema: "sales", Name: "orders_pkey", ObjectType: "CONSTRAINT", ReferenceObject: "sales.orders",
+				Statement: "\n\nALTER TABLE ONLY sales.orders ADD CONSTRAINT orders_pkey PRIMARY KEY (id);\n"}
+			foreignKey := utils.StatementWithType{Schema: "sales", Name: "items_fkey", ObjectType: "CONSTRAINT", ReferenceObject: "sales.items",
+				Statement: "\n\nALTER TABLE ONLY sales.items ADD CONSTRAINT items_fkey FOREIGN KEY (order_id) REFERENCES sales.orders(id);\n"}
+			index := utils.StatementWithType{Schema: "sales", Name: "orders_date_idx", ObjectType: "INDEX", ReferenceObject: "sales.orders",
+				Statement: "\n\nCREATE INDEX orders_date_idx ON sales.orders USING btree (date);\nALTER INDEX sales.orders_date_idx SET TABLESPACE fast;\nALTER TABLE sales.orders CLUSTER ON orders_date_idx;"}
+
+			statements := utils.SubstituteRedirectTablesInStatements([]utils.StatementWithType{constraint, foreignKey, index}, tableMap)
+
+			Expect(statements).To(Equal([]utils.StatementWithType{
+				{Schema: "sales", Name: "orders_restored_pkey", ObjectType: "CONSTRAINT", ReferenceObject: "sales.orders_restored",
+					Statement: "\n\nALTER TABLE ONLY sales.orders_restored ADD CONSTRAINT orders_restored_pkey PRIMARY KEY (id);\n"},
+				{Schema: "sandbox", Name: "items_fkey", ObjectType: "CONSTRAINT", ReferenceObject: "sandbox.items",
+					Statement: "\n\nALTER TABLE ONLY sandbox.items ADD CONSTRAINT items_fkey FOREIGN KEY (order_id) REFERENCES sales.orders(id);\n"},
+				{Schema: "sales", Name: "orders_restored_date_idx", ObjectType: "INDEX", ReferenceObject: "sales.orders_restored",
+					Statement: "\n\nCREATE INDEX orders_restored_date_idx ON sales.orders_restored USING btree (date);\nALTER INDEX sales.orders_restored_date_idx SET TABLESPACE fast;\nALTER TABLE sales.orders_restored CLUSTER ON orders_restored_date_idx;"},
+			}))
+		})
+		It("prefixes the names of indexes, constraints, and triggers not named after their table with the new table name", func() {
+			customerMap := map[string]string{"sales.customer": "sales.customer_restored"}
+			index := utils.StatementWithType{Schema: "sales", Name: "idx_customer", ObjectType: "INDEX", ReferenceObject: "sales.customer",
+				Statement: "\n\nCREATE INDEX idx_customer ON sales.customer USING btree (name);\nALTER INDEX sales.idx_customer SET TABLESPACE fast;"}
+			constraint := utils.StatementWithType{Schema: "sales", Name: "pk_cust", ObjectType: "CONSTRAINT", ReferenceObject: "sales.customer",
+				Statement: "\n\nALTER TABLE ONLY sales.customer ADD CONSTRAINT pk_cust PRIMARY KEY (id);\n"}
+			quotedIndex := utils.StatementWithType{Schema: "sales", Name: `"Customer Name"`, ObjectType: "INDEX", ReferenceObject: "sales.customer",
+				Statement: "\n\nCREATE INDEX \"Customer Name\" ON sales.customer USING btree (name);"}
+			trigger := utils.StatementWithType{Schema: "sales", Name: "audit_trigger", ObjectType: "TRIGGER", ReferenceObject: "sales.customer",
+				Statement: "CREATE TRIGGER audit_trigger AFTER INSERT ON sales.customer FOR EACH ROW EXECUTE PROCEDURE sales.audit();"}
+
+			statements := utils.SubstituteRedirectTablesInStatements([]utils.StatementWithType{index, constraint, quotedIndex, trigger}, customerMap)
+
+			Expect(statements).To(Equal([]utils.StatementWithType{
+				{Schema: "sales", Name: "customer_restored_idx_customer", ObjectType: "INDEX", ReferenceObject: "sales.customer_restored",
+					Statement: "\n\nCREATE INDEX customer_restored_idx_customer ON sales.customer_restored USING btree (name);\nALTER INDEX sales.customer_restored_idx_customer SET TABLESPACE fast;"},
+				{Schema: "sales", Name: "customer_restored_pk_cust", ObjectType: "CONSTRAINT", ReferenceObject: "sales.customer_restored",
+					Statement: "\n\nALTER TABLE ONLY sales.customer_restored ADD CONSTRAINT customer_restored_pk_cust PRIMARY KEY (id);\n"},
+				{Schema: "sales", Name: `"customer_restored_Customer Name"`, ObjectType: "INDEX", ReferenceObject: "sales.customer_restored",
+					Statement: "\n\nCREATE INDEX \"customer_restored_Customer Name\" ON sales.customer_restored USING btree (name);"},
+				{Schema: "sales", Name: "customer_restored_audit_trigger", ObjectType: "TRIGGER", ReferenceObject: "sales.customer_restored",
+					Statement: "CREATE TRIGGER customer_restored_audit_trigger AFTER INSERT ON sales.customer_restored FOR EACH ROW EXECUTE PROCEDURE sales.audit();"},
+			}))
+		})
+		It("keeps the new names unique within the schema", func() {
+			existingConstraint := utils.StatementWithType{Schema: "sales", Name: "orders_restored_pkey", ObjectType: "CONSTRAINT", ReferenceObject: "sales.orders_old",
+				Statement: "\n\nALTER TABLE ONLY sales.orders_old ADD CONSTRAINT orders_restored_pkey PRIMARY KEY (id);\n"}
+			constraint := utils.StatementWithType{Schema: "sales", Name: "orders_pkey", ObjectType: "CONSTRAINT", ReferenceObject: "sales.orders",
+				Statement: "\n\nALTER TABLE ONLY sales.orders ADD CONSTRAINT orders_pkey PRIMARY KEY (id);\n"}
+
+			statements := utils.SubstituteRedirectTablesInStatements([]utils.StatementWithType{existingConstraint, constraint}, tableMap)
+
+			Expect(statements[0]).To(Equal(existingConstraint))
+			Expect(statements[1].Name).To(Equal("orders_restored_pkey_1"))
+			Expect(statements[1].Statement).To(Equal("\n\nALTER TABLE ONLY sales.orders_restored ADD CONSTRAINT orders_restored_pkey_1 PRIMARY KEY (id);\n"))
+		})
+		It("truncates the new names to the length of an identifier", func() {
+			longTableName := strings.Repeat("t", 60)
+			index := utils.StatementWithType{Schema: "sales", Name: "orders_date_idx", ObjectType: "INDEX", ReferenceObject: "sales.orders",
+				Statement: "\n\nCREATE INDEX orders_date_idx ON sales.orders USING btree (date);"}
+
+			statements := utils.SubstituteRedirectTablesInStatements([]utils.StatementWithType{index}, map[string]string{"sales.orders": "sales." + longTableName})
+
+			Expect(statements[0].Name).To(Equal(longTableName + "_da"))
+		})
+		It("renames the table in its statistics", func() {
+			statistics := utils.StatementWithType{Schema: "sales", Name: "orders", ObjectType: "STATISTICS",
+				Statement: "UPDATE pg_class\nSET\n\trelpages = 1::int,\n\treltuples = 1.000000::real\nWHERE relname = 'orders'\nAND relnamespace = 16384;\n\nDELETE FROM pg_statistic WHERE starelid = 'sales.orders'::regclass::oid AND staattnum = 1;"}
+
+			statements := utils.SubstituteRedirectTablesInStatements([]utils.StatementWithType{statistics}, tableMap)
+
+			Expect(statements[0].Name).To(Equal("orders_restored"))
+			Expect(statements[0].Statement).To(Equal("UPDATE pg_class\nSET\n\trelpages = 1::int,\n\treltuples = 1.000000::real\nWHERE relname = 'orders_restored'\nAND relnamespace = (SELECT oid FROM pg_namespace WHERE nspname = 'sales');\n\nDELETE FROM pg_statistic WHERE starelid = 'sales.orders_restored'::regclass::oid AND staattnum = 1;"))
+		})
+	})
+	Describe("RedirectSchemaForFQN", func() {
+		It("replaces the schema of a redirected table", func() {
+			Expect(utils.RedirectSchemaForFQN(`"Other Schema".foo`, map[string]string{`"Other Schema"`: "sandbox"})).To(Equal("sandbox.foo"))
+		})
+		It("leaves a table in a schema that is not redirected unchanged", func() {
+			Expect(utils.RedirectSchemaForFQN("public.foo", map[string]string{"pub": "sandbox"})).To(Equal("public.foo"))
+		})
+	})
 	Describe("RemoveActiveRoles", func() {
 		user1 := utils.StatementWithType{Name: "user1", ObjectType: "ROLE", Statement: "CREATE ROLE user1 SUPERUSER;\n"}
 		user2 := utils.StatementWithType{Name: "user2", ObjectType: "ROLE", Statement: "CREATE ROLE user2;\n"}
@@ -416,4 +615,13 @@ COMMENT ON DATABASE "db-special-chär$" IS 'this is a database comment';`}
 			Expect(roots).To(BeEmpty())
 		})
 	})
+	Describe("AddDataEntryChecksums", func() {
+		It("adds segment checksums to the data entries with matching oids", func() {
+			toc.AddMasterDataEntry("schema0", "name0", 0, "attribute0", 1, "")
+			toc.AddMasterDataEntry("schema1", "name1", 1, "attribute0", 1, "")
+			toc.AddDataEntryChecksums(map[uint32]map[int]string{1: {0: "checksum0", 1: "checksum1"}})
+			Expect(toc.DataEntries[0].Checksums).To(BeNil())
+			Expect(toc.DataEntries[1].Checksums).To(Equal(map[int]string{0: "checksum0", 1: "checksum1"}))
+		})
+	})
 })
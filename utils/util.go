@@ -50,6 +50,28 @@ func MakeFQN(schema string, object string) string {
 	return fmt.Sprintf("%s.%s", schema, object)
 }
 
+// This function assumes that the FQN has already been validated by ValidateFQNs
+func SplitFQN(fqn string) (string, string) {
+	schemaEnd := strings.Index(fqn, ".")
+	if strings.HasPrefix(fqn, `"`) {
+		for i := 1; i < len(fqn); i++ {
+			if fqn[i] != '"' {
+				continue
+			}
+			if i+1 < len(fqn) && fqn[i+1] == '"' {
+				i++
+				continue
+			}
+			schemaEnd = i + 1
+			break
+		}
+	}
+	if schemaEnd < 0 || schemaEnd >= len(fqn) {
+		return "", fqn
+	}
+	return fqn[:schemaEnd], fqn[schemaEnd+1:]
+}
+
 func ValidateFQNs(fqns []string) {
 	unquotedIdentString := "[a-z_][a-z0-9_]*"
 	validIdentString := fmt.Sprintf("(?:\"(.*)\"|(%s))", unquotedIdentString)
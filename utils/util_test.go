@@ -46,6 +46,18 @@ var _ = Describe("utils/util tests", func() {
 			Expect(actual).To(Equal(expected))
 		})
 	})
+	Describe("SplitFQN", func() {
+		It("splits an FQN into its schema and name", func() {
+			schema, name := utils.SplitFQN("sales.orders")
+			Expect(schema).To(Equal("sales"))
+			Expect(name).To(Equal("orders"))
+		})
+		It("splits an FQN whose quoted schema contains periods and quotes", func() {
+			schema, name := utils.SplitFQN(`"sales.""2019"".q1"."orders.old"`)
+			Expect(schema).To(Equal(`"sales.""2019"".q1"`))
+			Expect(name).To(Equal(`"orders.old"`))
+		})
+	})
 	Describe("ValidateFQNs", func() {
 		It("validates an unquoted string", func() {
 			testStrings := []string{`schemaname.tablename`}